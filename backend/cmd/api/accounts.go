@@ -2,16 +2,46 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/AdityaVarmaUddaraju/paytm/internal/data"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/fx"
 	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
 )
 
 func (app *application) createAccountHandler(w http.ResponseWriter, r *http.Request) {
 	user := app.contextGetUser(r)
 
-	err := app.models.Accounts.CreateAccount(user.ID)
+	var input struct {
+		Currency string `json:"currency"`
+	}
+
+	// the body is optional, without one a wallet in the default currency is created
+	if r.ContentLength != 0 {
+		err := app.readJSON(w, r, &input)
+
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	if input.Currency == "" {
+		input.Currency = data.DefaultCurrency
+	}
+
+	v := validator.New()
+
+	v.Check(data.IsSupportedCurrency(input.Currency), "currency", "is not supported")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err := app.models.Accounts.CreateAccount(user.ID, input.Currency)
 
 	if err != nil {
 		switch {
@@ -24,6 +54,12 @@ func (app *application) createAccountHandler(w http.ResponseWriter, r *http.Requ
 		}
 	}
 
+	app.audit(r, &data.AuditEvent{
+		Action:     data.AuditAccountCreate,
+		TargetType: "account",
+		TargetID:   fmt.Sprintf("%d/%s", user.ID, input.Currency),
+	})
+
 	data := envelope{
 		"message": "account created successfully",
 	}
@@ -35,19 +71,19 @@ func (app *application) addMoneyHandler(w http.ResponseWriter, r *http.Request)
 	user := app.contextGetUser(r)
 
 	var input struct {
-		Amount int `json:"amount"`
+		Amount data.Money `json:"amount"`
 	}
 
 	err := app.readJSON(w, r, &input)
 
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
 	v := validator.New()
 
-	v.Check(input.Amount > 0, "amount", "should be greater than or equal to 0")
+	data.ValidateMoney(v, "amount", input.Amount)
 
 	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
@@ -56,17 +92,41 @@ func (app *application) addMoneyHandler(w http.ResponseWriter, r *http.Request)
 
 	err = app.models.Accounts.AddMoney(user.ID, input.Amount)
 
+	var limitErr *data.LimitError
+
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrNoAccount):
 			app.accountMissingResponse(w, r)
 			return
+		case errors.Is(err, data.ErrAccountFrozen):
+			app.accountFrozenResponse(w, r)
+			return
+		case errors.Is(err, data.ErrAccountClosed):
+			app.accountClosedResponse(w, r)
+			return
+		case errors.Is(err, data.ErrCurrencyMismatch):
+			app.currencyMismatchResponse(w, r)
+			return
+		case errors.As(err, &limitErr):
+			app.limitExceededResponse(w, r, limitErr)
+			return
+		case errors.Is(err, data.ErrAmountOverflow):
+			app.amountOverflowResponse(w, r)
+			return
 		default:
 			app.serverErrorResponse(w, r, err)
 			return
 		}
 	}
 
+	app.audit(r, &data.AuditEvent{
+		Action:     data.AuditTopUp,
+		TargetType: "account",
+		TargetID:   fmt.Sprintf("%d/%s", user.ID, input.Amount.Currency),
+		After:      envelope{"amount": input.Amount},
+	})
+
 	data := envelope{
 		"message": "money added successfully",
 	}
@@ -79,7 +139,10 @@ func (app *application) transferMoneyHandler(w http.ResponseWriter, r *http.Requ
 
 	var input struct {
 		UserID int64 `json:"user_id"`
-		Amount int `json:"amount"`
+		Amount data.Money `json:"amount"`
+		ToCurrency string `json:"to_currency"`
+		MFACode string `json:"mfa_code"`
+		PIN string `json:"pin"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -107,25 +170,102 @@ func (app *application) transferMoneyHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	if input.ToCurrency == "" {
+		input.ToCurrency = input.Amount.Currency
+	}
+
 	v := validator.New()
 
-	v.Check(input.Amount > 0, "amount", "amount should be greater than 0")
+	data.ValidateMoney(v, "amount", input.Amount)
+	v.Check(data.IsSupportedCurrency(input.ToCurrency), "to_currency", "is not supported")
 
 	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Accounts.TransferMoney(user.ID, input.UserID, input.Amount)
+	if !app.requireVerified(w, r, user) {
+		return
+	}
+
+	if !app.requirePIN(w, r, user, input.PIN) {
+		return
+	}
+
+	if !app.stepUp(w, r, user, input.Amount, input.MFACode) {
+		return
+	}
+
+	transfer := &data.Transfer{
+		FromUserID: user.ID,
+		ToUserID:   input.UserID,
+		Amount:     input.Amount,
+	}
+
+	if input.ToCurrency != input.Amount.Currency {
+		transfer.Conversion, err = app.convert(r, input.Amount, input.ToCurrency)
+
+		if err != nil {
+			switch {
+			case errors.Is(err, fx.ErrRateNotFound):
+				app.rateUnavailableResponse(w, r)
+			case errors.Is(err, data.ErrConversionTooSmall):
+				v.AddError("amount", "is too small to convert")
+				app.failedValidationResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	err = app.models.Accounts.TransferMoney(transfer)
+
+	var (
+		limitErr *data.LimitError
+		heldErr  *data.TransferHeldError
+	)
 
 	if err != nil {
 		switch {
+		case errors.As(err, &heldErr):
+			app.audit(r, &data.AuditEvent{
+				Action:     data.AuditTransfer,
+				TargetType: "risk_review",
+				TargetID:   strconv.FormatInt(heldErr.Review.ID, 10),
+				After:      envelope{"outcome": "held", "transfer": transfer},
+			})
+
+			app.transferHeldResponse(w, r, heldErr.Review, "transfer is held for review, the amount is reserved until it is reviewed")
+			return
+		case errors.Is(err, data.ErrTransferBlocked):
+			app.audit(r, &data.AuditEvent{
+				Action: data.AuditTransfer,
+				After:  envelope{"outcome": "blocked", "transfer": transfer},
+			})
+			app.transferBlockedResponse(w, r)
+			return
 		case errors.Is(err, data.ErrInsuffientBalance):
 			app.insufficientBalanceResponse(w, r)
 			return
 		case errors.Is(err, data.ErrNoAccount):
 			app.accountMissingResponse(w, r)
 			return
+		case errors.Is(err, data.ErrAccountFrozen):
+			app.accountFrozenResponse(w, r)
+			return
+		case errors.Is(err, data.ErrAccountClosed):
+			app.accountClosedResponse(w, r)
+			return
+		case errors.Is(err, data.ErrCurrencyMismatch):
+			app.currencyMismatchResponse(w, r)
+			return
+		case errors.As(err, &limitErr):
+			app.limitExceededResponse(w, r, limitErr)
+			return
+		case errors.Is(err, data.ErrAmountOverflow):
+			app.amountOverflowResponse(w, r)
+			return
 		default:
 			app.serverErrorResponse(w, r, err)
 			return
@@ -133,8 +273,16 @@ func (app *application) transferMoneyHandler(w http.ResponseWriter, r *http.Requ
 
 	}
 
+	app.audit(r, &data.AuditEvent{
+		Action:     data.AuditTransfer,
+		TargetType: "journal",
+		TargetID:   strconv.FormatInt(transfer.JournalID, 10),
+		After:      envelope{"outcome": "completed", "transfer": transfer},
+	})
+
 	data := envelope{
-		"message": "amount transfered successfully",
+		"message":  "amount transfered successfully",
+		"transfer": transfer,
 	}
 
 	err = app.writeJson(w, http.StatusOK, data, nil)
@@ -142,3 +290,111 @@ func (app *application) transferMoneyHandler(w http.ResponseWriter, r *http.Requ
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// transferHeldResponse tells the user who made a transfer that risk screening
+// held it. They are not told which rules held it.
+func (app *application) transferHeldResponse(w http.ResponseWriter, r *http.Request, review *data.RiskReview, message string) {
+	data := envelope{
+		"message": message,
+		"review": envelope{
+			"id":         review.ID,
+			"status":     review.Status,
+			"to_user_id": review.ToUserID,
+			"amount":     review.Amount,
+			"created_at": review.CreatedAt,
+		},
+	}
+
+	err := app.writeJson(w, http.StatusAccepted, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var filters data.TransactionFilters
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	if cursor := app.readString(qs, "cursor", ""); cursor != "" {
+		id, err := data.DecodeCursor(cursor)
+
+		if err != nil {
+			v.AddError("cursor", "is invalid")
+		}
+
+		filters.Cursor = id
+	}
+
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	filters.From = app.readTime(qs, "from", v)
+	filters.To = app.readTime(qs, "to", v)
+	filters.Direction = app.readString(qs, "direction", "")
+	filters.Currency = app.readString(qs, "currency", "")
+	filters.MinAmount = app.readMoney(qs, "min_amount", filters.Currency, v)
+	filters.MaxAmount = app.readMoney(qs, "max_amount", filters.Currency, v)
+
+	if data.ValidateTransactionFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	transactions, metadata, err := app.models.Ledger.GetTransactions(user.ID, filters)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"transactions": transactions,
+		"metadata":     metadata,
+	}
+
+	err = app.writeJson(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	accounts, err := app.models.Accounts.GetAccounts(user.ID)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"accounts": accounts,
+	}
+
+	err = app.writeJson(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listLimitsHandler shows the user's limits and how much of them they have
+// used in each currency they hold.
+func (app *application) listLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	limits, err := app.models.Limits.GetForUser(user.ID)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"limits": limits}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
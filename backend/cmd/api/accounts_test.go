@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestTransferMoney(t *testing.T) {
+	app := newTestApp(t)
+
+	alice := app.signUp(t, "alice", "+919876543210", true)
+	bob := app.signUp(t, "bob", "+919876543211", false)
+	carol := app.signUp(t, "carol", "+919876543212", false)
+
+	for _, token := range []string{alice, bob, carol} {
+		if status, _ := app.do(t, http.MethodPost, "/v1/accounts/create", token, nil); status != http.StatusCreated {
+			t.Fatalf("create account: got status %d", status)
+		}
+	}
+
+	if status, _ := app.do(t, http.MethodPost, "/v1/accounts/add", alice, map[string]any{"amount": inr("20000.00")}); status != http.StatusOK {
+		t.Fatalf("add money: got status %d", status)
+	}
+
+	if status, _ := app.do(t, http.MethodPost, "/v1/users/pin", alice, map[string]string{"pin": "1357", "password": "pa55word"}); status != http.StatusCreated {
+		t.Fatalf("set pin: got status %d", status)
+	}
+
+	bobID := app.userID(t, bob)
+	carolID := app.userID(t, carol)
+
+	tests := []struct {
+		name   string
+		token  string
+		to     int64
+		amount string
+		pin    string
+		want   int
+		code   string
+	}{
+		{"unverified sender", bob, carolID, "10.00", "", http.StatusForbidden, "verification_required"},
+		{"no pin", alice, bobID, "10.00", "", http.StatusForbidden, "pin_required"},
+		{"wrong pin", alice, bobID, "10.00", "2468", http.StatusUnauthorized, ""},
+		{"insufficient balance", alice, bobID, "20000.01", "1357", http.StatusConflict, ""},
+		{"needs step-up", alice, bobID, "25000.00", "1357", http.StatusForbidden, "mfa_not_enabled"},
+		{"over recipient wallet limit", alice, bobID, "10000.01", "1357", http.StatusUnprocessableEntity, "balance_limit_exceeded"},
+		{"sent", alice, bobID, "10000.00", "1357", http.StatusOK, ""},
+		{"recipient wallet full", alice, bobID, "0.01", "1357", http.StatusUnprocessableEntity, "balance_limit_exceeded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, res := app.do(t, http.MethodPost, "/v1/accounts/transfer", tt.token, map[string]any{
+				"user_id": tt.to,
+				"amount":  inr(tt.amount),
+				"pin":     tt.pin,
+			})
+
+			if status != tt.want {
+				t.Fatalf("got status %d, want %d: %v", status, tt.want, res)
+			}
+
+			if tt.code == "" {
+				return
+			}
+
+			if e, _ := res["error"].(map[string]any); e["code"] != tt.code {
+				t.Errorf("got error %v, want code %s", res["error"], tt.code)
+			}
+		})
+	}
+
+	_, res := app.do(t, http.MethodGet, "/v1/accounts", bob, nil)
+
+	accounts := res["accounts"].([]any)
+	balance := accounts[0].(map[string]any)["balance"].(map[string]any)["value"]
+
+	if balance != "10000.00" {
+		t.Errorf("got recipient balance %v, want 10000.00", balance)
+	}
+}
+
+func TestListLimits(t *testing.T) {
+	app := newTestApp(t)
+
+	alice := app.signUp(t, "alice", "+919876543210", true)
+
+	app.do(t, http.MethodPost, "/v1/accounts/create", alice, nil)
+
+	status, res := app.do(t, http.MethodGet, "/v1/accounts/limits", alice, nil)
+
+	if status != http.StatusOK {
+		t.Fatalf("got status %d", status)
+	}
+
+	limits := res["limits"].([]any)
+
+	if len(limits) != 1 {
+		t.Fatalf("got %d limits, want 1", len(limits))
+	}
+
+	inrLimits := limits[0].(map[string]any)
+
+	if inrLimits["verification_level"] != float64(1) {
+		t.Errorf("got verification level %v, want 1", inrLimits["verification_level"])
+	}
+
+	if max := inrLimits["max_transaction"].(map[string]any)["value"]; max != "100000.00" {
+		t.Errorf("got max transaction %v, want 100000.00", max)
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/data"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+)
+
+// getUserForAdmin reads the user named by the id param, it writes a 404 and
+// returns nil when there is none.
+func (app *application) getUserForAdmin(w http.ResponseWriter, r *http.Request) *data.User {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	user, err := app.models.Users.GetByID(id)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	return user
+}
+
+func (app *application) showUserAdminHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getUserForAdmin(w, r)
+
+	if user == nil {
+		return
+	}
+
+	accounts, err := app.models.Accounts.GetAccounts(user.ID)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"user":        user,
+		"contact":     user.Contact(),
+		"role":        user.Role,
+		"permissions": app.userPermissions(user),
+		"accounts":    accounts,
+	}
+
+	err = app.writeJson(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) setUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	admin := app.contextGetUser(r)
+
+	user := app.getUserForAdmin(w, r)
+
+	if user == nil {
+		return
+	}
+
+	var input struct {
+		Role string `json:"role"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(data.IsRole(input.Role), "role", "is not a role")
+	v.Check(user.ID != admin.ID, "role", "you cannot change your own role")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Users.SetRole(user.ID, input.Role)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{
+		Action:     data.AuditRoleChange,
+		TargetType: "user",
+		TargetID:   strconv.FormatInt(user.ID, 10),
+		Before:     envelope{"role": user.Role},
+		After:      envelope{"role": input.Role},
+	})
+
+	user.Role = input.Role
+
+	data := envelope{
+		"user":        user,
+		"role":        user.Role,
+		"permissions": app.userPermissions(user),
+	}
+
+	err = app.writeJson(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) freezeAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	app.setAccountStatus(w, r, true)
+}
+
+func (app *application) unfreezeAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	app.setAccountStatus(w, r, false)
+}
+
+// setAccountStatus freezes or unfreezes the user's wallet in the currency of
+// the request, or all their open wallets when it has none. A freeze stops
+// all money movement unless its mode is "debit", which still lets money in.
+func (app *application) setAccountStatus(w http.ResponseWriter, r *http.Request, freeze bool) {
+	user := app.getUserForAdmin(w, r)
+
+	if user == nil {
+		return
+	}
+
+	var input struct {
+		Currency string `json:"currency"`
+		Mode     string `json:"mode"`
+		Reason   string `json:"reason"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.Currency == "" || data.IsSupportedCurrency(input.Currency), "currency", "is not supported")
+	v.Check(input.Reason != "", "reason", "must be provided")
+	v.Check(len(input.Reason) <= 500, "reason", "must not be more than 500 bytes long")
+
+	status, action := data.AccountActive, data.AuditAccountUnfreeze
+
+	if freeze {
+		status, action = data.AccountFrozenAll, data.AuditAccountFreeze
+
+		if input.Mode == "debit" {
+			status = data.AccountFrozenDebit
+		}
+
+		v.Check(validator.PermittedValue(input.Mode, "", "all", "debit"), "mode", "must be debit or all")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	accounts, err := app.models.Accounts.SetStatus(user.ID, input.Currency, status)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoAccount):
+			app.accountMissingResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{
+		Action:     action,
+		TargetType: "user",
+		TargetID:   strconv.FormatInt(user.ID, 10),
+		After:      envelope{"currency": input.Currency, "status": status, "reason": input.Reason},
+	})
+
+	err = app.writeJson(w, http.StatusOK, envelope{"accounts": accounts}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// adjustBalanceHandler credits or debits a wallet outside of any transfer,
+// for corrections support cannot make otherwise. The reason is kept with the
+// journal.
+func (app *application) adjustBalanceHandler(w http.ResponseWriter, r *http.Request) {
+	admin := app.contextGetUser(r)
+
+	user := app.getUserForAdmin(w, r)
+
+	if user == nil {
+		return
+	}
+
+	var input struct {
+		Amount data.Money `json:"amount"`
+		Reason string     `json:"reason"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	adjustment := &data.Adjustment{
+		UserID:    user.ID,
+		Amount:    input.Amount,
+		Reason:    input.Reason,
+		CreatedBy: admin.ID,
+	}
+
+	v := validator.New()
+
+	if data.ValidateAdjustment(v, adjustment); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Accounts.Adjust(adjustment)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoAccount):
+			app.accountMissingResponse(w, r)
+		case errors.Is(err, data.ErrAccountClosed):
+			app.accountClosedResponse(w, r)
+		case errors.Is(err, data.ErrInsuffientBalance):
+			app.insufficientBalanceResponse(w, r)
+		case errors.Is(err, data.ErrAmountOverflow):
+			app.amountOverflowResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{
+		Action:     data.AuditBalanceAdjust,
+		TargetType: "account",
+		TargetID:   fmt.Sprintf("%d/%s", user.ID, adjustment.Amount.Currency),
+		After:      adjustment,
+	})
+
+	err = app.writeJson(w, http.StatusCreated, envelope{"adjustment": adjustment}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// unlockUserHandler lifts a sign-in lockout, for a user locked out by someone
+// guessing their password.
+func (app *application) unlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getUserForAdmin(w, r)
+
+	if user == nil {
+		return
+	}
+
+	err := app.models.Throttles.Reset(data.UsernameThrottleKey(user.UserName))
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{
+		Action:     data.AuditUserUnlock,
+		TargetType: "user",
+		TargetID:   strconv.FormatInt(user.ID, 10),
+	})
+
+	data := envelope{
+		"message": "sign-in unlocked",
+	}
+
+	err = app.writeJson(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// resetPasswordAdminHandler gives the user a temporary password and signs
+// them out everywhere. Only someone who can assign roles may reset the
+// password of staff, otherwise support could take over an admin.
+func (app *application) resetPasswordAdminHandler(w http.ResponseWriter, r *http.Request) {
+	admin := app.contextGetUser(r)
+
+	user := app.getUserForAdmin(w, r)
+
+	if user == nil {
+		return
+	}
+
+	if len(app.userPermissions(user)) > 0 && !app.userPermissions(admin).Include(data.PermissionRolesAssign) {
+		app.permissionRequiredResponse(w, r, data.PermissionRolesAssign)
+		return
+	}
+
+	password, err := data.GenerateTemporaryPassword()
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = user.Password.Set(password)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Users.UpdateUser(user)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Sessions.RevokeAllForUser(user.ID)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{
+		Action:     data.AuditPasswordReset,
+		TargetType: "user",
+		TargetID:   strconv.FormatInt(user.ID, 10),
+	})
+
+	data := envelope{
+		"message":            "password reset, the user has been signed out everywhere",
+		"temporary_password": password,
+	}
+
+	err = app.writeJson(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/data"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+)
+
+const (
+	auditChainBatch        = 1000
+	maxAuditUserAgentBytes = 512
+)
+
+// audit records e with where the request came from. Unless the caller set
+// one, the actor is the signed in user. The action has already happened, so
+// a failure is logged rather than failing the request.
+func (app *application) audit(r *http.Request, e *data.AuditEvent) {
+	if user, ok := r.Context().Value(userContextKey).(*data.User); ok && e.ActorID == nil {
+		e.ActorID = &user.ID
+	}
+
+	e.IP = clientIP(r)
+
+	e.UserAgent = r.UserAgent()
+
+	if len(e.UserAgent) > maxAuditUserAgentBytes {
+		e.UserAgent = e.UserAgent[:maxAuditUserAgentBytes]
+	}
+
+	e.RequestID = app.contextGetRequestID(r)
+
+	err := app.models.Audit.Insert(e)
+
+	if err != nil {
+		app.logger.Error(err.Error(), "audit_action", e.Action, "request_id", e.RequestID)
+	}
+}
+
+func (app *application) listAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	var filters data.AuditFilters
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	if cursor := app.readString(qs, "cursor", ""); cursor != "" {
+		id, err := data.DecodeCursor(cursor)
+
+		if err != nil {
+			v.AddError("cursor", "is invalid")
+		}
+
+		filters.Cursor = id
+	}
+
+	filters.PageSize = app.readInt(qs, "page_size", 50, v)
+	filters.ActorID = int64(app.readInt(qs, "actor_id", 0, v))
+	filters.Action = app.readString(qs, "action", "")
+	filters.TargetType = app.readString(qs, "target_type", "")
+	filters.TargetID = app.readString(qs, "target_id", "")
+	filters.From = app.readTime(qs, "from", v)
+	filters.To = app.readTime(qs, "to", v)
+
+	if data.ValidateAuditFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	events, metadata, err := app.models.Audit.GetAll(filters)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"audit_events": events,
+		"metadata":     metadata,
+	}
+
+	err = app.writeJson(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// verifyAuditLogHandler recomputes the hash chain, an invalid result means
+// events were changed or removed after they were chained.
+func (app *application) verifyAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	verification, err := app.models.Audit.Verify()
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !verification.Valid {
+		app.logger.Error("audit log chain is broken", "broken_at", *verification.BrokenAt)
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"verification": verification}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// chainAuditEvents chains any event inserted before events were chained on
+// insert.
+func (app *application) chainAuditEvents() error {
+	for {
+		count, err := app.models.Audit.Chain(auditChainBatch)
+
+		if err != nil {
+			return err
+		}
+
+		if count < auditChainBatch {
+			return nil
+		}
+	}
+}
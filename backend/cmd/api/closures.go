@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/data"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/fx"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+)
+
+// closeAccountHandler closes one of the user's wallets. What is left in it
+// can only be swept to another of their own wallets.
+func (app *application) closeAccountHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Currency        string `json:"currency"`
+		SweepToCurrency string `json:"sweep_to_currency"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	closure := &data.Closure{
+		UserID:   user.ID,
+		Currency: input.Currency,
+	}
+
+	if input.SweepToCurrency != "" {
+		closure.SweepToUserID = user.ID
+		closure.SweepToCurrency = input.SweepToCurrency
+	}
+
+	app.closeAccount(w, r, closure, "")
+}
+
+// closeAccountAdminHandler closes a user's wallet on their behalf, frozen or
+// not, and can sweep it to anyone's wallet, an escrow named in a court order
+// for instance.
+func (app *application) closeAccountAdminHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getUserForAdmin(w, r)
+
+	if user == nil {
+		return
+	}
+
+	var input struct {
+		Currency string `json:"currency"`
+		SweepTo  *struct {
+			UserID   int64  `json:"user_id"`
+			Currency string `json:"currency"`
+		} `json:"sweep_to"`
+		Reason string `json:"reason"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.Reason != "", "reason", "must be provided")
+	v.Check(len(input.Reason) <= 500, "reason", "must not be more than 500 bytes long")
+
+	if input.SweepTo != nil {
+		v.Check(input.SweepTo.UserID > 0, "sweep_to", "must name a user")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	closure := &data.Closure{
+		UserID:      user.ID,
+		Currency:    input.Currency,
+		AllowFrozen: true,
+	}
+
+	if input.SweepTo != nil {
+		closure.SweepToUserID = input.SweepTo.UserID
+		closure.SweepToCurrency = input.SweepTo.Currency
+
+		if closure.SweepToCurrency == "" {
+			closure.SweepToCurrency = input.Currency
+		}
+	}
+
+	app.closeAccount(w, r, closure, input.Reason)
+}
+
+// closeAccount closes the wallet c names and writes the response. The rate of
+// a sweep between currencies is fetched up front, the balance it converts is
+// only known once the wallet is locked.
+func (app *application) closeAccount(w http.ResponseWriter, r *http.Request, c *data.Closure, reason string) {
+	v := validator.New()
+
+	if data.ValidateClosure(v, c); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if c.SweepToUserID != 0 && c.SweepToCurrency != c.Currency {
+		rate, err := app.rates.Rate(r.Context(), c.Currency, c.SweepToCurrency)
+
+		if err != nil {
+			switch {
+			case errors.Is(err, fx.ErrRateNotFound):
+				app.rateUnavailableResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		c.Rate = &rate
+		c.SpreadBps = app.cfg.fx.spreadBps
+	}
+
+	err := app.models.Accounts.Close(c)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoAccount):
+			app.accountMissingResponse(w, r)
+		case errors.Is(err, data.ErrAccountClosed):
+			app.accountClosedResponse(w, r)
+		case errors.Is(err, data.ErrAccountFrozen):
+			app.accountFrozenResponse(w, r)
+		case errors.Is(err, data.ErrFundsHeld):
+			app.fundsHeldResponse(w, r)
+		case errors.Is(err, data.ErrBalanceNotZero):
+			app.balanceNotZeroResponse(w, r)
+		case errors.Is(err, data.ErrAmountOverflow):
+			app.amountOverflowResponse(w, r)
+		case errors.Is(err, data.ErrConversionTooSmall):
+			v.AddError("sweep_to_currency", "balance is too small to convert")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	after := envelope{"sweep": c.Sweep}
+
+	if reason != "" {
+		after["reason"] = reason
+	}
+
+	app.audit(r, &data.AuditEvent{
+		Action:     data.AuditAccountClose,
+		TargetType: "account",
+		TargetID:   fmt.Sprintf("%d/%s", c.UserID, c.Currency),
+		After:      after,
+	})
+
+	data := envelope{
+		"account": c.Account,
+		"sweep":   c.Sweep,
+	}
+
+	err = app.writeJson(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -2,7 +2,7 @@ package main
 
 import (
 	"context"
-	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
@@ -12,7 +12,14 @@ import (
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey        = contextKey("user")
+	sessionContextKey     = contextKey("session")
+	apiKeyContextKey      = contextKey("apiKey")
+	merchantContextKey    = contextKey("merchant")
+	apiKeyScopeContextKey = contextKey("apiKeyScope")
+	requestIDContextKey   = contextKey("requestID")
+)
 
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
 	ctx := context.WithValue(r.Context(), userContextKey, user)
@@ -29,13 +36,67 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 	return user
 }
 
+func (app *application) contextSetSessionID(r *http.Request, sessionID int64) *http.Request {
+	ctx := context.WithValue(r.Context(), sessionContextKey, sessionID)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetSessionID(r *http.Request) int64 {
+	sessionID, ok := r.Context().Value(sessionContextKey).(int64)
+
+	if !ok {
+		panic("missing session value in request context")
+	}
+
+	return sessionID
+}
+
+func (app *application) contextSetAPIKey(r *http.Request, key *data.APIKey, merchant *data.Merchant) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, key)
+	ctx = context.WithValue(ctx, merchantContextKey, merchant)
+	return r.WithContext(ctx)
+}
+
+// contextGetMerchant returns the merchant whose API key authenticated the
+// request, or nil when a user signed in with a token.
+func (app *application) contextGetMerchant(r *http.Request) *data.Merchant {
+	merchant, _ := r.Context().Value(merchantContextKey).(*data.Merchant)
+	return merchant
+}
+
+func (app *application) contextSetAPIKeyScope(r *http.Request, scope string) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyScopeContextKey, scope)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetAPIKeyScope(r *http.Request) string {
+	scope, _ := r.Context().Value(apiKeyScopeContextKey).(string)
+	return scope
+}
+
+func (app *application) contextSetRequestID(r *http.Request, requestID string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, requestID)
+	return r.WithContext(ctx)
+}
+
+// contextGetRequestID returns the id requestID gave the request, or an empty
+// string outside of it.
+func (app *application) contextGetRequestID(r *http.Request) string {
+	requestID, _ := r.Context().Value(requestIDContextKey).(string)
+	return requestID
+}
+
 func (app *application) readIdParam(r *http.Request) (int64, error) {
+	return app.readInt64Param(r, "id")
+}
+
+func (app *application) readInt64Param(r *http.Request, name string) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
 
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 
-	if err != nil || id < 1  {
-		return 0, errors.New("invalid id param")
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("invalid %s param", name)
 	}
 
 	return id, nil
@@ -2,7 +2,12 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/data"
 )
 
 func (app *application) logError(r *http.Request, err error) {
@@ -10,6 +15,7 @@ func (app *application) logError(r *http.Request, err error) {
 		err.Error(),
 		"request_method", r.Method,
 		"request_url", r.URL.String(),
+		"request_id", app.contextGetRequestID(r),
 	)
 }
 
@@ -61,6 +67,16 @@ func (app *application) duplicateUsernameResponse(w http.ResponseWriter, r *http
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
 
+func (app *application) duplicateEmailResponse(w http.ResponseWriter, r *http.Request) {
+	message := "email already exists"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) duplicatePhoneResponse(w http.ResponseWriter, r *http.Request) {
+	message := "phone already exists"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
 func (app *application) invalidJWTTokenResponse(w http.ResponseWriter, r *http.Request, message string) {
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
 }
@@ -89,3 +105,221 @@ func (app *application) insufficientBalanceResponse(w http.ResponseWriter, r *ht
 	message := "insufficent balance"
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
+
+func (app *application) idempotencyKeyMismatchResponse(w http.ResponseWriter, r *http.Request) {
+	message := "idempotency key was already used with a different request"
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, message)
+}
+
+func (app *application) idempotencyKeyInUseResponse(w http.ResponseWriter, r *http.Request) {
+	message := "a request with this idempotency key is still being processed"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) currencyMismatchResponse(w http.ResponseWriter, r *http.Request) {
+	message := "amount currency does not match the account currency"
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, message)
+}
+
+func (app *application) amountOverflowResponse(w http.ResponseWriter, r *http.Request) {
+	message := "resulting balance is too large"
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, message)
+}
+
+func (app *application) rateUnavailableResponse(w http.ResponseWriter, r *http.Request) {
+	message := "exchange rate between these currencies is not available"
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, message)
+}
+
+func (app *application) invalidRefreshTokenResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid or expired refresh token"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) holdNotActiveResponse(w http.ResponseWriter, r *http.Request) {
+	message := "hold is no longer active"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) notRefundableResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this transaction cannot be refunded"
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, message)
+}
+
+func (app *application) scheduleNotActiveResponse(w http.ResponseWriter, r *http.Request) {
+	message := "scheduled transfer is no longer active"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) requestNotPendingResponse(w http.ResponseWriter, r *http.Request) {
+	message := "payment request is no longer pending"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) invalidAPIKeyResponse(w http.ResponseWriter, r *http.Request, message string) {
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) missingScopeResponse(w http.ResponseWriter, r *http.Request, scope string) {
+	message := fmt.Sprintf("api key does not have the %s scope", scope)
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) orderNotPendingResponse(w http.ResponseWriter, r *http.Request) {
+	message := "order is no longer pending"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) limitExceededResponse(w http.ResponseWriter, r *http.Request, err *data.LimitError) {
+	message := map[string]string{
+		"code":    err.Code,
+		"message": err.Message,
+	}
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, message)
+}
+
+func (app *application) transferBlockedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "transfer was blocked by risk screening, contact support"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) reviewNotPendingResponse(w http.ResponseWriter, r *http.Request) {
+	message := "review is no longer pending"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) reviewOriginChangedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "what the transfer was made for can no longer be completed, reject the review instead"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) permissionRequiredResponse(w http.ResponseWriter, r *http.Request, code string) {
+	message := fmt.Sprintf("you need the %s permission to use this endpoint", code)
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) accountFrozenResponse(w http.ResponseWriter, r *http.Request) {
+	message := "account is frozen, contact support"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) accountClosedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "account is closed"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) balanceNotZeroResponse(w http.ResponseWriter, r *http.Request) {
+	message := "account still has a balance, empty it or name an account to sweep it to"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) fundsHeldResponse(w http.ResponseWriter, r *http.Request) {
+	message := "account has funds on hold, wait for them to be captured or released"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) invalidMFACodeResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid two-factor code"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) mfaEnabledResponse(w http.ResponseWriter, r *http.Request) {
+	message := "two-factor authentication is already enabled"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) mfaNotEnabledResponse(w http.ResponseWriter, r *http.Request) {
+	message := "two-factor authentication is not enabled"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// authorizationRequiredResponse tells the client to ask the user for a
+// two-factor code or their transaction PIN and send it with the request
+// again, or to have them set it up first.
+func (app *application) authorizationRequiredResponse(w http.ResponseWriter, r *http.Request, code, message string) {
+	app.errorResponse(w, r, http.StatusForbidden, map[string]string{
+		"code":    code,
+		"message": message,
+	})
+}
+
+func (app *application) invalidPINResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid transaction PIN"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) pinExistsResponse(w http.ResponseWriter, r *http.Request) {
+	message := "transaction PIN is already set, change or reset it instead"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) pinNotSetResponse(w http.ResponseWriter, r *http.Request) {
+	message := "transaction PIN is not set"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// retryAfterResponse is errorResponse for a client that may try again at
+// until, which it is told in the Retry-After header.
+func (app *application) retryAfterResponse(w http.ResponseWriter, r *http.Request, status int, until time.Time, message string) {
+	retryAfter := int(math.Ceil(time.Until(until).Seconds()))
+
+	headers := make(http.Header)
+	headers.Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+
+	data := envelope{
+		"error": message,
+	}
+
+	err := app.writeJson(w, status, data, headers)
+
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (app *application) pinLockedResponse(w http.ResponseWriter, r *http.Request, err *data.PINLockedError) {
+	message := fmt.Sprintf("too many wrong PINs, try again after %s", err.Until.Format(time.RFC3339))
+	app.retryAfterResponse(w, r, http.StatusLocked, err.Until, message)
+}
+
+func (app *application) pinDisabledResponse(w http.ResponseWriter, r *http.Request) {
+	message := "too many wrong PINs, reset the transaction PIN with your password to use it again"
+	app.errorResponse(w, r, http.StatusLocked, message)
+}
+
+// signInThrottledResponse tells the client to slow down, or that sign-in is
+// locked for a while after too many failures.
+func (app *application) signInThrottledResponse(w http.ResponseWriter, r *http.Request, err *data.ThrottledError) {
+	if err.Locked {
+		message := fmt.Sprintf("too many failed sign-ins, sign-in is locked until %s", err.Until.Format(time.RFC3339))
+		app.retryAfterResponse(w, r, http.StatusLocked, err.Until, message)
+		return
+	}
+
+	message := fmt.Sprintf("too many failed sign-ins, try again after %s", err.Until.Format(time.RFC3339))
+	app.retryAfterResponse(w, r, http.StatusTooManyRequests, err.Until, message)
+}
+
+// mfaThrottledResponse tells the user to slow down, or that two-factor codes
+// are locked for a while after too many wrong ones.
+func (app *application) mfaThrottledResponse(w http.ResponseWriter, r *http.Request, err *data.ThrottledError) {
+	if err.Locked {
+		message := fmt.Sprintf("too many wrong two-factor codes, they are locked until %s", err.Until.Format(time.RFC3339))
+		app.retryAfterResponse(w, r, http.StatusLocked, err.Until, message)
+		return
+	}
+
+	message := fmt.Sprintf("too many wrong two-factor codes, try again after %s", err.Until.Format(time.RFC3339))
+	app.retryAfterResponse(w, r, http.StatusTooManyRequests, err.Until, message)
+}
+
+func (app *application) contactMissingResponse(w http.ResponseWriter, r *http.Request, channel string) {
+	message := fmt.Sprintf("there is no %s on your account, add one first", channel)
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) contactVerifiedResponse(w http.ResponseWriter, r *http.Request, channel string) {
+	message := fmt.Sprintf("your %s is already verified", channel)
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
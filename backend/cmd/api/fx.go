@@ -0,0 +1,19 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/data"
+)
+
+// convert quotes amount in the target currency using the configured rate
+// provider and spread.
+func (app *application) convert(r *http.Request, amount data.Money, currency string) (*data.Conversion, error) {
+	rate, err := app.rates.Rate(r.Context(), amount.Currency, currency)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return data.NewConversion(amount, rate, app.cfg.fx.spreadBps)
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/data"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+)
+
+func (app *application) createGroupHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Name     string   `json:"name"`
+		Currency string   `json:"currency"`
+		Members  []string `json:"members"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Currency == "" {
+		input.Currency = data.DefaultCurrency
+	}
+
+	group := &data.Group{
+		Name:      input.Name,
+		Currency:  input.Currency,
+		CreatedBy: user.ID,
+	}
+
+	v := validator.New()
+
+	if data.ValidateGroup(v, group, input.Members); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Groups.Insert(group, input.Members)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrUnknownMember):
+			v.AddError("members", "must all be existing usernames")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeJson(w, http.StatusCreated, envelope{"group": group}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	groups, err := app.models.Groups.GetAllForUser(user.ID)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"groups": groups}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getGroupForMember loads the group named in the URL when the user is one of
+// its members, it writes the error response and returns nil otherwise.
+func (app *application) getGroupForMember(w http.ResponseWriter, r *http.Request, user *data.User) *data.Group {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	group, err := app.models.Groups.Get(id)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	if !group.IsMember(user.ID) {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	return group
+}
+
+func (app *application) showGroupHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	group := app.getGroupForMember(w, r, user)
+
+	if group == nil {
+		return
+	}
+
+	balances, err := app.models.Groups.Balances(group.ID)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"group":    group,
+		"balances": balances,
+	}
+
+	err = app.writeJson(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createExpenseHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	group := app.getGroupForMember(w, r, user)
+
+	if group == nil {
+		return
+	}
+
+	var input struct {
+		PaidBy       int64      `json:"paid_by"`
+		Amount       data.Money `json:"amount"`
+		Description  string     `json:"description"`
+		Split        string     `json:"split"`
+		Participants []int64    `json:"participants"`
+		Shares       []struct {
+			UserID  int64       `json:"user_id"`
+			Percent float64     `json:"percent"`
+			Amount  *data.Money `json:"amount"`
+		} `json:"shares"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.PaidBy == 0 {
+		input.PaidBy = user.ID
+	}
+
+	if input.Split == "" {
+		input.Split = data.SplitEqual
+	}
+
+	expense := &data.Expense{
+		GroupID:     group.ID,
+		PaidBy:      input.PaidBy,
+		Amount:      input.Amount,
+		Description: input.Description,
+		Split:       input.Split,
+		CreatedBy:   user.ID,
+	}
+
+	v := validator.New()
+
+	switch input.Split {
+	case data.SplitEqual:
+		// an equal split is shared by the whole group unless participants
+		// are given
+		participants := input.Participants
+
+		if len(participants) == 0 {
+			for _, m := range group.Members {
+				participants = append(participants, m.UserID)
+			}
+		}
+
+		for i, share := range data.SplitEvenly(input.Amount, len(participants)) {
+			expense.Shares = append(expense.Shares, data.ExpenseShare{UserID: participants[i], Amount: share})
+		}
+	case data.SplitPercentage:
+		bps := make([]int64, len(input.Shares))
+
+		for i, share := range input.Shares {
+			bps[i] = int64(math.Round(share.Percent * 100))
+		}
+
+		amounts, err := data.SplitByBasisPoints(input.Amount, bps)
+
+		if err != nil {
+			v.AddError("shares", "percentages must add up to 100")
+			break
+		}
+
+		for i, share := range input.Shares {
+			expense.Shares = append(expense.Shares, data.ExpenseShare{UserID: share.UserID, Amount: amounts[i]})
+		}
+	case data.SplitExact:
+		for _, share := range input.Shares {
+			if share.Amount == nil {
+				v.AddError("shares", "must each have an amount")
+				break
+			}
+
+			expense.Shares = append(expense.Shares, data.ExpenseShare{UserID: share.UserID, Amount: *share.Amount})
+		}
+	default:
+		v.AddError("split", "must be equal, percentage or exact")
+	}
+
+	if data.ValidateExpense(v, expense, group); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Groups.AddExpense(expense)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusCreated, envelope{"expense": expense}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listExpensesHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	group := app.getGroupForMember(w, r, user)
+
+	if group == nil {
+		return
+	}
+
+	expenses, err := app.models.Groups.GetExpenses(group.ID)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"expenses": expenses}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// settleUpHandler suggests the transfers that settle every balance in the
+// group.
+func (app *application) settleUpHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	group := app.getGroupForMember(w, r, user)
+
+	if group == nil {
+		return
+	}
+
+	balances, err := app.models.Groups.Balances(group.ID)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"balances":    balances,
+		"settlements": data.PlanSettlements(balances),
+	}
+
+	err = app.writeJson(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createSettlementHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	group := app.getGroupForMember(w, r, user)
+
+	if group == nil {
+		return
+	}
+
+	var input struct {
+		ToUserID int64       `json:"to_user_id"`
+		Amount   *data.Money `json:"amount"`
+		MFACode  string      `json:"mfa_code"`
+		PIN      string      `json:"pin"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(group.IsMember(input.ToUserID), "to_user_id", "must be a member of the group")
+	v.Check(input.ToUserID != user.ID, "to_user_id", "must not be yourself")
+
+	if input.Amount != nil {
+		data.ValidateMoney(v, "amount", *input.Amount)
+		v.Check(input.Amount.Currency == group.Currency, "amount", "must be in the currency of the group")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.requireVerified(w, r, user) {
+		return
+	}
+
+	if !app.requirePIN(w, r, user, input.PIN) {
+		return
+	}
+
+	// settling whatever is owed steps up for that amount and then settles
+	// exactly it
+	if input.Amount == nil {
+		balances, err := app.models.Groups.Balances(group.ID)
+
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		owed, err := data.Owed(balances, user.ID, input.ToUserID)
+
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrSettlementExceedsBalance):
+				v.AddError("amount", "must not exceed what you owe or what they are owed")
+				app.failedValidationResponse(w, r, v.Errors)
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		input.Amount = &owed
+	}
+
+	if !app.stepUp(w, r, user, *input.Amount, input.MFACode) {
+		return
+	}
+
+	settlement, transfer, err := app.models.Groups.Settle(group.ID, user.ID, input.ToUserID, input.Amount)
+
+	var (
+		limitErr *data.LimitError
+		heldErr  *data.TransferHeldError
+	)
+
+	if err != nil {
+		switch {
+		case errors.As(err, &heldErr):
+			app.transferHeldResponse(w, r, heldErr.Review, "settlement is held for review, the amount is reserved until it is reviewed")
+			return
+		case errors.Is(err, data.ErrTransferBlocked):
+			app.transferBlockedResponse(w, r)
+			return
+		case errors.Is(err, data.ErrSettlementExceedsBalance):
+			v.AddError("amount", "must not exceed what you owe or what they are owed")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+			return
+		case errors.Is(err, data.ErrInsuffientBalance):
+			app.insufficientBalanceResponse(w, r)
+			return
+		case errors.Is(err, data.ErrNoAccount):
+			app.accountMissingResponse(w, r)
+			return
+		case errors.Is(err, data.ErrAccountFrozen):
+			app.accountFrozenResponse(w, r)
+			return
+		case errors.Is(err, data.ErrAccountClosed):
+			app.accountClosedResponse(w, r)
+			return
+		case errors.As(err, &limitErr):
+			app.limitExceededResponse(w, r, limitErr)
+			return
+		case errors.Is(err, data.ErrAmountOverflow):
+			app.amountOverflowResponse(w, r)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	data := envelope{
+		"settlement": settlement,
+		"transfer":   transfer,
+	}
+
+	err = app.writeJson(w, http.StatusCreated, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/data"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+)
+
+const maxHoldTTL = 30 * 24 * time.Hour
+
+func (app *application) createHoldHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		PayeeID   int64      `json:"payee_id"`
+		Amount    data.Money `json:"amount"`
+		ExpiresIn string     `json:"expires_in"`
+		MFACode   string     `json:"mfa_code"`
+		PIN       string     `json:"pin"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	ttl := app.cfg.holds.ttl
+
+	if input.ExpiresIn != "" {
+		ttl, err = time.ParseDuration(input.ExpiresIn)
+
+		if err != nil {
+			v.AddError("expires_in", "must be a duration such as 30m or 72h")
+		}
+	}
+
+	v.Check(ttl <= maxHoldTTL, "expires_in", "must not be longer than 720h")
+
+	hold := &data.Hold{
+		UserID:    user.ID,
+		PayeeID:   input.PayeeID,
+		Amount:    input.Amount,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+
+	if data.ValidateHold(v, hold); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.requireVerified(w, r, user) {
+		return
+	}
+
+	if !app.requirePIN(w, r, user, input.PIN) {
+		return
+	}
+
+	if !app.stepUp(w, r, user, hold.Amount, input.MFACode) {
+		return
+	}
+
+	err = app.models.Holds.Insert(hold)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoAccount):
+			app.accountMissingResponse(w, r)
+			return
+		case errors.Is(err, data.ErrAccountFrozen):
+			app.accountFrozenResponse(w, r)
+			return
+		case errors.Is(err, data.ErrAccountClosed):
+			app.accountClosedResponse(w, r)
+			return
+		case errors.Is(err, data.ErrInsuffientBalance):
+			app.insufficientBalanceResponse(w, r)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	data := envelope{
+		"hold": hold,
+	}
+
+	err = app.writeJson(w, http.StatusCreated, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getHoldForUser loads the hold named in the URL when the user is its payer
+// or payee, it writes the error response and returns nil otherwise.
+func (app *application) getHoldForUser(w http.ResponseWriter, r *http.Request, user *data.User) *data.Hold {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	hold, err := app.models.Holds.Get(id)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	if hold.UserID != user.ID && hold.PayeeID != user.ID {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	return hold
+}
+
+func (app *application) showHoldHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	hold := app.getHoldForUser(w, r, user)
+
+	if hold == nil {
+		return
+	}
+
+	err := app.writeJson(w, http.StatusOK, envelope{"hold": hold}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) captureHoldHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Amount *data.Money `json:"amount"`
+	}
+
+	// the body is optional, without one the whole hold is captured
+	if r.ContentLength != 0 {
+		err := app.readJSON(w, r, &input)
+
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	hold := app.getHoldForUser(w, r, user)
+
+	if hold == nil {
+		return
+	}
+
+	if hold.PayeeID != user.ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	// capture the whole hold unless a smaller amount is given
+	amount := hold.Amount
+
+	if input.Amount != nil {
+		amount = *input.Amount
+	}
+
+	v := validator.New()
+
+	data.ValidateMoney(v, "amount", amount)
+	v.Check(amount.Currency == hold.Amount.Currency, "amount", "must be in the currency of the hold")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.requireVerified(w, r, user) {
+		return
+	}
+
+	hold, transfer, err := app.models.Holds.Capture(hold.ID, amount)
+
+	var (
+		limitErr *data.LimitError
+		heldErr  *data.TransferHeldError
+	)
+
+	if err != nil {
+		switch {
+		case errors.As(err, &heldErr):
+			app.transferHeldResponse(w, r, heldErr.Review, "capture is held for review, the hold stays active until it is reviewed")
+			return
+		case errors.Is(err, data.ErrTransferBlocked):
+			app.transferBlockedResponse(w, r)
+			return
+		case errors.Is(err, data.ErrHoldNotActive):
+			app.holdNotActiveResponse(w, r)
+			return
+		case errors.Is(err, data.ErrCaptureExceedsHold):
+			v.AddError("amount", "must not exceed the held amount")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		case errors.Is(err, data.ErrNoAccount):
+			app.accountMissingResponse(w, r)
+			return
+		case errors.Is(err, data.ErrAccountFrozen):
+			app.accountFrozenResponse(w, r)
+			return
+		case errors.Is(err, data.ErrAccountClosed):
+			app.accountClosedResponse(w, r)
+			return
+		case errors.Is(err, data.ErrInsuffientBalance):
+			app.insufficientBalanceResponse(w, r)
+			return
+		case errors.As(err, &limitErr):
+			app.limitExceededResponse(w, r, limitErr)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	data := envelope{
+		"hold":     hold,
+		"transfer": transfer,
+	}
+
+	err = app.writeJson(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// voidHoldHandler lets the payee give up a hold. The payer cannot void it,
+// they could otherwise take back money the payee is relying on, their hold
+// is released when it expires.
+func (app *application) voidHoldHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	hold := app.getHoldForUser(w, r, user)
+
+	if hold == nil {
+		return
+	}
+
+	if hold.PayeeID != user.ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	hold, err := app.models.Holds.Void(hold.ID)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrHoldNotActive):
+			app.holdNotActiveResponse(w, r)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"hold": hold}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) expireHolds() error {
+	count, err := app.models.Holds.ExpireDue()
+
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		app.logger.Info("expired holds", "count", count)
+	}
+
+	return nil
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"flag"
+	"fmt"
 	"log/slog"
 	"os"
 	"strings"
@@ -11,14 +13,25 @@ import (
 	"time"
 
 	"github.com/AdityaVarmaUddaraju/paytm/internal/data"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/fx"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/mailer"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/notify"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/sms"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/tokens"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/webhook"
 	_ "github.com/lib/pq"
 )
 
 type config struct {
-	port         int
-	env          string
-	jwtSecretKey string
-	db           struct {
+	port  int
+	env   string
+	store string
+	jwt   struct {
+		secretKey    string
+		keyFiles     map[string]string
+		signingKeyID string
+	}
+	db struct {
 		dsn          string
 		maxOpenConns int
 		maxIdleConns int
@@ -27,13 +40,59 @@ type config struct {
 	cors struct {
 		trustedOrigins []string
 	}
+	fx struct {
+		ratesFile string
+		spreadBps int
+	}
+	tokens struct {
+		accessTTL  time.Duration
+		refreshTTL time.Duration
+	}
+	holds struct {
+		ttl time.Duration
+	}
+	paymentRequests struct {
+		ttl time.Duration
+	}
+	orders struct {
+		ttl time.Duration
+	}
+	webhooks struct {
+		timeout time.Duration
+	}
+	mfa struct {
+		issuer        string
+		stepUpAmounts map[string]int64
+	}
+	passwordReset struct {
+		ttl time.Duration
+	}
+	mailer string
+	mail   struct {
+		dir    string
+		sender string
+	}
+	smtp struct {
+		host     string
+		port     int
+		username string
+		password string
+		timeout  time.Duration
+	}
+	admins []string
 }
 
 type application struct {
-	cfg    config
-	logger *slog.Logger
-	models data.Models
-	wg     sync.WaitGroup
+	cfg      config
+	logger   *slog.Logger
+	models   data.Models
+	rates    fx.RateProvider
+	keyring  *tokens.Keyring
+	notifier notify.Notifier
+	mailer   mailer.Mailer
+	sms      sms.Sender
+	webhooks *webhook.Sender
+	wg       sync.WaitGroup
 }
 
 func main() {
@@ -41,36 +100,140 @@ func main() {
 
 	flag.IntVar(&cfg.port, "port", 4000, "API server port")
 	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
-	flag.StringVar(&cfg.jwtSecretKey, "jwt-secret-key", "", "JWT secret key")
+	flag.StringVar(&cfg.store, "store", "postgres", "Storage backend (postgres|memory)")
+	flag.StringVar(&cfg.jwt.secretKey, "jwt-secret-key", "", "JWT HS256 secret key, registered with key id \"default\"")
+	flag.StringVar(&cfg.jwt.signingKeyID, "jwt-signing-key-id", tokens.LegacyKeyID, "Key id new tokens are signed with")
+
+	cfg.jwt.keyFiles = make(map[string]string)
+
+	flag.Func("jwt-key", "JWT RSA or Ed25519 PEM key as kid=path (repeatable)", func(s string) error {
+		kid, path, ok := strings.Cut(s, "=")
+
+		if !ok || kid == "" || path == "" {
+			return errors.New("must be in the form kid=path")
+		}
+
+		cfg.jwt.keyFiles[kid] = path
+		return nil
+	})
+
+	flag.DurationVar(&cfg.tokens.accessTTL, "access-token-ttl", 15*time.Minute, "Lifetime of access tokens")
+	flag.DurationVar(&cfg.tokens.refreshTTL, "refresh-token-ttl", 30*24*time.Hour, "Lifetime of refresh tokens")
+	flag.DurationVar(&cfg.holds.ttl, "hold-ttl", 7*24*time.Hour, "Default lifetime of a hold before it expires")
+	flag.DurationVar(&cfg.paymentRequests.ttl, "payment-request-ttl", 7*24*time.Hour, "Default lifetime of a payment request before it expires")
+	flag.DurationVar(&cfg.orders.ttl, "order-ttl", 30*time.Minute, "Default lifetime of an order before it can no longer be paid")
+	flag.DurationVar(&cfg.webhooks.timeout, "webhook-timeout", 10*time.Second, "Time a webhook endpoint has to respond")
+	flag.DurationVar(&cfg.passwordReset.ttl, "password-reset-ttl", 30*time.Minute, "Lifetime of a password reset token")
 	flag.StringVar(&cfg.db.dsn, "db-dsn", "", "PostgreSQL dsn")
 	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
 	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
 	flag.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max idle time")
 
+	flag.StringVar(&cfg.fx.ratesFile, "fx-rates-file", "", "JSON file of exchange rates keyed by currency pair")
+	flag.IntVar(&cfg.fx.spreadBps, "fx-spread-bps", 50, "Spread kept on currency conversions in basis points")
+
 	flag.Func("cors-trusted-origins", "Trusted CORS origins (space seperated)", func(s string) error {
 		cfg.cors.trustedOrigins = strings.Fields(s)
 		return nil
 	})
 
+	flag.StringVar(&cfg.mailer, "mailer", "file", "How emails are sent (smtp|file)")
+	flag.StringVar(&cfg.mail.dir, "mail-dir", "mail", "Directory the file mailer writes emails to")
+	flag.StringVar(&cfg.mail.sender, "mail-sender", "Paytm <no-reply@paytm.local>", "From address of emails")
+	flag.StringVar(&cfg.smtp.host, "smtp-host", "localhost", "SMTP host")
+	flag.IntVar(&cfg.smtp.port, "smtp-port", 25, "SMTP port")
+	flag.StringVar(&cfg.smtp.username, "smtp-username", "", "SMTP username, no authentication when empty")
+	flag.StringVar(&cfg.smtp.password, "smtp-password", "", "SMTP password")
+	flag.DurationVar(&cfg.smtp.timeout, "smtp-timeout", 10*time.Second, "Time an SMTP server has to accept an email")
+
+	flag.StringVar(&cfg.mfa.issuer, "totp-issuer", "Paytm", "Issuer shown by authenticator apps")
+
+	cfg.mfa.stepUpAmounts = map[string]int64{"INR": 2500000, "USD": 50000, "EUR": 50000, "GBP": 40000}
+
+	flag.Func("mfa-step-up-amounts", "Transfers of at least these amounts need a two-factor code, as CURRENCY=amount, every transfer in another currency needs one (space seperated, default INR=25000.00 USD=500.00 EUR=500.00 GBP=400.00)", func(s string) error {
+		amounts := make(map[string]int64)
+
+		for _, field := range strings.Fields(s) {
+			currency, value, _ := strings.Cut(field, "=")
+
+			amount, err := data.ParseMoney(value, currency)
+
+			if err != nil || !amount.IsPositive() {
+				return fmt.Errorf("%q must be a currency and a positive amount like INR=25000.00", field)
+			}
+
+			amounts[currency] = amount.Amount
+		}
+
+		cfg.mfa.stepUpAmounts = amounts
+		return nil
+	})
+
+	flag.Func("admins", "Usernames that hold every admin permission whatever their role (space seperated)", func(s string) error {
+		cfg.admins = strings.Fields(s)
+		return nil
+	})
+
 	flag.Parse()
 
 	jsonLogger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 
-	db, err := openDB(cfg)
+	var models data.Models
+
+	switch cfg.store {
+	case "postgres":
+		db, err := openDB(cfg)
+
+		if err != nil {
+			jsonLogger.Error(err.Error())
+			os.Exit(1)
+		}
+
+		defer db.Close()
+
+		jsonLogger.Info("database connection established")
+
+		models = data.NewModels(db)
+	case "memory":
+		models = data.NewMemoryModels()
+
+		jsonLogger.Warn("using the in-memory store, nothing is persisted, transfers are not screened for risk, and transaction history, holds, scheduled transfers, payment requests, groups, merchants, orders, webhooks and risk reviews are unavailable")
+	default:
+		jsonLogger.Error("store must be postgres or memory")
+		os.Exit(1)
+	}
+
+	rates, err := openRates(cfg)
+
+	if err != nil {
+		jsonLogger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	keyring, err := openKeyring(cfg)
 
 	if err != nil {
 		jsonLogger.Error(err.Error())
 		os.Exit(1)
 	}
 
-	defer db.Close()
+	mail, err := openMailer(cfg)
 
-	jsonLogger.Info("database connection established")
+	if err != nil {
+		jsonLogger.Error(err.Error())
+		os.Exit(1)
+	}
 
 	app := &application{
-		cfg:    cfg,
-		logger: jsonLogger,
-		models: data.NewModels(db),
+		cfg:      cfg,
+		logger:   jsonLogger,
+		models:   models,
+		rates:    rates,
+		keyring:  keyring,
+		notifier: notify.Logger{Logger: jsonLogger},
+		mailer:   mail,
+		sms:      sms.Log{Logger: jsonLogger},
+		webhooks: &webhook.Sender{Client: webhook.NewClient(cfg.webhooks.timeout)},
 	}
 
 	err = app.server()
@@ -110,3 +273,59 @@ func openDB(cfg config) (*sql.DB, error) {
 
 	return db, nil
 }
+
+func openRates(cfg config) (fx.RateProvider, error) {
+	if cfg.fx.ratesFile == "" {
+		return fx.NewStaticProvider(nil)
+	}
+
+	return fx.LoadFile(cfg.fx.ratesFile)
+}
+
+func openMailer(cfg config) (mailer.Mailer, error) {
+	switch cfg.mailer {
+	case "smtp":
+		return &mailer.SMTP{
+			Host:     cfg.smtp.host,
+			Port:     cfg.smtp.port,
+			Username: cfg.smtp.username,
+			Password: cfg.smtp.password,
+			Sender:   cfg.mail.sender,
+			Timeout:  cfg.smtp.timeout,
+		}, nil
+	case "file":
+		return &mailer.File{Dir: cfg.mail.dir, Sender: cfg.mail.sender}, nil
+	default:
+		return nil, errors.New("mailer must be smtp or file")
+	}
+}
+
+// openKeyring loads the JWT keys. To rotate, add the new key with -jwt-key,
+// point -jwt-signing-key-id at it and keep the old key until its tokens expire.
+func openKeyring(cfg config) (*tokens.Keyring, error) {
+	keyring := tokens.NewKeyring()
+
+	if cfg.jwt.secretKey != "" {
+		err := keyring.AddHMAC(tokens.LegacyKeyID, []byte(cfg.jwt.secretKey))
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for kid, path := range cfg.jwt.keyFiles {
+		err := keyring.LoadPEMFile(kid, path)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := keyring.SetSigningKey(cfg.jwt.signingKeyID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return keyring, nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/data"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+)
+
+func (app *application) createMerchantHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Name string `json:"name"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	merchant := &data.Merchant{
+		UserID: user.ID,
+		Name:   input.Name,
+	}
+
+	v := validator.New()
+
+	if data.ValidateMerchant(v, merchant); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Merchants.Insert(merchant)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusCreated, envelope{"merchant": merchant}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listMerchantsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	merchants, err := app.models.Merchants.GetAllForUser(user.ID)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"merchants": merchants}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getMerchantForOwner loads the merchant named in the URL when the user runs
+// it, it writes the error response and returns nil otherwise.
+func (app *application) getMerchantForOwner(w http.ResponseWriter, r *http.Request, user *data.User) *data.Merchant {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	merchant, err := app.models.Merchants.Get(id)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	if merchant.UserID != user.ID {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	return merchant
+}
+
+func (app *application) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	merchant := app.getMerchantForOwner(w, r, user)
+
+	if merchant == nil {
+		return
+	}
+
+	var input struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	key := &data.APIKey{
+		MerchantID: merchant.ID,
+		Name:       input.Name,
+		Scopes:     input.Scopes,
+	}
+
+	v := validator.New()
+
+	if data.ValidateAPIKey(v, key); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	plaintext, err := app.models.Merchants.NewAPIKey(key)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{
+		Action:     data.AuditAPIKeyCreate,
+		TargetType: "api_key",
+		TargetID:   strconv.FormatInt(key.ID, 10),
+		After:      key,
+	})
+
+	// the plaintext is only ever shown here
+	data := envelope{
+		"api_key": key,
+		"key":     plaintext,
+	}
+
+	err = app.writeJson(w, http.StatusCreated, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	merchant := app.getMerchantForOwner(w, r, user)
+
+	if merchant == nil {
+		return
+	}
+
+	keys, err := app.models.Merchants.GetAPIKeys(merchant.ID)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"api_keys": keys}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	merchant := app.getMerchantForOwner(w, r, user)
+
+	if merchant == nil {
+		return
+	}
+
+	keyID, err := app.readInt64Param(r, "key_id")
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	key, err := app.models.Merchants.RevokeAPIKey(merchant.ID, keyID)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{
+		Action:     data.AuditAPIKeyRevoke,
+		TargetType: "api_key",
+		TargetID:   strconv.FormatInt(key.ID, 10),
+		After:      key,
+	})
+
+	err = app.writeJson(w, http.StatusOK, envelope{"api_key": key}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/data"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/tokens"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/totp"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+)
+
+// mfaTokenTTL is how long a user whose password was right has to give their
+// second factor.
+const mfaTokenTTL = 5 * time.Minute
+
+// readMFACode reads the code a request proves the second factor with, it
+// writes the error response and returns false when the body is invalid.
+func (app *application) readMFACode(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return "", false
+	}
+
+	v := validator.New()
+
+	v.ValidateEmpty(input.Code, "code")
+	v.Check(len(input.Code) <= 64, "code", "must not be more than 64 bytes long")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return "", false
+	}
+
+	return input.Code, true
+}
+
+// enrollTOTPHandler starts enrollment, the user adds the secret to their
+// authenticator and confirms it with a code before it is used.
+func (app *application) enrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	t, err := app.models.MFA.Enroll(user.ID)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrMFAEnabled):
+			app.mfaEnabledResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"secret":           t.Secret,
+		"provisioning_uri": totp.ProvisioningURI(t.Secret, app.cfg.mfa.issuer, user.UserName),
+	}
+
+	err = app.writeJson(w, http.StatusCreated, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) confirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	code, ok := app.readMFACode(w, r)
+
+	if !ok {
+		return
+	}
+
+	recoveryCodes, err := app.models.MFA.Confirm(user.ID, code)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrMFAEnabled):
+			app.mfaEnabledResponse(w, r)
+		case errors.Is(err, data.ErrInvalidMFACode):
+			app.invalidMFACodeResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{
+		Action:     data.AuditMFAEnable,
+		TargetType: "user",
+		TargetID:   strconv.FormatInt(user.ID, 10),
+	})
+
+	data := envelope{
+		"message":        "two-factor authentication enabled, keep the recovery codes somewhere safe",
+		"recovery_codes": recoveryCodes,
+	}
+
+	err = app.writeJson(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// disableTOTPHandler turns two-factor authentication off, which takes a code
+// so that a stolen session alone cannot do it.
+func (app *application) disableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	code, ok := app.readMFACode(w, r)
+
+	if !ok {
+		return
+	}
+
+	err := app.verifyMFA(r, user, code)
+
+	if err == nil {
+		err = app.models.MFA.Disable(user.ID)
+	}
+
+	var throttledErr *data.ThrottledError
+
+	if err != nil {
+		switch {
+		case errors.As(err, &throttledErr):
+			app.mfaThrottledResponse(w, r, throttledErr)
+		case errors.Is(err, data.ErrMFANotEnabled):
+			app.mfaNotEnabledResponse(w, r)
+		case errors.Is(err, data.ErrInvalidMFACode):
+			app.invalidMFACodeResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{
+		Action:     data.AuditMFADisable,
+		TargetType: "user",
+		TargetID:   strconv.FormatInt(user.ID, 10),
+	})
+
+	data := envelope{
+		"message": "two-factor authentication disabled",
+	}
+
+	err = app.writeJson(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// userSignInMFAHandler finishes a sign-in userSignInHandler started for a
+// user with two-factor authentication, exchanging the mfa token and a code
+// for a session.
+func (app *application) userSignInMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		MFAToken string `json:"mfa_token"`
+		Code     string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.ValidateEmpty(input.MFAToken, "mfa_token")
+	v.ValidateEmpty(input.Code, "code")
+	v.Check(len(input.Code) <= 64, "code", "must not be more than 64 bytes long")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	claims, err := tokens.VerifyMFAToken(input.MFAToken, app.keyring)
+
+	if err != nil {
+		app.invalidJWTTokenResponse(w, r, err.Error())
+		return
+	}
+
+	user, err := app.models.Users.GetByUsername(claims.Username)
+
+	if err != nil {
+		app.invalidJWTTokenResponse(w, r, err.Error())
+		return
+	}
+
+	// wrong codes count against the username like wrong passwords do
+	if !app.checkSignIn(w, r, user.UserName) {
+		return
+	}
+
+	err = app.models.MFA.Verify(user.ID, input.Code)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidMFACode), errors.Is(err, data.ErrMFANotEnabled):
+			app.failSignIn(r, user.UserName)
+			app.audit(r, &data.AuditEvent{
+				ActorID:    &user.ID,
+				Action:     data.AuditMFAFailed,
+				TargetType: "user",
+				TargetID:   strconv.FormatInt(user.ID, 10),
+				After:      map[string]string{"stage": "sign_in"},
+			})
+			app.invalidMFACodeResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	tokens, err := app.issueTokens(user)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.signedIn(r, user.UserName)
+
+	app.audit(r, &data.AuditEvent{
+		ActorID:    &user.ID,
+		Action:     data.AuditSignIn,
+		TargetType: "user",
+		TargetID:   strconv.FormatInt(user.ID, 10),
+		After:      map[string]bool{"mfa": true},
+	})
+
+	err = app.writeJson(w, http.StatusOK, tokens, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// verifyMFA checks a two-factor code sent by a user who is already signed in.
+// Wrong codes count against the user, so that a stolen session cannot keep
+// guessing them, and a throttled user gets a ThrottledError without the code
+// being checked.
+func (app *application) verifyMFA(r *http.Request, user *data.User, code string) error {
+	key := data.MFAThrottleKey(user.ID)
+
+	err := app.models.Throttles.Check(key)
+
+	if err != nil {
+		return err
+	}
+
+	err = app.models.MFA.Verify(user.ID, code)
+
+	switch {
+	case err == nil:
+		if err := app.models.Throttles.Reset(key); err != nil {
+			app.logError(r, err)
+		}
+	case errors.Is(err, data.ErrInvalidMFACode):
+		if err := app.models.Throttles.Fail(key, data.MFAPolicy); err != nil {
+			app.logError(r, err)
+		}
+	}
+
+	return err
+}
+
+// stepUp asks for a second factor on a transfer of at least the step-up
+// amount of its currency, and on every transfer in a currency without one. It
+// writes the error response and returns false unless the transfer may go
+// ahead.
+func (app *application) stepUp(w http.ResponseWriter, r *http.Request, user *data.User, amount data.Money, code string) bool {
+	threshold, ok := app.cfg.mfa.stepUpAmounts[amount.Currency]
+
+	if ok && amount.Amount < threshold {
+		return true
+	}
+
+	enabled, err := app.models.MFA.Enabled(user.ID)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	switch {
+	case !enabled:
+		app.authorizationRequiredResponse(w, r, "mfa_not_enabled", "enable two-factor authentication to make transfers of this size")
+		return false
+	case code == "":
+		app.authorizationRequiredResponse(w, r, "mfa_required", "send a two-factor code as mfa_code to make transfers of this size")
+		return false
+	}
+
+	err = app.verifyMFA(r, user, code)
+
+	var throttledErr *data.ThrottledError
+
+	if err != nil {
+		switch {
+		case errors.As(err, &throttledErr):
+			app.mfaThrottledResponse(w, r, throttledErr)
+		case errors.Is(err, data.ErrInvalidMFACode), errors.Is(err, data.ErrMFANotEnabled):
+			app.audit(r, &data.AuditEvent{
+				Action:     data.AuditMFAFailed,
+				TargetType: "user",
+				TargetID:   strconv.FormatInt(user.ID, 10),
+				After:      map[string]string{"stage": "step_up"},
+			})
+			app.invalidMFACodeResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return false
+	}
+
+	return true
+}
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"slices"
 	"strings"
 
+	"github.com/AdityaVarmaUddaraju/paytm/internal/data"
 	"github.com/AdityaVarmaUddaraju/paytm/internal/tokens"
 )
 
@@ -23,6 +30,11 @@ func (app *application) authenticate(next http.HandlerFunc) http.HandlerFunc {
 		}
 
 		authParts := strings.Split(authenticationHeader, " ")
+		if len(authParts) == 2 && authParts[0] == "ApiKey" {
+			app.authenticateAPIKey(w, r, authParts[1], next)
+			return
+		}
+
 		if len(authParts) != 2 || authParts[0] != "Bearer" {
 			app.invalidJWTTokenResponse(w, r, authenticationHeader)
 			return
@@ -30,7 +42,7 @@ func (app *application) authenticate(next http.HandlerFunc) http.HandlerFunc {
 		// verify jwt token in authentication header
 		token := authParts[1]
 
-		username, err := tokens.VerifyToken(token, app.cfg.jwtSecretKey)
+		claims, err := tokens.VerifyToken(token, app.keyring)
 
 		if err != nil {
 			switch {
@@ -45,20 +57,216 @@ func (app *application) authenticate(next http.HandlerFunc) http.HandlerFunc {
 		}
 
 		// get the user from username in jwt
-		user, err := app.models.Users.GetByUsername(username)
+		user, err := app.models.Users.GetByUsername(claims.Username)
 
 		if err != nil {
 			app.invalidJWTTokenResponse(w, r, err.Error())
 			return
 		}
+
+		// reject tokens from sessions that were signed out or revoked
+		active, err := app.models.Sessions.IsActive(claims.SessionID, user.ID)
+
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !active {
+			app.invalidJWTTokenResponse(w, r, "session has been revoked")
+			return
+		}
+
 		// set the user to request context
 		r = app.contextSetUser(r, user)
+		r = app.contextSetSessionID(r, claims.SessionID)
 
 		next.ServeHTTP(w, r)
 
 	})
 }
 
+// authenticateAPIKey serves requests from merchants. A key is only accepted
+// on routes wrapped by acceptAPIKey and only when it has the scope the route
+// asks for. The merchant's user becomes the user of the request.
+func (app *application) authenticateAPIKey(w http.ResponseWriter, r *http.Request, plaintext string, next http.HandlerFunc) {
+	scope := app.contextGetAPIKeyScope(r)
+
+	if scope == "" {
+		app.invalidAPIKeyResponse(w, r, "api keys cannot be used on this endpoint")
+		return
+	}
+
+	key, merchant, err := app.models.Merchants.Authenticate(plaintext)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidAPIKey):
+			app.invalidAPIKeyResponse(w, r, err.Error())
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !key.HasScope(scope) {
+		app.missingScopeResponse(w, r, scope)
+		return
+	}
+
+	user, err := app.models.Users.GetByID(merchant.UserID)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	r = app.contextSetUser(r, user)
+	r = app.contextSetAPIKey(r, key, merchant)
+
+	next.ServeHTTP(w, r)
+}
+
+// acceptAPIKey lets authenticate accept API keys with scope on the route it
+// wraps, other routes only accept tokens from signed in users.
+func (app *application) acceptAPIKey(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, app.contextSetAPIKeyScope(r, scope))
+	})
+}
+
+// requirePermission only lets users holding the permission code through. It
+// runs after authenticate and never lets merchant API keys through.
+func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if app.contextGetMerchant(r) != nil || !app.userPermissions(user).Include(code) {
+			app.permissionRequiredResponse(w, r, code)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// userPermissions returns the permissions of user, the admins named in the
+// configuration hold every permission whatever their role.
+func (app *application) userPermissions(user *data.User) data.Permissions {
+	if slices.Contains(app.cfg.admins, user.UserName) {
+		return data.PermissionsForRole(data.RoleAdmin)
+	}
+
+	return user.Permissions()
+}
+
+// responseRecorder keeps a copy of what a handler writes so it can be stored
+// and replayed later.
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(statusCode int) {
+	rec.statusCode = statusCode
+	rec.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.statusCode == 0 {
+		rec.statusCode = http.StatusOK
+	}
+
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// idempotent honors the Idempotency-Key header. The first response for a key
+// is stored, retries with the same request get that response back and reusing
+// the key for a different request is rejected. Must be wrapped by authenticate.
+func (app *application) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > 255 {
+			app.badRequestResponse(w, r, errors.New("Idempotency-Key must not be longer than 255 characters"))
+			return
+		}
+
+		user := app.contextGetUser(r)
+
+		maxBytes := 1_048_576
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(maxBytes)))
+
+		if err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("body must not be larger than %d bytes", maxBytes))
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.New()
+		fmt.Fprintf(hash, "%s\n%s\n", r.Method, r.URL.Path)
+		hash.Write(body)
+
+		stored, err := app.models.Idempotency.Begin(user.ID, key, hash.Sum(nil))
+
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrIdempotencyKeyMismatch):
+				app.idempotencyKeyMismatchResponse(w, r)
+			case errors.Is(err, data.ErrIdempotencyKeyInUse):
+				app.idempotencyKeyInUseResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if stored != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(stored.StatusCode)
+			w.Write(stored.Body)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w}
+
+		// release the key if the handler panics so the client can retry
+		defer func() {
+			if rec.statusCode == 0 || rec.statusCode >= http.StatusInternalServerError {
+				err := app.models.Idempotency.Release(user.ID, key)
+
+				if err != nil {
+					app.logError(r, err)
+				}
+			}
+		}()
+
+		next.ServeHTTP(rec, r)
+
+		if rec.statusCode == 0 || rec.statusCode >= http.StatusInternalServerError {
+			return
+		}
+
+		err = app.models.Idempotency.Complete(user.ID, key, &data.IdempotentResponse{
+			StatusCode: rec.statusCode,
+			Body:       rec.body.Bytes(),
+		})
+
+		if err != nil {
+			app.logError(r, err)
+		}
+	})
+}
+
 func (app *application) enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
@@ -73,7 +281,7 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 
 					if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
 						w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Idempotency-Key, X-Request-Id")
 
 						w.WriteHeader(http.StatusOK)
 						return
@@ -88,6 +296,44 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 	})
 }
 
+// requestID gives every request an id, the caller's X-Request-Id when it is
+// well formed or a random one, and echoes it in the response so that logs
+// and audit events can be matched with the request.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-Id")
+
+		if !validRequestID(requestID) {
+			b := make([]byte, 16)
+
+			if _, err := rand.Read(b); err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			requestID = hex.EncodeToString(b)
+		}
+
+		w.Header().Set("X-Request-Id", requestID)
+
+		next.ServeHTTP(w, app.contextSetRequestID(r, requestID))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
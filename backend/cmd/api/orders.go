@@ -0,0 +1,305 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/data"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+)
+
+const maxOrderTTL = 24 * time.Hour
+
+func (app *application) createOrderHandler(w http.ResponseWriter, r *http.Request) {
+	merchant := app.contextGetMerchant(r)
+
+	if merchant == nil {
+		app.invalidAPIKeyResponse(w, r, "orders are created with a merchant api key")
+		return
+	}
+
+	var input struct {
+		Amount            data.Money `json:"amount"`
+		Description       string     `json:"description"`
+		MerchantReference *string    `json:"merchant_reference"`
+		ExpiresIn         string     `json:"expires_in"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	ttl := app.cfg.orders.ttl
+
+	if input.ExpiresIn != "" {
+		ttl, err = time.ParseDuration(input.ExpiresIn)
+
+		if err != nil {
+			v.AddError("expires_in", "must be a duration such as 30m or 2h")
+		}
+	}
+
+	v.Check(ttl <= maxOrderTTL, "expires_in", "must not be longer than 24h")
+
+	order := &data.Order{
+		MerchantID:        merchant.ID,
+		Amount:            input.Amount,
+		Description:       input.Description,
+		MerchantReference: input.MerchantReference,
+		ExpiresAt:         time.Now().Add(ttl),
+	}
+
+	if data.ValidateOrder(v, order); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Orders.Insert(order)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateOrderReference):
+			v.AddError("merchant_reference", "is already used by another order")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeJson(w, http.StatusCreated, envelope{"order": order}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	merchant := app.contextGetMerchant(r)
+
+	if merchant == nil {
+		app.invalidAPIKeyResponse(w, r, "orders are listed with a merchant api key")
+		return
+	}
+
+	status := app.readString(r.URL.Query(), "status", "")
+
+	v := validator.New()
+
+	statuses := []string{"", data.OrderPending, data.OrderPaid, data.OrderCancelled, data.OrderExpired}
+
+	if v.Check(validator.PermittedValue(status, statuses...), "status", "is not an order status"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	orders, err := app.models.Orders.GetAllForMerchant(merchant.ID, status)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"orders": orders}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getOrderForCaller loads the order named in the URL. Merchants see their own
+// orders, users see orders they can pay or have paid and the orders of the
+// merchants they run. It writes the error response and returns nil otherwise.
+func (app *application) getOrderForCaller(w http.ResponseWriter, r *http.Request) *data.Order {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	order, err := app.models.Orders.Get(id)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	user := app.contextGetUser(r)
+
+	var visible bool
+
+	if merchant := app.contextGetMerchant(r); merchant != nil {
+		visible = order.MerchantID == merchant.ID
+	} else {
+		visible = order.Status == data.OrderPending ||
+			order.MerchantUserID == user.ID ||
+			(order.CustomerID != nil && *order.CustomerID == user.ID)
+	}
+
+	if !visible {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	return order
+}
+
+func (app *application) showOrderHandler(w http.ResponseWriter, r *http.Request) {
+	order := app.getOrderForCaller(w, r)
+
+	if order == nil {
+		return
+	}
+
+	err := app.writeJson(w, http.StatusOK, envelope{"order": order}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) payOrderHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		MFACode string `json:"mfa_code"`
+		PIN     string `json:"pin"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	order := app.getOrderForCaller(w, r)
+
+	if order == nil {
+		return
+	}
+
+	if order.MerchantUserID == user.ID {
+		app.badRequestResponse(w, r, errors.New("merchants cannot pay their own orders"))
+		return
+	}
+
+	if !app.requireVerified(w, r, user) {
+		return
+	}
+
+	if !app.requirePIN(w, r, user, input.PIN) {
+		return
+	}
+
+	if !app.stepUp(w, r, user, order.Amount, input.MFACode) {
+		return
+	}
+
+	order, transfer, err := app.models.Orders.Pay(order.ID, user.ID)
+
+	var (
+		limitErr *data.LimitError
+		heldErr  *data.TransferHeldError
+	)
+
+	if err != nil {
+		switch {
+		case errors.As(err, &heldErr):
+			app.transferHeldResponse(w, r, heldErr.Review, "payment is held for review, the amount is reserved until it is reviewed")
+			return
+		case errors.Is(err, data.ErrTransferBlocked):
+			app.transferBlockedResponse(w, r)
+			return
+		case errors.Is(err, data.ErrOrderNotPending):
+			app.orderNotPendingResponse(w, r)
+			return
+		case errors.Is(err, data.ErrInsuffientBalance):
+			app.insufficientBalanceResponse(w, r)
+			return
+		case errors.Is(err, data.ErrNoAccount):
+			app.accountMissingResponse(w, r)
+			return
+		case errors.Is(err, data.ErrAccountFrozen):
+			app.accountFrozenResponse(w, r)
+			return
+		case errors.Is(err, data.ErrAccountClosed):
+			app.accountClosedResponse(w, r)
+			return
+		case errors.As(err, &limitErr):
+			app.limitExceededResponse(w, r, limitErr)
+			return
+		case errors.Is(err, data.ErrAmountOverflow):
+			app.amountOverflowResponse(w, r)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	data := envelope{
+		"order":    order,
+		"transfer": transfer,
+	}
+
+	err = app.writeJson(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) cancelOrderHandler(w http.ResponseWriter, r *http.Request) {
+	if app.contextGetMerchant(r) == nil {
+		app.invalidAPIKeyResponse(w, r, "orders are cancelled with a merchant api key")
+		return
+	}
+
+	order := app.getOrderForCaller(w, r)
+
+	if order == nil {
+		return
+	}
+
+	order, err := app.models.Orders.Cancel(order.ID)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrOrderNotPending):
+			app.orderNotPendingResponse(w, r)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"order": order}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) expireOrders() error {
+	count, err := app.models.Orders.ExpireDue()
+
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		app.logger.Info("expired orders", "count", count)
+	}
+
+	return nil
+}
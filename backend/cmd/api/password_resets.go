@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/data"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// requestPasswordResetHandler mails a password reset token to the user with
+// the email, as long as they verified it. The response is the same whether or
+// not a token is sent, so that it cannot be used to find out who has an
+// account.
+func (app *application) requestPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	input.Email = normalizeEmail(input.Email)
+
+	v := validator.New()
+
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+
+	switch {
+	// an unverified email may belong to someone else, who must not get a
+	// token to take over the account
+	case err == nil && user.EmailVerifiedAt == nil:
+	case err == nil:
+		token, err := app.models.PasswordResets.New(user.ID, app.cfg.passwordReset.ttl)
+
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.audit(r, &data.AuditEvent{
+			ActorID:    &user.ID,
+			Action:     data.AuditPasswordResetRequest,
+			TargetType: "user",
+			TargetID:   strconv.FormatInt(user.ID, 10),
+		})
+
+		app.background(func() {
+			data := map[string]any{
+				"firstName": user.FirstName,
+				"username":  user.UserName,
+				"token":     token.Plaintext,
+				"expiry":    token.Expiry.Format(time.RFC1123),
+			}
+
+			err := app.mailer.Send(user.Email, "password_reset.tmpl", data)
+
+			if err != nil {
+				app.logger.Error(err.Error(), "user_id", user.ID)
+			}
+		})
+	case !errors.Is(err, data.ErrRecordNotFound):
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"message": "if an account has that email and it is verified, a password reset token has been sent to it",
+	}
+
+	err = app.writeJson(w, http.StatusAccepted, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updatePasswordHandler sets a new password with a reset token, signing the
+// user out everywhere.
+func (app *application) updatePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.ValidateEmpty(input.Token, "token")
+	v.Check(len(input.Token) <= 64, "token", "must not be more than 64 bytes long")
+	data.ValidatePassword(v, input.Password)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	userID, err := app.models.PasswordResets.Reset(input.Token, input.Password)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidResetToken):
+			v.AddError("token", "invalid or expired password reset token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.models.Users.GetByID(userID)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Sessions.RevokeAllForUser(user.ID)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// whoever got the mail owns the account, a lockout from someone else
+	// guessing the old password should not keep them out
+	app.signedIn(r, user.UserName)
+
+	app.audit(r, &data.AuditEvent{
+		ActorID:    &user.ID,
+		Action:     data.AuditPasswordReset,
+		TargetType: "user",
+		TargetID:   strconv.FormatInt(user.ID, 10),
+		After:      map[string]string{"method": "email"},
+	})
+
+	data := envelope{
+		"message": "password reset, you have been signed out everywhere",
+	}
+
+	err = app.writeJson(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// putUserHandler serves PUT /v1/users/password as well as PUT
+// /v1/users/:id, httprouter cannot have both routes.
+func (app *application) putUserHandler(w http.ResponseWriter, r *http.Request) {
+	if httprouter.ParamsFromContext(r.Context()).ByName("id") == "password" {
+		app.updatePasswordHandler(w, r)
+		return
+	}
+
+	app.authenticate(app.updateUserHandler)(w, r)
+}
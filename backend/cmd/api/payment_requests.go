@@ -0,0 +1,356 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/data"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/notify"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+)
+
+const maxPaymentRequestTTL = 30 * 24 * time.Hour
+
+// Events sent about payment requests, the payer hears about new and
+// cancelled requests and the requester about the answer.
+const (
+	eventPaymentRequestCreated   = "payment_request.created"
+	eventPaymentRequestAccepted  = "payment_request.accepted"
+	eventPaymentRequestDeclined  = "payment_request.declined"
+	eventPaymentRequestCancelled = "payment_request.cancelled"
+	eventPaymentRequestExpired   = "payment_request.expired"
+)
+
+func (app *application) createPaymentRequestHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		PayerID   int64      `json:"payer_id"`
+		Amount    data.Money `json:"amount"`
+		Note      string     `json:"note"`
+		ExpiresIn string     `json:"expires_in"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	ttl := app.cfg.paymentRequests.ttl
+
+	if input.ExpiresIn != "" {
+		ttl, err = time.ParseDuration(input.ExpiresIn)
+
+		if err != nil {
+			v.AddError("expires_in", "must be a duration such as 30m or 72h")
+		}
+	}
+
+	v.Check(ttl <= maxPaymentRequestTTL, "expires_in", "must not be longer than 720h")
+
+	pr := &data.PaymentRequest{
+		RequesterID: user.ID,
+		PayerID:     input.PayerID,
+		Amount:      input.Amount,
+		Note:        input.Note,
+		ExpiresAt:   time.Now().Add(ttl),
+	}
+
+	if data.ValidatePaymentRequest(v, pr); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.Users.GetByID(pr.PayerID)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("payer_id", "does not exist")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.PaymentRequests.Insert(pr)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.notifier.Notify(notify.New(eventPaymentRequestCreated, pr.PayerID, pr))
+
+	data := envelope{
+		"payment_request": pr,
+	}
+
+	err = app.writeJson(w, http.StatusCreated, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listPaymentRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	qs := r.URL.Query()
+
+	direction := app.readString(qs, "direction", data.PaymentRequestsIncoming)
+	status := app.readString(qs, "status", "")
+
+	v := validator.New()
+
+	v.Check(validator.PermittedValue(direction, data.PaymentRequestsIncoming, data.PaymentRequestsOutgoing), "direction", "must be incoming or outgoing")
+
+	statuses := []string{
+		"",
+		data.PaymentRequestPending,
+		data.PaymentRequestAccepted,
+		data.PaymentRequestDeclined,
+		data.PaymentRequestCancelled,
+		data.PaymentRequestExpired,
+	}
+
+	v.Check(validator.PermittedValue(status, statuses...), "status", "is not a payment request status")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	requests, err := app.models.PaymentRequests.GetAllForUser(user.ID, direction, status)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"payment_requests": requests}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getPaymentRequestForUser loads the payment request named in the URL when
+// the user is its requester or payer, it writes the error response and
+// returns nil otherwise.
+func (app *application) getPaymentRequestForUser(w http.ResponseWriter, r *http.Request, user *data.User) *data.PaymentRequest {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	pr, err := app.models.PaymentRequests.Get(id)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	if pr.RequesterID != user.ID && pr.PayerID != user.ID {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	return pr
+}
+
+func (app *application) showPaymentRequestHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	pr := app.getPaymentRequestForUser(w, r, user)
+
+	if pr == nil {
+		return
+	}
+
+	err := app.writeJson(w, http.StatusOK, envelope{"payment_request": pr}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) acceptPaymentRequestHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		MFACode string `json:"mfa_code"`
+		PIN     string `json:"pin"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	pr := app.getPaymentRequestForUser(w, r, user)
+
+	if pr == nil {
+		return
+	}
+
+	if pr.PayerID != user.ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	if !app.requireVerified(w, r, user) {
+		return
+	}
+
+	if !app.requirePIN(w, r, user, input.PIN) {
+		return
+	}
+
+	if !app.stepUp(w, r, user, pr.Amount, input.MFACode) {
+		return
+	}
+
+	pr, transfer, err := app.models.PaymentRequests.Accept(pr.ID)
+
+	var (
+		limitErr *data.LimitError
+		heldErr  *data.TransferHeldError
+	)
+
+	if err != nil {
+		switch {
+		case errors.As(err, &heldErr):
+			app.transferHeldResponse(w, r, heldErr.Review, "payment is held for review, the amount is reserved until it is reviewed")
+			return
+		case errors.Is(err, data.ErrTransferBlocked):
+			app.transferBlockedResponse(w, r)
+			return
+		case errors.Is(err, data.ErrRequestNotPending):
+			app.requestNotPendingResponse(w, r)
+			return
+		case errors.Is(err, data.ErrInsuffientBalance):
+			app.insufficientBalanceResponse(w, r)
+			return
+		case errors.Is(err, data.ErrNoAccount):
+			app.accountMissingResponse(w, r)
+			return
+		case errors.Is(err, data.ErrAccountFrozen):
+			app.accountFrozenResponse(w, r)
+			return
+		case errors.Is(err, data.ErrAccountClosed):
+			app.accountClosedResponse(w, r)
+			return
+		case errors.As(err, &limitErr):
+			app.limitExceededResponse(w, r, limitErr)
+			return
+		case errors.Is(err, data.ErrAmountOverflow):
+			app.amountOverflowResponse(w, r)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	app.notifier.Notify(notify.New(eventPaymentRequestAccepted, pr.RequesterID, pr))
+
+	data := envelope{
+		"payment_request": pr,
+		"transfer":        transfer,
+	}
+
+	err = app.writeJson(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) declinePaymentRequestHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	pr := app.getPaymentRequestForUser(w, r, user)
+
+	if pr == nil {
+		return
+	}
+
+	if pr.PayerID != user.ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	app.answerPaymentRequest(w, r, pr, app.models.PaymentRequests.Decline, eventPaymentRequestDeclined, pr.RequesterID)
+}
+
+func (app *application) cancelPaymentRequestHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	pr := app.getPaymentRequestForUser(w, r, user)
+
+	if pr == nil {
+		return
+	}
+
+	if pr.RequesterID != user.ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	app.answerPaymentRequest(w, r, pr, app.models.PaymentRequests.Cancel, eventPaymentRequestCancelled, pr.PayerID)
+}
+
+// answerPaymentRequest declines or cancels pr with answer and tells the other
+// party.
+func (app *application) answerPaymentRequest(w http.ResponseWriter, r *http.Request, pr *data.PaymentRequest, answer func(int64) (*data.PaymentRequest, error), event string, notifyUserID int64) {
+	pr, err := answer(pr.ID)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRequestNotPending):
+			app.requestNotPendingResponse(w, r)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	app.notifier.Notify(notify.New(event, notifyUserID, pr))
+
+	err = app.writeJson(w, http.StatusOK, envelope{"payment_request": pr}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) expirePaymentRequests() error {
+	expired, err := app.models.PaymentRequests.ExpireDue()
+
+	if err != nil {
+		return err
+	}
+
+	for _, pr := range expired {
+		app.notifier.Notify(notify.New(eventPaymentRequestExpired, pr.RequesterID, pr))
+		app.notifier.Notify(notify.New(eventPaymentRequestExpired, pr.PayerID, pr))
+	}
+
+	if len(expired) > 0 {
+		app.logger.Info("expired payment requests", "count", len(expired))
+	}
+
+	return nil
+}
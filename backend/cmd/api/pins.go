@@ -0,0 +1,305 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/data"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+)
+
+// checkPassword writes the error response and returns false unless password
+// is the user's. Wrong passwords count against the same throttle as sign-in,
+// a stolen session must not give unlimited guesses.
+func (app *application) checkPassword(w http.ResponseWriter, r *http.Request, user *data.User, password string) bool {
+	if !app.checkSignIn(w, r, user.UserName) {
+		return false
+	}
+
+	match, err := user.Password.Match(password)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	if !match {
+		app.failSignIn(r, user.UserName)
+		app.audit(r, &data.AuditEvent{
+			Action:     data.AuditSignInFailed,
+			TargetType: "user",
+			TargetID:   strconv.FormatInt(user.ID, 10),
+			After:      map[string]string{"username": user.UserName, "reason": "wrong password"},
+		})
+		app.invalidCreditialsResponse(w, r)
+		return false
+	}
+
+	app.signedIn(r, user.UserName)
+
+	return true
+}
+
+// setPINHandler sets the user's first transaction PIN, which takes their
+// password.
+func (app *application) setPINHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		PIN      string `json:"pin"`
+		Password string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidatePIN(v, "pin", input.PIN)
+	v.ValidateEmpty(input.Password, "password")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.checkPassword(w, r, user, input.Password) {
+		return
+	}
+
+	err = app.models.PINs.Insert(user.ID, input.PIN)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrPINExists):
+			app.pinExistsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{
+		Action:     data.AuditPINSet,
+		TargetType: "user",
+		TargetID:   strconv.FormatInt(user.ID, 10),
+	})
+
+	data := envelope{
+		"message": "transaction PIN set",
+	}
+
+	err = app.writeJson(w, http.StatusCreated, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// changePINHandler replaces the PIN of a user who knows the current one.
+func (app *application) changePINHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		CurrentPIN string `json:"current_pin"`
+		PIN        string `json:"pin"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.ValidateEmpty(input.CurrentPIN, "current_pin")
+	data.ValidatePIN(v, "pin", input.PIN)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.requirePIN(w, r, user, input.CurrentPIN) {
+		return
+	}
+
+	err = app.models.PINs.Update(user.ID, input.PIN)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrPINNotSet):
+			app.pinNotSetResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{
+		Action:     data.AuditPINChange,
+		TargetType: "user",
+		TargetID:   strconv.FormatInt(user.ID, 10),
+	})
+
+	data := envelope{
+		"message": "transaction PIN changed",
+	}
+
+	err = app.writeJson(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// resetPINHandler replaces a forgotten or locked PIN. It takes the user's
+// password and, when they have two-factor authentication, a code as well.
+func (app *application) resetPINHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		PIN      string `json:"pin"`
+		Password string `json:"password"`
+		MFACode  string `json:"mfa_code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidatePIN(v, "pin", input.PIN)
+	v.ValidateEmpty(input.Password, "password")
+	v.Check(len(input.MFACode) <= 64, "mfa_code", "must not be more than 64 bytes long")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.checkPassword(w, r, user, input.Password) {
+		return
+	}
+
+	mfa, err := app.models.MFA.Enabled(user.ID)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if mfa {
+		if input.MFACode == "" {
+			app.authorizationRequiredResponse(w, r, "mfa_required", "send a two-factor code as mfa_code to reset the transaction PIN")
+			return
+		}
+
+		err = app.verifyMFA(r, user, input.MFACode)
+
+		var throttledErr *data.ThrottledError
+
+		if err != nil {
+			switch {
+			case errors.As(err, &throttledErr):
+				app.mfaThrottledResponse(w, r, throttledErr)
+			case errors.Is(err, data.ErrInvalidMFACode), errors.Is(err, data.ErrMFANotEnabled):
+				app.audit(r, &data.AuditEvent{
+					Action:     data.AuditMFAFailed,
+					TargetType: "user",
+					TargetID:   strconv.FormatInt(user.ID, 10),
+					After:      map[string]string{"stage": "pin_reset"},
+				})
+				app.invalidMFACodeResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	err = app.models.PINs.Update(user.ID, input.PIN)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrPINNotSet):
+			app.pinNotSetResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{
+		Action:     data.AuditPINReset,
+		TargetType: "user",
+		TargetID:   strconv.FormatInt(user.ID, 10),
+	})
+
+	data := envelope{
+		"message": "transaction PIN reset",
+	}
+
+	err = app.writeJson(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// requirePIN checks the transaction PIN a request that moves money came with.
+// It writes the error response and returns false unless the PIN is right.
+func (app *application) requirePIN(w http.ResponseWriter, r *http.Request, user *data.User, pin string) bool {
+	if pin == "" {
+		app.authorizationRequiredResponse(w, r, "pin_required", "send the transaction PIN as pin")
+		return false
+	}
+
+	err := app.models.PINs.Verify(user.ID, pin)
+
+	if err != nil {
+		var lockedErr *data.PINLockedError
+
+		switch {
+		case errors.Is(err, data.ErrPINNotSet):
+			app.authorizationRequiredResponse(w, r, "pin_not_set", "set a transaction PIN to move money")
+		case errors.Is(err, data.ErrInvalidPIN):
+			app.audit(r, &data.AuditEvent{
+				Action:     data.AuditPINFailed,
+				TargetType: "user",
+				TargetID:   strconv.FormatInt(user.ID, 10),
+			})
+			app.invalidPINResponse(w, r)
+		case errors.As(err, &lockedErr):
+			app.audit(r, &data.AuditEvent{
+				Action:     data.AuditPINFailed,
+				TargetType: "user",
+				TargetID:   strconv.FormatInt(user.ID, 10),
+				After:      map[string]string{"locked_until": lockedErr.Until.Format(time.RFC3339)},
+			})
+			app.pinLockedResponse(w, r, lockedErr)
+		case errors.Is(err, data.ErrPINDisabled):
+			app.audit(r, &data.AuditEvent{
+				Action:     data.AuditPINFailed,
+				TargetType: "user",
+				TargetID:   strconv.FormatInt(user.ID, 10),
+				After:      map[string]string{"disabled": "true"},
+			})
+			app.pinDisabledResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/data"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+)
+
+func (app *application) refundTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Amount *data.Money `json:"amount"`
+		PIN    string      `json:"pin"`
+	}
+
+	// without an amount whatever is left is refunded
+	err = app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if input.Amount != nil {
+		if data.ValidateMoney(v, "amount", *input.Amount); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	if !app.requireVerified(w, r, user) {
+		return
+	}
+
+	if !app.requirePIN(w, r, user, input.PIN) {
+		return
+	}
+
+	transfer, err := app.models.Accounts.Refund(id, user.ID, input.Amount)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+			return
+		case errors.Is(err, data.ErrNotRefundable):
+			app.notRefundableResponse(w, r)
+			return
+		case errors.Is(err, data.ErrRefundExceedsOriginal):
+			v.AddError("amount", "must not exceed the amount left to refund")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		case errors.Is(err, data.ErrConversionTooSmall):
+			v.AddError("amount", "is too small to convert")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		case errors.Is(err, data.ErrCurrencyMismatch):
+			app.currencyMismatchResponse(w, r)
+			return
+		case errors.Is(err, data.ErrInsuffientBalance):
+			app.insufficientBalanceResponse(w, r)
+			return
+		case errors.Is(err, data.ErrNoAccount):
+			app.accountMissingResponse(w, r)
+			return
+		case errors.Is(err, data.ErrAccountFrozen):
+			app.accountFrozenResponse(w, r)
+			return
+		case errors.Is(err, data.ErrAccountClosed):
+			app.accountClosedResponse(w, r)
+			return
+		case errors.Is(err, data.ErrAmountOverflow):
+			app.amountOverflowResponse(w, r)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	data := envelope{
+		"message":  "transaction refunded successfully",
+		"transfer": transfer,
+	}
+
+	err = app.writeJson(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/data"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+)
+
+func (app *application) listRiskReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	status := app.readString(r.URL.Query(), "status", data.ReviewPending)
+
+	v := validator.New()
+
+	statuses := []string{"", data.ReviewPending, data.ReviewReleased, data.ReviewRejected, data.ReviewBlocked}
+
+	if v.Check(validator.PermittedValue(status, statuses...), "status", "is not a review status"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	reviews, err := app.models.RiskReviews.GetAll(status)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"reviews": reviews}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showRiskReviewHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	review, err := app.models.RiskReviews.Get(id)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"review": review}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readReviewNote reads the note an admin leaves on a review, it writes the
+// error response and returns false when the body is invalid.
+func (app *application) readReviewNote(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var input struct {
+		Note string `json:"note"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return "", false
+	}
+
+	v := validator.New()
+
+	if v.Check(len(input.Note) <= 1000, "note", "must not be more than 1000 bytes long"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return "", false
+	}
+
+	return input.Note, true
+}
+
+// releaseRiskReviewHandler makes the transfer a review held, it still has to
+// fit the sender's balance and limits and its origin must still be open.
+func (app *application) releaseRiskReviewHandler(w http.ResponseWriter, r *http.Request) {
+	admin := app.contextGetUser(r)
+
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	note, ok := app.readReviewNote(w, r)
+
+	if !ok {
+		return
+	}
+
+	review, transfer, err := app.models.RiskReviews.Release(id, admin.ID, note)
+
+	var limitErr *data.LimitError
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+			return
+		case errors.Is(err, data.ErrReviewNotPending):
+			app.reviewNotPendingResponse(w, r)
+			return
+		case errors.Is(err, data.ErrRequestNotPending), errors.Is(err, data.ErrOrderNotPending),
+			errors.Is(err, data.ErrHoldNotActive), errors.Is(err, data.ErrSettlementExceedsBalance):
+			app.reviewOriginChangedResponse(w, r)
+			return
+		case errors.Is(err, data.ErrInsuffientBalance):
+			app.insufficientBalanceResponse(w, r)
+			return
+		case errors.Is(err, data.ErrNoAccount):
+			app.accountMissingResponse(w, r)
+			return
+		case errors.Is(err, data.ErrAccountFrozen):
+			app.accountFrozenResponse(w, r)
+			return
+		case errors.Is(err, data.ErrAccountClosed):
+			app.accountClosedResponse(w, r)
+			return
+		case errors.As(err, &limitErr):
+			app.limitExceededResponse(w, r, limitErr)
+			return
+		case errors.Is(err, data.ErrAmountOverflow):
+			app.amountOverflowResponse(w, r)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	app.audit(r, &data.AuditEvent{
+		Action:     data.AuditReviewRelease,
+		TargetType: "risk_review",
+		TargetID:   strconv.FormatInt(review.ID, 10),
+		Before:     envelope{"status": data.ReviewPending},
+		After:      review,
+	})
+
+	data := envelope{
+		"review":   review,
+		"transfer": transfer,
+	}
+
+	err = app.writeJson(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) rejectRiskReviewHandler(w http.ResponseWriter, r *http.Request) {
+	admin := app.contextGetUser(r)
+
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	note, ok := app.readReviewNote(w, r)
+
+	if !ok {
+		return
+	}
+
+	review, err := app.models.RiskReviews.Reject(id, admin.ID, note)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrReviewNotPending):
+			app.reviewNotPendingResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{
+		Action:     data.AuditReviewReject,
+		TargetType: "risk_review",
+		TargetID:   strconv.FormatInt(review.ID, 10),
+		Before:     envelope{"status": data.ReviewPending},
+		After:      review,
+	})
+
+	err = app.writeJson(w, http.StatusOK, envelope{"review": review}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"net/http"
 
+	"github.com/AdityaVarmaUddaraju/paytm/internal/data"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -13,16 +14,107 @@ func (app *application) routes() http.Handler {
 	router.NotFound = http.HandlerFunc(app.notFoundResponse)
 
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	router.HandlerFunc(http.MethodGet, "/.well-known/jwks.json", app.jwksHandler)
 
 	router.HandlerFunc(http.MethodPost, "/v1/users/signup", app.userRegisterHandler)
 	router.HandlerFunc(http.MethodGet, "/v1/users/signin", app.userSignInHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/users/signin/mfa", app.userSignInMFAHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/users/signout", app.authenticate(app.userSignOutHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/users/mfa/totp", app.authenticate(app.enrollTOTPHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/mfa/totp/confirm", app.authenticate(app.confirmTOTPHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/mfa/totp", app.authenticate(app.disableTOTPHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/users/contact", app.authenticate(app.showContactHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/verify/email", app.authenticate(app.sendEmailVerificationHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/verify/email/confirm", app.authenticate(app.confirmEmailVerificationHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/verify/phone", app.authenticate(app.sendPhoneVerificationHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/verify/phone/confirm", app.authenticate(app.confirmPhoneVerificationHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/users/pin", app.authenticate(app.setPINHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/pin/change", app.authenticate(app.changePINHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/pin/reset", app.authenticate(app.resetPINHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/refresh", app.refreshTokenHandler)
 
 	router.HandlerFunc(http.MethodGet, "/v1/users", app.listUsersHandler)
-	router.HandlerFunc(http.MethodPut, "/v1/users/:id", app.authenticate(app.updateUserHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/:id", app.putUserHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/users/password-reset", app.requestPasswordResetHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/accounts", app.authenticate(app.listAccountsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/accounts/limits", app.authenticate(app.listLimitsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/accounts/create", app.authenticate(app.idempotent(app.createAccountHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/accounts/add", app.authenticate(app.idempotent(app.addMoneyHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/accounts/transfer", app.authenticate(app.idempotent(app.transferMoneyHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/accounts/close", app.authenticate(app.idempotent(app.closeAccountHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/transactions/:id/refund", app.authenticate(app.idempotent(app.refundTransactionHandler)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id", app.authenticate(app.requirePermission(data.PermissionUsersRead, app.showUserAdminHandler)))
+	router.HandlerFunc(http.MethodPut, "/v1/admin/users/:id/role", app.authenticate(app.requirePermission(data.PermissionRolesAssign, app.setUserRoleHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/freeze", app.authenticate(app.requirePermission(data.PermissionAccountsFreeze, app.freezeAccountsHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/unfreeze", app.authenticate(app.requirePermission(data.PermissionAccountsFreeze, app.unfreezeAccountsHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/close", app.authenticate(app.requirePermission(data.PermissionAccountsClose, app.idempotent(app.closeAccountAdminHandler))))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/adjustments", app.authenticate(app.requirePermission(data.PermissionBalancesAdjust, app.idempotent(app.adjustBalanceHandler))))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/unlock", app.authenticate(app.requirePermission(data.PermissionUsersUnlock, app.unlockUserHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/password-reset", app.authenticate(app.requirePermission(data.PermissionUsersResetPassword, app.resetPasswordAdminHandler)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/audit-events", app.authenticate(app.requirePermission(data.PermissionAuditRead, app.listAuditEventsHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/audit-events/verify", app.authenticate(app.requirePermission(data.PermissionAuditRead, app.verifyAuditLogHandler)))
+
+	// the ledger queries, holds, scheduled transfers, payment requests,
+	// groups, merchants, orders, webhooks and risk reviews are only kept in
+	// Postgres, so they are not served from the in-memory store
+	if app.cfg.store == "postgres" {
+		router.HandlerFunc(http.MethodGet, "/v1/accounts/transactions", app.authenticate(app.listTransactionsHandler))
+
+		router.HandlerFunc(http.MethodPost, "/v1/transfers/scheduled", app.authenticate(app.idempotent(app.createScheduledTransferHandler)))
+		router.HandlerFunc(http.MethodGet, "/v1/transfers/scheduled", app.authenticate(app.listScheduledTransfersHandler))
+		router.HandlerFunc(http.MethodGet, "/v1/transfers/scheduled/:id", app.authenticate(app.showScheduledTransferHandler))
+		router.HandlerFunc(http.MethodDelete, "/v1/transfers/scheduled/:id", app.authenticate(app.cancelScheduledTransferHandler))
+
+		router.HandlerFunc(http.MethodPost, "/v1/payment-requests", app.authenticate(app.idempotent(app.createPaymentRequestHandler)))
+		router.HandlerFunc(http.MethodGet, "/v1/payment-requests", app.authenticate(app.listPaymentRequestsHandler))
+		router.HandlerFunc(http.MethodGet, "/v1/payment-requests/:id", app.authenticate(app.showPaymentRequestHandler))
+		router.HandlerFunc(http.MethodPost, "/v1/payment-requests/:id/accept", app.authenticate(app.idempotent(app.acceptPaymentRequestHandler)))
+		router.HandlerFunc(http.MethodPost, "/v1/payment-requests/:id/decline", app.authenticate(app.declinePaymentRequestHandler))
+		router.HandlerFunc(http.MethodPost, "/v1/payment-requests/:id/cancel", app.authenticate(app.cancelPaymentRequestHandler))
+
+		router.HandlerFunc(http.MethodPost, "/v1/groups", app.authenticate(app.createGroupHandler))
+		router.HandlerFunc(http.MethodGet, "/v1/groups", app.authenticate(app.listGroupsHandler))
+		router.HandlerFunc(http.MethodGet, "/v1/groups/:id", app.authenticate(app.showGroupHandler))
+		router.HandlerFunc(http.MethodPost, "/v1/groups/:id/expenses", app.authenticate(app.createExpenseHandler))
+		router.HandlerFunc(http.MethodGet, "/v1/groups/:id/expenses", app.authenticate(app.listExpensesHandler))
+		router.HandlerFunc(http.MethodGet, "/v1/groups/:id/settle-up", app.authenticate(app.settleUpHandler))
+		router.HandlerFunc(http.MethodPost, "/v1/groups/:id/settlements", app.authenticate(app.idempotent(app.createSettlementHandler)))
+
+		router.HandlerFunc(http.MethodPost, "/v1/merchants", app.authenticate(app.createMerchantHandler))
+		router.HandlerFunc(http.MethodGet, "/v1/merchants", app.authenticate(app.listMerchantsHandler))
+		router.HandlerFunc(http.MethodPost, "/v1/merchants/:id/api-keys", app.authenticate(app.createAPIKeyHandler))
+		router.HandlerFunc(http.MethodGet, "/v1/merchants/:id/api-keys", app.authenticate(app.listAPIKeysHandler))
+		router.HandlerFunc(http.MethodDelete, "/v1/merchants/:id/api-keys/:key_id", app.authenticate(app.revokeAPIKeyHandler))
+
+		router.HandlerFunc(http.MethodPost, "/v1/orders", app.acceptAPIKey(data.ScopeOrdersWrite, app.authenticate(app.idempotent(app.createOrderHandler))))
+		router.HandlerFunc(http.MethodGet, "/v1/orders", app.acceptAPIKey(data.ScopeOrdersRead, app.authenticate(app.listOrdersHandler)))
+		router.HandlerFunc(http.MethodGet, "/v1/orders/:id", app.acceptAPIKey(data.ScopeOrdersRead, app.authenticate(app.showOrderHandler)))
+		router.HandlerFunc(http.MethodPost, "/v1/orders/:id/pay", app.authenticate(app.idempotent(app.payOrderHandler)))
+		router.HandlerFunc(http.MethodPost, "/v1/orders/:id/cancel", app.acceptAPIKey(data.ScopeOrdersWrite, app.authenticate(app.cancelOrderHandler)))
+
+		router.HandlerFunc(http.MethodPost, "/v1/webhooks", app.authenticate(app.createWebhookHandler))
+		router.HandlerFunc(http.MethodGet, "/v1/webhooks", app.authenticate(app.listWebhooksHandler))
+		router.HandlerFunc(http.MethodDelete, "/v1/webhooks/:id", app.authenticate(app.deleteWebhookHandler))
+		router.HandlerFunc(http.MethodGet, "/v1/webhooks/:id/deliveries", app.authenticate(app.listWebhookDeliveriesHandler))
+		router.HandlerFunc(http.MethodPost, "/v1/webhooks/:id/deliveries/:delivery_id/replay", app.authenticate(app.replayWebhookDeliveryHandler))
+
+		router.HandlerFunc(http.MethodPost, "/v1/holds", app.authenticate(app.idempotent(app.createHoldHandler)))
+		router.HandlerFunc(http.MethodGet, "/v1/holds/:id", app.authenticate(app.showHoldHandler))
+		router.HandlerFunc(http.MethodPost, "/v1/holds/:id/capture", app.authenticate(app.idempotent(app.captureHoldHandler)))
+		router.HandlerFunc(http.MethodPost, "/v1/holds/:id/void", app.authenticate(app.idempotent(app.voidHoldHandler)))
 
-	router.HandlerFunc(http.MethodPost, "/v1/accounts/create", app.authenticate(app.createAccountHandler))
-	router.HandlerFunc(http.MethodPost, "/v1/accounts/add", app.authenticate(app.addMoneyHandler))
-	router.HandlerFunc(http.MethodPost, "/v1/accounts/transfer", app.authenticate(app.transferMoneyHandler))
+		router.HandlerFunc(http.MethodGet, "/v1/admin/reviews", app.authenticate(app.requirePermission(data.PermissionReviewsManage, app.listRiskReviewsHandler)))
+		router.HandlerFunc(http.MethodGet, "/v1/admin/reviews/:id", app.authenticate(app.requirePermission(data.PermissionReviewsManage, app.showRiskReviewHandler)))
+		router.HandlerFunc(http.MethodPost, "/v1/admin/reviews/:id/release", app.authenticate(app.requirePermission(data.PermissionReviewsManage, app.idempotent(app.releaseRiskReviewHandler))))
+		router.HandlerFunc(http.MethodPost, "/v1/admin/reviews/:id/reject", app.authenticate(app.requirePermission(data.PermissionReviewsManage, app.rejectRiskReviewHandler)))
+	}
 
-	return app.recoverPanic(app.enableCORS(router))
+	return app.recoverPanic(app.requestID(app.enableCORS(router)))
 }
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/data"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+)
+
+const (
+	// scheduledBatchSize scheduled transfers are claimed per run, each for
+	// scheduledLease, which comfortably covers running the whole batch
+	scheduledBatchSize = 20
+	scheduledLease     = 5 * time.Minute
+)
+
+func (app *application) createScheduledTransferHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		ToUserID  int64      `json:"to_user_id"`
+		Amount    data.Money `json:"amount"`
+		Frequency string     `json:"frequency"`
+		StartAt   time.Time  `json:"start_at"`
+		EndAt     *time.Time `json:"end_at"`
+		MaxRuns   *int       `json:"max_runs"`
+		MFACode   string     `json:"mfa_code"`
+		PIN       string     `json:"pin"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Frequency == "" {
+		input.Frequency = data.FrequencyOnce
+	}
+
+	st := &data.ScheduledTransfer{
+		UserID:    user.ID,
+		ToUserID:  input.ToUserID,
+		Amount:    input.Amount,
+		Frequency: input.Frequency,
+		StartAt:   input.StartAt,
+		EndAt:     input.EndAt,
+		MaxRuns:   input.MaxRuns,
+	}
+
+	v := validator.New()
+
+	if data.ValidateScheduledTransfer(v, st); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.requireVerified(w, r, user) {
+		return
+	}
+
+	// every occurrence runs unattended, so the PIN and step-up are taken at
+	// creation
+	if !app.requirePIN(w, r, user, input.PIN) {
+		return
+	}
+
+	if !app.stepUp(w, r, user, st.Amount, input.MFACode) {
+		return
+	}
+
+	ok, err := app.models.Accounts.CheckIfUserExists(st.ToUserID)
+
+	if err != nil && !errors.Is(err, data.ErrNoAccount) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !ok {
+		app.accountMissingResponse(w, r)
+		return
+	}
+
+	err = app.models.ScheduledTransfers.Insert(st)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"scheduled_transfer": st,
+	}
+
+	err = app.writeJson(w, http.StatusCreated, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listScheduledTransfersHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	scheduled, err := app.models.ScheduledTransfers.GetAllForUser(user.ID)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"scheduled_transfers": scheduled}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getScheduledTransferForUser loads the scheduled transfer named in the URL
+// when the user created it, it writes the error response and returns nil
+// otherwise.
+func (app *application) getScheduledTransferForUser(w http.ResponseWriter, r *http.Request, user *data.User) *data.ScheduledTransfer {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	st, err := app.models.ScheduledTransfers.Get(id)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	if st.UserID != user.ID {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	return st
+}
+
+func (app *application) showScheduledTransferHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	st := app.getScheduledTransferForUser(w, r, user)
+
+	if st == nil {
+		return
+	}
+
+	runs, err := app.models.ScheduledTransfers.GetRuns(st.ID)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	st.Runs = runs
+
+	err = app.writeJson(w, http.StatusOK, envelope{"scheduled_transfer": st}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) cancelScheduledTransferHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	st := app.getScheduledTransferForUser(w, r, user)
+
+	if st == nil {
+		return
+	}
+
+	st, err := app.models.ScheduledTransfers.Cancel(st.ID)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrScheduleNotActive):
+			app.scheduleNotActiveResponse(w, r)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"scheduled_transfer": st}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// runScheduledTransfers runs the scheduled transfers that are due through the
+// same path as a transfer made by the user.
+func (app *application) runScheduledTransfers() error {
+	due, err := app.models.ScheduledTransfers.ClaimDue(scheduledBatchSize, scheduledLease)
+
+	if err != nil {
+		return err
+	}
+
+	for _, st := range due {
+		transfer := st.Transfer()
+
+		runErr := app.models.Accounts.TransferMoney(transfer)
+
+		if runErr != nil && !errors.Is(runErr, data.ErrDuplicateReference) {
+			app.logger.Warn("scheduled transfer failed", "id", st.ID, "occurrence", st.Occurrences, "error", runErr.Error())
+		}
+
+		// when recording fails the lease lapses and the occurrence is picked
+		// up again, its reference stops it from being transferred twice
+		err = app.models.ScheduledTransfers.RecordRun(st, transfer, runErr)
+
+		if err != nil {
+			app.logger.Error(err.Error(), "job", "scheduled transfers", "id", st.ID)
+		}
+	}
+
+	return nil
+}
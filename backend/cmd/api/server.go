@@ -24,6 +24,11 @@ func (app *application) server() error {
 
 	shutdownErr := make(chan error)
 
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	app.startWorkers(workersCtx)
+
 	go func() {
 		quit := make(chan os.Signal, 1)
 
@@ -36,6 +41,8 @@ func (app *application) server() error {
 			"signal", s.String(),
 		)
 
+		stopWorkers()
+
 		ctx, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
 		defer cancel()
 
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/data"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/fx"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/mailer"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/notify"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/sms"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/tokens"
+)
+
+// testApp is an application on the in-memory store, serving its routes
+// from an httptest server.
+type testApp struct {
+	*application
+	server *httptest.Server
+	sms    *sms.Memory
+}
+
+func newTestApp(t *testing.T) *testApp {
+	t.Helper()
+
+	var cfg config
+
+	cfg.env = "testing"
+	cfg.store = "memory"
+	cfg.tokens.accessTTL = 15 * time.Minute
+	cfg.tokens.refreshTTL = time.Hour
+	cfg.passwordReset.ttl = 30 * time.Minute
+	cfg.mfa.issuer = "Paytm"
+	cfg.mfa.stepUpAmounts = map[string]int64{"INR": 2500000}
+
+	keyring := tokens.NewKeyring()
+
+	if err := keyring.AddHMAC(tokens.LegacyKeyID, []byte("test secret")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := keyring.SetSigningKey(tokens.LegacyKeyID); err != nil {
+		t.Fatal(err)
+	}
+
+	rates, err := fx.NewStaticProvider(nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	texts := &sms.Memory{}
+
+	app := &application{
+		cfg:      cfg,
+		logger:   logger,
+		models:   data.NewMemoryModels(),
+		rates:    rates,
+		keyring:  keyring,
+		notifier: notify.Logger{Logger: logger},
+		mailer:   &mailer.Memory{Sender: "Paytm <no-reply@paytm.local>"},
+		sms:      texts,
+	}
+
+	server := httptest.NewServer(app.routes())
+	t.Cleanup(server.Close)
+	t.Cleanup(app.wg.Wait)
+
+	return &testApp{application: app, server: server, sms: texts}
+}
+
+// do sends body as JSON with the bearer token, when there is one, and
+// decodes the JSON response into an envelope.
+func (ta *testApp) do(t *testing.T, method, path, token string, body any) (int, envelope) {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req, err := http.NewRequest(method, ta.server.URL+path, &buf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := ta.server.Client().Do(req)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer res.Body.Close()
+
+	var decoded envelope
+
+	if err = json.NewDecoder(res.Body).Decode(&decoded); err != nil && err != io.EOF {
+		t.Fatal(err)
+	}
+
+	return res.StatusCode, decoded
+}
+
+var smsCodeRX = regexp.MustCompile(`code is (\d+)`)
+
+// signUp registers username with phone, signs them in and returns their
+// access token. With verified the phone is confirmed with the texted code.
+func (ta *testApp) signUp(t *testing.T, username, phone string, verified bool) string {
+	t.Helper()
+
+	status, _ := ta.do(t, http.MethodPost, "/v1/users/signup", "", map[string]string{
+		"username":  username,
+		"firstName": "Test",
+		"lastName":  "User",
+		"phone":     phone,
+		"password":  "pa55word",
+	})
+
+	if status != http.StatusCreated {
+		t.Fatalf("sign up %s: got status %d", username, status)
+	}
+
+	status, res := ta.do(t, http.MethodGet, "/v1/users/signin", "", map[string]string{
+		"username": username,
+		"password": "pa55word",
+	})
+
+	if status != http.StatusOK {
+		t.Fatalf("sign in %s: got status %d", username, status)
+	}
+
+	token := res["token"].(string)
+
+	if verified {
+		ta.wg.Wait()
+
+		var code string
+
+		for _, msg := range ta.sms.Messages() {
+			if msg.To == phone {
+				code = smsCodeRX.FindStringSubmatch(msg.Body)[1]
+			}
+		}
+
+		status, _ = ta.do(t, http.MethodPost, "/v1/users/verify/phone/confirm", token, map[string]string{"code": code})
+
+		if status != http.StatusOK {
+			t.Fatalf("verify %s: got status %d", username, status)
+		}
+	}
+
+	return token
+}
+
+// userID returns the id of the user token belongs to.
+func (ta *testApp) userID(t *testing.T, token string) int64 {
+	t.Helper()
+
+	claims, err := tokens.VerifyToken(token, ta.keyring)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := ta.models.Users.GetByUsername(claims.Username)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user.ID
+}
+
+func inr(value string) map[string]string {
+	return map[string]string{"value": value, "currency": "INR"}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/data"
+)
+
+// checkSignIn refuses a sign-in while the username or the client is blocked
+// after failed attempts. It writes the error response and returns false
+// unless the sign-in may be tried.
+func (app *application) checkSignIn(w http.ResponseWriter, r *http.Request, username string) bool {
+	err := app.models.Throttles.Check(data.UsernameThrottleKey(username), data.IPThrottleKey(clientIP(r)))
+
+	if err != nil {
+		var throttledErr *data.ThrottledError
+
+		switch {
+		case errors.As(err, &throttledErr):
+			app.audit(r, &data.AuditEvent{
+				Action: data.AuditSignInFailed,
+				After:  map[string]string{"username": username, "reason": "throttled", "key": throttledErr.Key},
+			})
+			app.signInThrottledResponse(w, r, throttledErr)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return false
+	}
+
+	return true
+}
+
+// failSignIn counts a failed sign-in against the username and the client.
+// The sign-in has already failed, so an error is logged rather than changing
+// the response.
+func (app *application) failSignIn(r *http.Request, username string) {
+	err := app.models.Throttles.Fail(data.UsernameThrottleKey(username), data.UsernameSignInPolicy)
+
+	if err == nil {
+		err = app.models.Throttles.Fail(data.IPThrottleKey(clientIP(r)), data.IPSignInPolicy)
+	}
+
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// signedIn forgets the failed sign-ins against the username once the user
+// is fully signed in. Those against the client are left to expire, one good
+// password should not reset a client guessing many.
+func (app *application) signedIn(r *http.Request, username string) {
+	err := app.models.Throttles.Reset(data.UsernameThrottleKey(username))
+
+	if err != nil {
+		app.logError(r, err)
+	}
+}
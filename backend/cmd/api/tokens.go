@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/data"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/tokens"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+)
+
+// issueTokens starts a new session for the user and returns its access and
+// refresh tokens.
+func (app *application) issueTokens(user *data.User) (envelope, error) {
+	session, refreshToken, err := app.models.Sessions.New(user.ID, app.cfg.tokens.refreshTTL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return app.tokenEnvelope(user, session, refreshToken)
+}
+
+func (app *application) tokenEnvelope(user *data.User, session *data.Session, refreshToken *data.Token) (envelope, error) {
+	token, err := tokens.CreateToken(app.keyring, user.UserName, session.ID, app.cfg.tokens.accessTTL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return envelope{
+		"token":                token,
+		"expires_in":           int(app.cfg.tokens.accessTTL.Seconds()),
+		"refresh_token":        refreshToken.Plaintext,
+		"refresh_token_expiry": refreshToken.Expiry,
+	}, nil
+}
+
+func (app *application) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.ValidateEmpty(input.RefreshToken, "refresh_token")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	session, refreshToken, err := app.models.Sessions.Rotate(input.RefreshToken, app.cfg.tokens.refreshTTL)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidRefreshToken), errors.Is(err, data.ErrRefreshTokenReused):
+			app.invalidRefreshTokenResponse(w, r)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	user, err := app.models.Users.GetByID(session.UserID)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidRefreshTokenResponse(w, r)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	data, err := app.tokenEnvelope(user, session, refreshToken)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	data := envelope{
+		"keys": app.keyring.JWKS(),
+	}
+
+	err := app.writeJson(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
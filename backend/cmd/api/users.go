@@ -3,6 +3,8 @@ package main
 import (
 	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/AdityaVarmaUddaraju/paytm/internal/data"
 	"github.com/AdityaVarmaUddaraju/paytm/internal/tokens"
@@ -14,6 +16,8 @@ func (app *application) userRegisterHandler(w http.ResponseWriter, r *http.Reque
 		UserName  string `json:"username"`
 		FirstName string `json:"firstName"`
 		LastName  string `json:"lastName"`
+		Email     string `json:"email"`
+		Phone     string `json:"phone"`
 		Password  string `json:"password"`
 	}
 
@@ -28,6 +32,8 @@ func (app *application) userRegisterHandler(w http.ResponseWriter, r *http.Reque
 		UserName:  input.UserName,
 		FirstName: input.FirstName,
 		LastName:  input.LastName,
+		Email:     normalizeEmail(input.Email),
+		Phone:     strings.TrimSpace(input.Phone),
 	}
 
 	err = user.Password.Set(input.Password)
@@ -52,6 +58,12 @@ func (app *application) userRegisterHandler(w http.ResponseWriter, r *http.Reque
 		case errors.Is(err, data.ErrDuplicateUsername):
 			app.duplicateUsernameResponse(w, r)
 			return
+		case errors.Is(err, data.ErrDuplicateEmail):
+			app.duplicateEmailResponse(w, r)
+			return
+		case errors.Is(err, data.ErrDuplicatePhone):
+			app.duplicatePhoneResponse(w, r)
+			return
 		default:
 			app.serverErrorResponse(w, r, err)
 			return
@@ -59,6 +71,16 @@ func (app *application) userRegisterHandler(w http.ResponseWriter, r *http.Reque
 
 	}
 
+	app.sendNewContactCodes(r, nil, user)
+
+	app.audit(r, &data.AuditEvent{
+		ActorID:    &user.ID,
+		Action:     data.AuditSignUp,
+		TargetType: "user",
+		TargetID:   strconv.FormatInt(user.ID, 10),
+		After:      user,
+	})
+
 	data := envelope{
 		"user": user,
 	}
@@ -95,12 +117,25 @@ func (app *application) userSignInHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// refuse guesses against a username or from a client that failed too often
+	if !app.checkSignIn(w, r, input.Username) {
+		return
+	}
+
 	// check if user exists with given username if not raise invalid credential
 	user, err := app.models.Users.GetByUsername(input.Username)
 
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
+			// take as long as a wrong password does so the timing does not
+			// tell which usernames exist
+			data.MatchNoUser(input.Password)
+			app.failSignIn(r, input.Username)
+			app.audit(r, &data.AuditEvent{
+				Action: data.AuditSignInFailed,
+				After:  map[string]string{"username": input.Username, "reason": "unknown username"},
+			})
 			app.invalidCreditialsResponse(w, r)
 			return
 		default:
@@ -118,23 +153,93 @@ func (app *application) userSignInHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	if !match {
+		app.failSignIn(r, input.Username)
+		app.audit(r, &data.AuditEvent{
+			ActorID:    &user.ID,
+			Action:     data.AuditSignInFailed,
+			TargetType: "user",
+			TargetID:   strconv.FormatInt(user.ID, 10),
+			After:      map[string]string{"username": input.Username, "reason": "wrong password"},
+		})
 		app.invalidCreditialsResponse(w, r)
 		return
 	}
 
-	// if user is valid send the jwt token in response
-	token, err := tokens.CreateToken(app.cfg.jwtSecretKey, user.UserName)
+	mfa, err := app.models.MFA.Enabled(user.ID)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// users with two-factor authentication get a session from
+	// userSignInMFAHandler once they give their code
+	if mfa {
+		mfaToken, err := tokens.CreateMFAToken(app.keyring, user.UserName, mfaTokenTTL)
+
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		data := envelope{
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+			"expires_in":   int(mfaTokenTTL.Seconds()),
+		}
+
+		err = app.writeJson(w, http.StatusOK, data, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// if user is valid start a session and send its tokens in response
+	tokens, err := app.issueTokens(user)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
+	app.signedIn(r, user.UserName)
+
+	app.audit(r, &data.AuditEvent{
+		ActorID:    &user.ID,
+		Action:     data.AuditSignIn,
+		TargetType: "user",
+		TargetID:   strconv.FormatInt(user.ID, 10),
+	})
+
 	//send the token to the user
+	app.writeJson(w, http.StatusOK, tokens, nil)
+}
+
+func (app *application) userSignOutHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID := app.contextGetSessionID(r)
+
+	err := app.models.Sessions.Revoke(sessionID)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{
+		Action:     data.AuditSignOut,
+		TargetType: "session",
+		TargetID:   strconv.FormatInt(sessionID, 10),
+	})
+
 	data := envelope{
-		"token": token,
+		"message": "signed out successfully",
+	}
+
+	err = app.writeJson(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
 	}
-	app.writeJson(w, http.StatusOK, data, nil)
 }
 
 func (app *application) listUsersHandler(w http.ResponseWriter, r *http.Request) {
@@ -160,9 +265,11 @@ func (app *application) listUsersHandler(w http.ResponseWriter, r *http.Request)
 
 func (app *application) updateUserHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Firstname string `json:"firstname"`
-		Lastname  string `json:"lastname"`
-		Password  string `json:"password"`
+		Firstname string  `json:"firstname"`
+		Lastname  string  `json:"lastname"`
+		Email     *string `json:"email"`
+		Phone     *string `json:"phone"`
+		Password  string  `json:"password"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -186,9 +293,39 @@ func (app *application) updateUserHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	previous := *user
+	before := envelope{"firstName": user.FirstName, "lastName": user.LastName, "email": user.Email, "phone": user.Phone}
+
 	user.FirstName = input.Firstname
 	user.LastName = input.Lastname
-	user.Password.Set(input.Password)
+
+	// contact details are kept unless sent, an empty one removes it and a
+	// changed one has to be verified again
+	if input.Email != nil {
+		user.SetEmail(normalizeEmail(*input.Email))
+	}
+
+	if input.Phone != nil {
+		user.SetPhone(strings.TrimSpace(*input.Phone))
+	}
+
+	// bcrypt salts every hash, so the password is only set again when it
+	// changed, otherwise every edit would look like a password change
+	unchanged, err := user.Password.Match(input.Password)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !unchanged {
+		err = user.Password.Set(input.Password)
+
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
 
 	v := validator.New()
 
@@ -201,14 +338,30 @@ func (app *application) updateUserHandler(w http.ResponseWriter, r *http.Request
 
 	if err != nil {
 		switch {
-		case errors.Is(err, data.ErrRecordNotFound):
+		case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
 			return
+		case errors.Is(err, data.ErrDuplicateEmail):
+			app.duplicateEmailResponse(w, r)
+			return
+		case errors.Is(err, data.ErrDuplicatePhone):
+			app.duplicatePhoneResponse(w, r)
+			return
 		default:
 			app.serverErrorResponse(w, r, err)
 			return
 		}
 	}
 
+	app.sendNewContactCodes(r, &previous, user)
+
+	// the password itself is never audited, only that it changed
+	app.audit(r, &data.AuditEvent{
+		Action:     data.AuditUserUpdate,
+		TargetType: "user",
+		TargetID:   strconv.FormatInt(user.ID, 10),
+		Before:     before,
+		After:      envelope{"firstName": user.FirstName, "lastName": user.LastName, "email": user.Email, "phone": user.Phone, "password_changed": !unchanged},
+	})
 }
 
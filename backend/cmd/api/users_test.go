@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestUserRegister(t *testing.T) {
+	app := newTestApp(t)
+
+	app.signUp(t, "alice", "+919876543210", false)
+
+	tests := []struct {
+		name     string
+		username string
+		phone    string
+		password string
+		want     int
+	}{
+		{"new user", "bob", "+919876543211", "pa55word", http.StatusCreated},
+		{"duplicate username", "alice", "+919876543212", "pa55word", http.StatusConflict},
+		{"duplicate phone", "carol", "+919876543210", "pa55word", http.StatusConflict},
+		{"invalid phone", "dave", "98765", "pa55word", http.StatusUnprocessableEntity},
+		{"no password", "erin", "+919876543213", "", http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _ := app.do(t, http.MethodPost, "/v1/users/signup", "", map[string]string{
+				"username":  tt.username,
+				"firstName": "Test",
+				"lastName":  "User",
+				"phone":     tt.phone,
+				"password":  tt.password,
+			})
+
+			if status != tt.want {
+				t.Errorf("got status %d, want %d", status, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserSignIn(t *testing.T) {
+	app := newTestApp(t)
+
+	app.signUp(t, "alice", "+919876543210", false)
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		want     int
+	}{
+		{"right password", "alice", "pa55word", http.StatusOK},
+		{"wrong password", "alice", "wrong", http.StatusUnauthorized},
+		{"unknown username", "nobody", "pa55word", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, res := app.do(t, http.MethodGet, "/v1/users/signin", "", map[string]string{
+				"username": tt.username,
+				"password": tt.password,
+			})
+
+			if status != tt.want {
+				t.Fatalf("got status %d, want %d", status, tt.want)
+			}
+
+			if _, ok := res["token"]; ok != (tt.want == http.StatusOK) {
+				t.Errorf("got token %v, want one only on success", res["token"])
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/data"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+)
+
+// contactFor returns the user's contact detail verified over channel and
+// whether it already is.
+func contactFor(user *data.User, channel string) (string, bool) {
+	if channel == data.ChannelPhone {
+		return user.Phone, user.PhoneVerifiedAt != nil
+	}
+
+	return user.Email, user.EmailVerifiedAt != nil
+}
+
+// sendVerificationCode issues a code for the user's contact detail on
+// channel and delivers it in the background.
+func (app *application) sendVerificationCode(user *data.User, channel string) (*data.Token, error) {
+	destination, _ := contactFor(user, channel)
+
+	code, err := app.models.Verifications.New(user.ID, channel, destination)
+
+	if err != nil {
+		return nil, err
+	}
+
+	app.background(func() {
+		var err error
+
+		switch channel {
+		case data.ChannelPhone:
+			body := fmt.Sprintf("Your Paytm verification code is %s. It expires at %s.", code.Plaintext, code.Expiry.Format(time.Kitchen+" MST"))
+			err = app.sms.Send(destination, body)
+		default:
+			data := map[string]any{
+				"firstName": user.FirstName,
+				"code":      code.Plaintext,
+				"expiry":    code.Expiry.Format(time.RFC1123),
+			}
+			err = app.mailer.Send(destination, "verify_email.tmpl", data)
+		}
+
+		if err != nil {
+			app.logger.Error(err.Error(), "user_id", user.ID, "channel", channel)
+		}
+	})
+
+	return code, nil
+}
+
+// sendNewContactCodes sends codes for the contact details of user that
+// changed from before, a user who just signed up has no before. The request
+// went through already, so a failure is logged.
+func (app *application) sendNewContactCodes(r *http.Request, before, user *data.User) {
+	for _, channel := range []string{data.ChannelEmail, data.ChannelPhone} {
+		destination, verified := contactFor(user, channel)
+
+		if destination == "" || verified {
+			continue
+		}
+
+		if before != nil {
+			if previous, _ := contactFor(before, channel); previous == destination {
+				continue
+			}
+		}
+
+		_, err := app.sendVerificationCode(user, channel)
+
+		if err != nil {
+			app.logError(r, err)
+		}
+	}
+}
+
+func (app *application) showContactHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	data := envelope{
+		"contact": user.Contact(),
+	}
+
+	err := app.writeJson(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) sendEmailVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	app.sendVerification(w, r, data.ChannelEmail)
+}
+
+func (app *application) sendPhoneVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	app.sendVerification(w, r, data.ChannelPhone)
+}
+
+// sendVerification sends a new code for the user's email or phone, for when
+// the first one was lost or expired.
+func (app *application) sendVerification(w http.ResponseWriter, r *http.Request, channel string) {
+	user := app.contextGetUser(r)
+
+	destination, verified := contactFor(user, channel)
+
+	switch {
+	case destination == "":
+		app.contactMissingResponse(w, r, channel)
+		return
+	case verified:
+		app.contactVerifiedResponse(w, r, channel)
+		return
+	}
+
+	code, err := app.sendVerificationCode(user, channel)
+
+	if err != nil {
+		var throttledErr *data.ThrottledError
+
+		switch {
+		case errors.As(err, &throttledErr):
+			message := fmt.Sprintf("a code was sent recently, try again after %s", throttledErr.Until.Format(time.RFC3339))
+			app.retryAfterResponse(w, r, http.StatusTooManyRequests, throttledErr.Until, message)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message":    fmt.Sprintf("verification code sent to your %s", channel),
+		"expires_at": code.Expiry,
+	}
+
+	err = app.writeJson(w, http.StatusAccepted, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) confirmEmailVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	app.confirmVerification(w, r, data.ChannelEmail)
+}
+
+func (app *application) confirmPhoneVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	app.confirmVerification(w, r, data.ChannelPhone)
+}
+
+// confirmVerification marks the user's email or phone verified with the code
+// sent to it, which lifts the restrictions on unverified users.
+func (app *application) confirmVerification(w http.ResponseWriter, r *http.Request, channel string) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.ValidateEmpty(input.Code, "code")
+	v.Check(len(input.Code) <= 16, "code", "must not be more than 16 bytes long")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	destination, verified := contactFor(user, channel)
+
+	switch {
+	case destination == "":
+		app.contactMissingResponse(w, r, channel)
+		return
+	case verified:
+		app.contactVerifiedResponse(w, r, channel)
+		return
+	}
+
+	err = app.models.Verifications.Confirm(user.ID, channel, destination, input.Code)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidVerificationCode):
+			v.AddError("code", "invalid or expired verification code")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user, err = app.models.Users.GetByID(user.ID)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{
+		Action:     data.AuditContactVerify,
+		TargetType: "user",
+		TargetID:   strconv.FormatInt(user.ID, 10),
+		After:      map[string]string{"channel": channel},
+	})
+
+	data := envelope{
+		"message": fmt.Sprintf("%s verified", channel),
+		"contact": user.Contact(),
+	}
+
+	err = app.writeJson(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// requireVerified keeps users without a verified email or phone from moving
+// money between users. It writes the error response and returns false unless
+// the user is verified.
+func (app *application) requireVerified(w http.ResponseWriter, r *http.Request, user *data.User) bool {
+	if user.VerificationLevel >= data.VerificationContact {
+		return true
+	}
+
+	app.authorizationRequiredResponse(w, r, "verification_required", "verify your email or phone to move money between users")
+	return false
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/data"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+)
+
+// The dispatcher fans out up to webhookFanOutBatch outbox events per run and
+// sends up to webhookBatchSize deliveries, webhookConcurrency at a time. The
+// lease outlives a batch of requests that all time out.
+const (
+	webhookFanOutBatch = 500
+	webhookBatchSize   = 50
+	webhookConcurrency = 8
+	webhookLease       = 5 * time.Minute
+)
+
+func (app *application) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		URL        string   `json:"url"`
+		EventTypes []string `json:"event_types"`
+		MerchantID *int64   `json:"merchant_id"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	endpoint := &data.WebhookEndpoint{
+		UserID:     user.ID,
+		MerchantID: input.MerchantID,
+		URL:        input.URL,
+		EventTypes: input.EventTypes,
+	}
+
+	v := validator.New()
+
+	if data.ValidateWebhookEndpoint(v, endpoint); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if input.MerchantID != nil {
+		merchant, err := app.models.Merchants.Get(*input.MerchantID)
+
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if merchant == nil || merchant.UserID != user.ID {
+			v.AddError("merchant_id", "must be one of your merchants")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	err = app.models.Webhooks.InsertEndpoint(endpoint)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{
+		Action:     data.AuditWebhookCreate,
+		TargetType: "webhook",
+		TargetID:   strconv.FormatInt(endpoint.ID, 10),
+		After:      endpoint,
+	})
+
+	// the secret is only ever shown here, receivers need it to check signatures
+	data := envelope{
+		"webhook": endpoint,
+		"secret":  endpoint.Secret,
+	}
+
+	err = app.writeJson(w, http.StatusCreated, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	endpoints, err := app.models.Webhooks.GetEndpointsForUser(user.ID)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"webhooks": endpoints}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getWebhookForUser loads the endpoint named in the URL when the user
+// registered it, it writes the error response and returns nil otherwise.
+func (app *application) getWebhookForUser(w http.ResponseWriter, r *http.Request, user *data.User) *data.WebhookEndpoint {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	endpoint, err := app.models.Webhooks.GetEndpoint(id)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	if endpoint.UserID != user.ID {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	return endpoint
+}
+
+func (app *application) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	endpoint := app.getWebhookForUser(w, r, user)
+
+	if endpoint == nil {
+		return
+	}
+
+	err := app.models.Webhooks.DisableEndpoint(endpoint.ID)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{
+		Action:     data.AuditWebhookDisable,
+		TargetType: "webhook",
+		TargetID:   strconv.FormatInt(endpoint.ID, 10),
+		Before:     endpoint,
+	})
+
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "webhook disabled successfully"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	endpoint := app.getWebhookForUser(w, r, user)
+
+	if endpoint == nil {
+		return
+	}
+
+	status := app.readString(r.URL.Query(), "status", "")
+
+	v := validator.New()
+
+	statuses := []string{"", data.WebhookDeliveryPending, data.WebhookDeliveryDelivered, data.WebhookDeliveryDead}
+
+	if v.Check(validator.PermittedValue(status, statuses...), "status", "is not a delivery status"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	deliveries, err := app.models.Webhooks.GetDeliveries(endpoint.ID, status)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"deliveries": deliveries}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// replayWebhookDeliveryHandler sends a delivery again, typically one that was
+// dead lettered while the receiver was down.
+func (app *application) replayWebhookDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	endpoint := app.getWebhookForUser(w, r, user)
+
+	if endpoint == nil {
+		return
+	}
+
+	if endpoint.DisabledAt != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	deliveryID, err := app.readInt64Param(r, "delivery_id")
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	delivery, err := app.models.Webhooks.Replay(endpoint.ID, deliveryID)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusAccepted, envelope{"delivery": delivery}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// dispatchWebhooks turns new outbox events into deliveries and sends those
+// that are due.
+func (app *application) dispatchWebhooks() error {
+	_, err := app.models.Webhooks.FanOut(webhookFanOutBatch)
+
+	if err != nil {
+		return err
+	}
+
+	due, err := app.models.Webhooks.ClaimDue(webhookBatchSize, webhookLease)
+
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, webhookConcurrency)
+
+	for _, d := range due {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(d *data.WebhookDelivery) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			app.deliverWebhook(d)
+		}(d)
+	}
+
+	wg.Wait()
+
+	return nil
+}
+
+func (app *application) deliverWebhook(d *data.WebhookDelivery) {
+	ctx, cancel := context.WithTimeout(context.Background(), app.cfg.webhooks.timeout)
+	defer cancel()
+
+	statusCode, sendErr := app.webhooks.Send(ctx, d.URL, d.Secret, d.EventID, d.EventType, d.Body)
+
+	// when recording fails the lease lapses and the delivery is sent again,
+	// receivers tell repeats apart by the event id
+	err := app.models.Webhooks.RecordAttempt(d, statusCode, sendErr)
+
+	if err != nil {
+		app.logger.Error(err.Error(), "job", "webhooks", "delivery_id", d.ID)
+		return
+	}
+
+	switch d.Status {
+	case data.WebhookDeliveryDead:
+		app.logger.Warn("webhook delivery dead lettered", "delivery_id", d.ID, "endpoint_id", d.EndpointID, "error", sendErr.Error())
+	case data.WebhookDeliveryPending:
+		app.logger.Info("webhook delivery failed", "delivery_id", d.ID, "attempts", d.Attempts, "error", sendErr.Error())
+	}
+}
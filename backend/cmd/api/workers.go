@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// startWorkers launches the background jobs. They stop when ctx is cancelled
+// and are tracked by app.wg so shutdown waits for a run in progress.
+func (app *application) startWorkers(ctx context.Context) {
+	// holds, scheduled transfers, payment requests, orders and webhooks are only
+	// kept in Postgres, the in-memory audit log is chained as it is written.
+	// Their routes are only registered for Postgres too.
+	if app.cfg.store == "postgres" {
+		app.runPeriodically(ctx, "hold expiry", time.Minute, app.expireHolds)
+		app.runPeriodically(ctx, "payment request expiry", time.Minute, app.expirePaymentRequests)
+		app.runPeriodically(ctx, "order expiry", time.Minute, app.expireOrders)
+		app.runPeriodically(ctx, "webhooks", 10*time.Second, app.dispatchWebhooks)
+		app.runPeriodically(ctx, "scheduled transfers", 30*time.Second, app.runScheduledTransfers)
+		app.runPeriodically(ctx, "audit chain", 5*time.Second, app.chainAuditEvents)
+	}
+}
+
+func (app *application) runPeriodically(ctx context.Context, name string, interval time.Duration, fn func() error) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			app.runJob(name, fn)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (app *application) runJob(name string, fn func() error) {
+	defer func() {
+		if err := recover(); err != nil {
+			app.logger.Error(fmt.Sprintf("%s", err), "job", name)
+		}
+	}()
+
+	err := fn()
+
+	if err != nil {
+		app.logger.Error(err.Error(), "job", name)
+	}
+}
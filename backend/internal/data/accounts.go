@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"sort"
 	"time"
 )
 
@@ -11,52 +12,304 @@ var (
 	ErrDuplicateAccount = errors.New("account already exists")
 	ErrNoAccount = errors.New("account does not exist")
 	ErrInsuffientBalance = errors.New("insufficient funds")
+	ErrAccountFrozen = errors.New("account is frozen")
+	ErrAccountClosed = errors.New("account is closed")
+)
+
+// Statuses of a wallet. A wallet frozen for debits can still receive money,
+// one frozen for all cannot move money at all and a closed one is empty and
+// stays that way until it is opened again.
+const (
+	AccountActive = "active"
+	AccountFrozenDebit = "frozen_debit"
+	AccountFrozenAll = "frozen_all"
+	AccountClosed = "closed"
 )
 
 
+// AccountModel screens transfers with Risk when it is set.
 type AccountModel struct {
 	DB *sql.DB
+	Risk *RiskEngine
 }
 
+// Account is a user's wallet in one currency. Balance is the ledger balance,
+// Held is reserved by active holds and Available is what can still be spent.
 type Account struct {
 	UserID int64 `json:"user_id"`
-	Balance int `json:"balance"`
+	Balance Money `json:"balance"`
+	Held Money `json:"held"`
+	Available Money `json:"available"`
+	Status string `json:"status"`
 	CreatedAt time.Time `json:"created_at"`
+	ClosedAt *time.Time `json:"closed_at,omitempty"`
+}
+
+func (a *Account) setAvailable() {
+	a.Held.Currency = a.Balance.Currency
+	a.Available = Money{Amount: a.Balance.Amount - a.Held.Amount, Currency: a.Balance.Currency}
+}
+
+// checkDebit fails unless money can leave the wallet.
+func (a *Account) checkDebit() error {
+	switch a.Status {
+	case AccountClosed:
+		return ErrAccountClosed
+	case AccountFrozenDebit, AccountFrozenAll:
+		return ErrAccountFrozen
+	}
+
+	return nil
+}
+
+// checkCredit fails unless money can enter the wallet.
+func (a *Account) checkCredit() error {
+	switch a.Status {
+	case AccountClosed:
+		return ErrAccountClosed
+	case AccountFrozenAll:
+		return ErrAccountFrozen
+	}
+
+	return nil
 }
 
-func (m *AccountModel) CreateAccount(user_id int64) error {
+// Transfer moves Amount out of the sender's wallet in Amount.Currency. When
+// Conversion is set the recipient is credited Conversion.Target instead.
+type Transfer struct {
+	JournalID  int64       `json:"transaction_id"`
+	FromUserID int64       `json:"from_user_id"`
+	ToUserID   int64       `json:"to_user_id"`
+	Amount     Money       `json:"amount"`
+	Conversion *Conversion `json:"conversion,omitempty"`
+	RefundOf   *int64      `json:"refund_of,omitempty"`
+	Reference  *string     `json:"reference,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
+
+// Credit is the amount the recipient receives.
+func (t *Transfer) Credit() Money {
+	if t.Conversion != nil {
+		return t.Conversion.Target
+	}
+
+	return t.Amount
+}
+
+type walletKey struct {
+	userID   int64
+	currency string
+}
+
+// CreateAccount opens a wallet, opening a closed wallet again.
+func (m *AccountModel) CreateAccount(user_id int64, currency string) error {
 	query := `
-		INSERT INTO accounts(user_id)
-		VALUES ($1)
+		INSERT INTO accounts(user_id, currency)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id, currency) DO UPDATE
+		SET status = 'active', closed_at = NULL, created_at = NOW()
+		WHERE accounts.status = 'closed'
 	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3 * time.Second)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, user_id)
+	result, err := m.DB.ExecContext(ctx, query, user_id, currency)
 
 	if err != nil {
-		switch {
-		case err.Error() == "pq: duplicate key value violates unique constraint \"accounts_pkey\"":
-			return ErrDuplicateAccount
-		default:
-			return err
-		}
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrDuplicateAccount
 	}
 
 	return nil
 }
 
-func (m *AccountModel) AddMoney(user_id int64,amount int) error {
+func (m *AccountModel) GetAccounts(userID int64) ([]*Account, error) {
 	query := `
-	UPDATE accounts
-	SET balance = balance + $1
-	WHERE user_id = $2`
+		SELECT user_id, balance, held, currency, status, created_at, closed_at
+		FROM accounts
+		WHERE user_id = $1
+		ORDER BY created_at, currency`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3 * time.Second)
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, amount, user_id)
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	accounts := []*Account{}
+
+	for rows.Next() {
+		var account Account
+
+		err = rows.Scan(
+			&account.UserID,
+			&account.Balance.Amount,
+			&account.Held.Amount,
+			&account.Balance.Currency,
+			&account.Status,
+			&account.CreatedAt,
+			&account.ClosedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		account.setAvailable()
+
+		accounts = append(accounts, &account)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return accounts, nil
+}
+
+// SetStatus sets the status of the user's wallet in currency, or of all their
+// open wallets when currency is empty, and returns the wallets it changed.
+// Closed wallets are left alone, they are opened with CreateAccount.
+func (m *AccountModel) SetStatus(userID int64, currency, status string) ([]*Account, error) {
+	query := `
+		UPDATE accounts
+		SET status = $1
+		WHERE user_id = $2 AND (currency = $3 OR $3 = '') AND status <> 'closed'
+		RETURNING user_id, balance, held, currency, status, created_at, closed_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3 * time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, status, userID, currency)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	accounts := []*Account{}
+
+	for rows.Next() {
+		var account Account
+
+		err = rows.Scan(
+			&account.UserID,
+			&account.Balance.Amount,
+			&account.Held.Amount,
+			&account.Balance.Currency,
+			&account.Status,
+			&account.CreatedAt,
+			&account.ClosedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		account.setAvailable()
+
+		accounts = append(accounts, &account)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(accounts) == 0 {
+		return nil, ErrNoAccount
+	}
+
+	return accounts, nil
+}
+
+// lockAccount reads a wallet and locks its row until tx ends.
+func lockAccount(ctx context.Context, tx *sql.Tx, userID int64, currency string) (*Account, error) {
+	query := `
+		SELECT user_id, balance, held, currency, status, created_at, closed_at
+		FROM accounts
+		WHERE user_id = $1 AND currency = $2
+		FOR UPDATE`
+
+	var account Account
+
+	err := tx.QueryRowContext(ctx, query, userID, currency).Scan(
+		&account.UserID,
+		&account.Balance.Amount,
+		&account.Held.Amount,
+		&account.Balance.Currency,
+		&account.Status,
+		&account.CreatedAt,
+		&account.ClosedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNoAccount
+		default:
+			return nil, err
+		}
+	}
+
+	account.setAvailable()
+
+	return &account, nil
+}
+
+// lockAccounts locks several wallets, always in the same order so two
+// transactions locking the same wallets cannot deadlock.
+func lockAccounts(ctx context.Context, tx *sql.Tx, keys ...walletKey) (map[walletKey]*Account, error) {
+	sorted := append([]walletKey(nil), keys...)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].userID != sorted[j].userID {
+			return sorted[i].userID < sorted[j].userID
+		}
+		return sorted[i].currency < sorted[j].currency
+	})
+
+	accounts := make(map[walletKey]*Account)
+
+	for _, key := range sorted {
+		if _, ok := accounts[key]; ok {
+			continue
+		}
+
+		account, err := lockAccount(ctx, tx, key.userID, key.currency)
+
+		if err != nil {
+			return nil, err
+		}
+
+		accounts[key] = account
+	}
+
+	return accounts, nil
+}
+
+func updateBalance(ctx context.Context, tx *sql.Tx, userID int64, amount Money) error {
+	query := `
+		UPDATE accounts
+		SET balance = balance + $1
+		WHERE user_id = $2 AND currency = $3`
+
+	result, err := tx.ExecContext(ctx, query, amount.Amount, userID, amount.Currency)
 
 	if err != nil {
 		return err
@@ -75,24 +328,27 @@ func (m *AccountModel) AddMoney(user_id int64,amount int) error {
 	return nil
 }
 
-func (m *AccountModel) TransferMoney(fromUserID, toUserID int64, amount int) error {
-	
-	toQuery := `
-		UPDATE accounts
-		SET balance = balance + $1
-		WHERE user_id = $2`
+func insertConversion(ctx context.Context, tx *sql.Tx, journalID int64, c *Conversion) error {
+	query := `
+		INSERT INTO fx_conversions (journal_id, source_amount, source_currency, target_amount, target_currency, rate, spread_bps)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	args := []interface{}{
+		journalID,
+		c.Source.Amount,
+		c.Source.Currency,
+		c.Target.Amount,
+		c.Target.Currency,
+		c.Rate,
+		c.SpreadBps,
+	}
 
-	fromQuery := `
-		UPDATE accounts
-		SET balance = balance - $1
-		WHERE user_id = $2`
+	_, err := tx.ExecContext(ctx, query, args...)
 
-	fromBalanceQuery := `
-		SELECT user_id, balance
-		FROM accounts
-		where user_id = $1
-	`
+	return err
+}
 
+func (m *AccountModel) AddMoney(user_id int64, amount Money) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3 * time.Second)
 	defer cancel()
 
@@ -103,59 +359,186 @@ func (m *AccountModel) TransferMoney(fromUserID, toUserID int64, amount int) err
 
 	defer tx.Rollback()
 
-	var fromAccount Account
+	account, err := lockAccount(ctx, tx, user_id, amount.Currency)
 
-	err = tx.QueryRowContext(ctx, fromBalanceQuery, fromUserID).Scan(&fromAccount.UserID, &fromAccount.Balance)
+	if err != nil {
+		return err
+	}
+
+	if err = account.checkCredit(); err != nil {
+		return err
+	}
+
+	if _, err = account.Balance.Add(amount); err != nil {
+		return err
+	}
+
+	limits, err := getLimits(ctx, tx, user_id, amount.Currency, false)
 
 	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return ErrNoAccount
-		default:
-			return err
-		}
+		return err
 	}
 
-	if fromAccount.Balance < amount {
-		return ErrInsuffientBalance
+	err = checkBalanceLimit(limits, account.Balance, amount)
+
+	if err != nil {
+		return err
 	}
 
-	fromResult, err := tx.ExecContext(ctx, fromQuery, amount, fromUserID)
+	err = updateBalance(ctx, tx, user_id, amount)
 
 	if err != nil {
 		return err
 	}
 
-	fromRowsAffected, err := fromResult.RowsAffected()
+	err = insertJournal(ctx, tx, &Journal{
+		Kind: JournalKindTopUp,
+		Postings: []Posting{
+			{UserID: user_id, Amount: amount},
+			{UserID: ExternalAccount, Amount: amount.Neg()},
+		},
+	})
 
 	if err != nil {
 		return err
 	}
 
-	if fromRowsAffected == 0 {
-		return ErrNoAccount
+	return tx.Commit()
+}
+
+// TransferMoney debits the sender, credits the recipient and records the
+// journal. A transfer between currencies goes through the external account,
+// which buys the source currency and sells the target currency. A transfer
+// risk screening holds fails with a TransferHeldError and one it blocks with
+// ErrTransferBlocked, either way the review is recorded.
+func (m *AccountModel) TransferMoney(t *Transfer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3 * time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
 	}
 
-	toResult, err := tx.ExecContext(ctx, toQuery, amount, toUserID)
+	defer tx.Rollback()
+
+	err = screenedTransfer(ctx, tx, m.Risk, JournalKindTransfer, t, nil)
+
+	if err != nil {
+		return commitScreened(tx, err)
+	}
+
+	return tx.Commit()
+}
+
+// executeTransfer performs t as part of tx, spending only the sender's
+// available balance.
+func executeTransfer(ctx context.Context, tx *sql.Tx, kind string, t *Transfer) error {
+	if t.Conversion != nil && t.Conversion.Source != t.Amount {
+		return ErrCurrencyMismatch
+	}
+
+	credit := t.Credit()
+
+	from := walletKey{t.FromUserID, t.Amount.Currency}
+	to := walletKey{t.ToUserID, credit.Currency}
+
+	accounts, err := lockAccounts(ctx, tx, from, to)
+
+	if err != nil {
+		return err
+	}
+
+	// Close checks the status of the wallet it sweeps
+	if kind != JournalKindClosure {
+		if err = accounts[from].checkDebit(); err != nil {
+			return err
+		}
+	}
+
+	if err = accounts[to].checkCredit(); err != nil {
+		return err
+	}
+
+	if accounts[from].Available.Amount < t.Amount.Amount {
+		return ErrInsuffientBalance
+	}
+
+	if _, err = accounts[to].Balance.Add(credit); err != nil {
+		return err
+	}
+
+	// the sender is locked after the wallets, as in every transfer, so that
+	// their limits are checked one transfer at a time in any currency
+	if isLimitedKind(kind) {
+		senderLimits, err := getLimits(ctx, tx, t.FromUserID, t.Amount.Currency, true)
+
+		if err != nil {
+			return err
+		}
+
+		err = checkOutgoingLimits(ctx, tx, t.FromUserID, senderLimits, t.Amount)
+
+		if err != nil {
+			return err
+		}
+
+		recipientLimits, err := getLimits(ctx, tx, t.ToUserID, credit.Currency, false)
+
+		if err != nil {
+			return err
+		}
+
+		err = checkBalanceLimit(recipientLimits, accounts[to].Balance, credit)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	err = updateBalance(ctx, tx, t.FromUserID, t.Amount.Neg())
 
 	if err != nil {
 		return err
 	}
 
-	toRowsAffected, err := toResult.RowsAffected()
+	err = updateBalance(ctx, tx, t.ToUserID, credit)
 
 	if err != nil {
 		return err
 	}
 
-	if toRowsAffected == 0 {
-		return ErrNoAccount
+	postings := []Posting{
+		{UserID: t.FromUserID, Amount: t.Amount.Neg()},
+		{UserID: t.ToUserID, Amount: credit},
+	}
+
+	if t.Conversion != nil {
+		postings = append(postings,
+			Posting{UserID: ExternalAccount, Amount: t.Amount},
+			Posting{UserID: ExternalAccount, Amount: credit.Neg()},
+		)
 	}
 
-	if err = tx.Commit(); err != nil {
+	journal := &Journal{Kind: kind, RefundOf: t.RefundOf, Reference: t.Reference, Postings: postings}
+
+	err = insertJournal(ctx, tx, journal)
+
+	if err != nil {
 		return err
 	}
-	
+
+	if t.Conversion != nil {
+		err = insertConversion(ctx, tx, journal.ID, t.Conversion)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	t.JournalID = journal.ID
+	t.CreatedAt = journal.CreatedAt
+
 	return nil
 }
 
@@ -163,14 +546,15 @@ func (m *AccountModel) CheckIfUserExists(userID int64) (bool, error) {
 	query := `
 		SELECT user_id, balance
 		FROM accounts
-		WHERE user_id = $1`
+		WHERE user_id = $1
+		LIMIT 1`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3 * time.Second)
 	defer cancel()
 
 	var account Account
 
-	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&account.UserID, &account.Balance)
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&account.UserID, &account.Balance.Amount)
 
 	if err != nil {
 		switch {
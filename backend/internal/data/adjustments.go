@@ -0,0 +1,102 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+)
+
+// Adjustment is a correction staff make to a user's balance. A positive
+// amount credits the wallet and a negative one debits it, the external
+// account takes the other side of the journal.
+type Adjustment struct {
+	ID        int64     `json:"id"`
+	JournalID int64     `json:"transaction_id"`
+	UserID    int64     `json:"user_id"`
+	Amount    Money     `json:"amount"`
+	Reason    string    `json:"reason"`
+	CreatedBy int64     `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func ValidateAdjustment(v *validator.Validator, adj *Adjustment) {
+	v.Check(IsSupportedCurrency(adj.Amount.Currency), "amount", "currency is not supported")
+	v.Check(!adj.Amount.IsZero(), "amount", "must not be 0")
+	v.Check(adj.Reason != "", "reason", "must be provided")
+	v.Check(len(adj.Reason) <= 500, "reason", "must not be more than 500 bytes long")
+}
+
+// adjustmentJournal is the journal recording adj.
+func adjustmentJournal(adj *Adjustment) *Journal {
+	return &Journal{
+		Kind: JournalKindAdjustment,
+		Postings: []Posting{
+			{UserID: adj.UserID, Amount: adj.Amount},
+			{UserID: ExternalAccount, Amount: adj.Amount.Neg()},
+		},
+	}
+}
+
+// Adjust applies adj. It works on frozen wallets, not on closed ones, and
+// ignores limits, but a debit cannot take more than the available balance.
+func (m *AccountModel) Adjust(adj *Adjustment) error {
+	query := `
+		INSERT INTO balance_adjustments (journal_id, user_id, amount, currency, reason, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	account, err := lockAccount(ctx, tx, adj.UserID, adj.Amount.Currency)
+
+	if err != nil {
+		return err
+	}
+
+	if account.Status == AccountClosed {
+		return ErrAccountClosed
+	}
+
+	if account.Available.Amount+adj.Amount.Amount < 0 && adj.Amount.IsNegative() {
+		return ErrInsuffientBalance
+	}
+
+	if _, err = account.Balance.Add(adj.Amount); err != nil {
+		return err
+	}
+
+	err = updateBalance(ctx, tx, adj.UserID, adj.Amount)
+
+	if err != nil {
+		return err
+	}
+
+	journal := adjustmentJournal(adj)
+
+	err = insertJournal(ctx, tx, journal)
+
+	if err != nil {
+		return err
+	}
+
+	adj.JournalID = journal.ID
+
+	args := []interface{}{adj.JournalID, adj.UserID, adj.Amount.Amount, adj.Amount.Currency, adj.Reason, adj.CreatedBy}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&adj.ID, &adj.CreatedAt)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,637 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+)
+
+// Audit actions. Journals are audited as "ledger." followed by their kind.
+const (
+	AuditSignIn               = "auth.sign_in"
+	AuditSignInFailed         = "auth.sign_in_failed"
+	AuditSignOut              = "auth.sign_out"
+	AuditSignUp               = "user.sign_up"
+	AuditUserUpdate           = "user.update"
+	AuditAccountCreate        = "account.create"
+	AuditTopUp                = "account.top_up"
+	AuditTransfer             = "transfer.create"
+	AuditReviewRelease        = "risk_review.release"
+	AuditReviewReject         = "risk_review.reject"
+	AuditAPIKeyCreate         = "api_key.create"
+	AuditAPIKeyRevoke         = "api_key.revoke"
+	AuditWebhookCreate        = "webhook.create"
+	AuditWebhookDisable       = "webhook.disable"
+	AuditRoleChange           = "user.role_change"
+	AuditPasswordReset        = "user.password_reset"
+	AuditPasswordResetRequest = "user.password_reset_request"
+	AuditUserUnlock           = "user.unlock"
+	AuditContactVerify        = "user.contact_verify"
+	AuditAccountFreeze        = "account.freeze"
+	AuditAccountUnfreeze      = "account.unfreeze"
+	AuditAccountClose         = "account.close"
+	AuditMFAEnable            = "mfa.enable"
+	AuditMFADisable           = "mfa.disable"
+	AuditMFAFailed            = "auth.mfa_failed"
+	AuditBalanceAdjust        = "account.adjust"
+	AuditPINSet               = "pin.set"
+	AuditPINChange            = "pin.change"
+	AuditPINReset             = "pin.reset"
+	AuditPINFailed            = "auth.pin_failed"
+)
+
+// auditChainLock is the advisory lock held while events are chained, so that
+// only one transaction extends the chain at a time.
+const auditChainLock = 7405186
+
+// AuditEvent is one entry of the audit log. Before and After are the values
+// the action changed, ActorID is empty for what the system does by itself.
+// Seq, PrevHash and Hash are set once the event is chained.
+type AuditEvent struct {
+	ID         int64       `json:"id"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	ActorID    *int64      `json:"actor_id,omitempty"`
+	Action     string      `json:"action"`
+	TargetType string      `json:"target_type,omitempty"`
+	TargetID   string      `json:"target_id,omitempty"`
+	IP         string      `json:"ip,omitempty"`
+	UserAgent  string      `json:"user_agent,omitempty"`
+	RequestID  string      `json:"request_id,omitempty"`
+	Before     interface{} `json:"before,omitempty"`
+	After      interface{} `json:"after,omitempty"`
+	Seq        *int64      `json:"seq,omitempty"`
+	PrevHash   string      `json:"prev_hash,omitempty"`
+	Hash       string      `json:"hash,omitempty"`
+}
+
+// auditHashInput is what an event's hash covers.
+type auditHashInput struct {
+	Seq        int64           `json:"seq"`
+	PrevHash   string          `json:"prev_hash"`
+	ID         int64           `json:"id"`
+	OccurredAt string          `json:"occurred_at"`
+	ActorID    *int64          `json:"actor_id"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	IP         string          `json:"ip"`
+	UserAgent  string          `json:"user_agent"`
+	RequestID  string          `json:"request_id"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+}
+
+func auditJSON(v interface{}) (json.RawMessage, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case json.RawMessage:
+		return v, nil
+	default:
+		return json.Marshal(v)
+	}
+}
+
+// hash works out the hash of e as the seq-th event of the chain, following
+// the event hashed prevHash.
+func (e *AuditEvent) hash(seq int64, prevHash string) (string, error) {
+	before, err := auditJSON(e.Before)
+
+	if err != nil {
+		return "", err
+	}
+
+	after, err := auditJSON(e.After)
+
+	if err != nil {
+		return "", err
+	}
+
+	b, err := json.Marshal(auditHashInput{
+		Seq:        seq,
+		PrevHash:   prevHash,
+		ID:         e.ID,
+		OccurredAt: e.OccurredAt.UTC().Format(time.RFC3339Nano),
+		ActorID:    e.ActorID,
+		Action:     e.Action,
+		TargetType: e.TargetType,
+		TargetID:   e.TargetID,
+		IP:         e.IP,
+		UserAgent:  e.UserAgent,
+		RequestID:  e.RequestID,
+		Before:     before,
+		After:      after,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AuditVerification is the result of checking the chain. BrokenAt is the seq
+// of the first event that does not match the chain.
+type AuditVerification struct {
+	Checked   int64  `json:"checked"`
+	Valid     bool   `json:"valid"`
+	BrokenAt  *int64 `json:"broken_at,omitempty"`
+	Unchained int64  `json:"unchained"`
+}
+
+// auditVerifier checks chained events one at a time in seq order.
+type auditVerifier struct {
+	result   AuditVerification
+	prevHash string
+}
+
+func (v *auditVerifier) check(e *AuditEvent) error {
+	if !v.result.Valid {
+		return nil
+	}
+
+	seq := v.result.Checked + 1
+
+	hash, err := e.hash(seq, v.prevHash)
+
+	if err != nil {
+		return err
+	}
+
+	if e.Seq == nil || *e.Seq != seq || e.PrevHash != v.prevHash || e.Hash != hash {
+		v.result.Valid = false
+		v.result.BrokenAt = &seq
+		return nil
+	}
+
+	v.result.Checked++
+	v.prevHash = e.Hash
+
+	return nil
+}
+
+type AuditFilters struct {
+	Cursor     int64
+	PageSize   int
+	ActorID    int64
+	Action     string
+	TargetType string
+	TargetID   string
+	From       *time.Time
+	To         *time.Time
+}
+
+func ValidateAuditFilters(v *validator.Validator, f AuditFilters) {
+	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
+	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
+	v.Check(f.ActorID >= 0, "actor_id", "must not be negative")
+	v.Check(f.TargetID == "" || f.TargetType != "", "target_type", "must be provided with target_id")
+
+	if f.From != nil && f.To != nil {
+		v.Check(!f.To.Before(*f.From), "to", "must not be before from")
+	}
+}
+
+// matches tells whether e passes the filters other than the page.
+func (f AuditFilters) matches(e *AuditEvent) bool {
+	switch {
+	case f.Cursor != 0 && e.ID >= f.Cursor:
+		return false
+	case f.ActorID != 0 && (e.ActorID == nil || *e.ActorID != f.ActorID):
+		return false
+	case f.Action != "" && e.Action != f.Action:
+		return false
+	case f.TargetType != "" && e.TargetType != f.TargetType:
+		return false
+	case f.TargetID != "" && e.TargetID != f.TargetID:
+		return false
+	case f.From != nil && e.OccurredAt.Before(*f.From):
+		return false
+	case f.To != nil && e.OccurredAt.After(*f.To):
+		return false
+	}
+
+	return true
+}
+
+type AuditModel struct {
+	DB *sql.DB
+}
+
+// lastAuditLink returns the seq and hash of the end of the chain, zero and
+// empty when nothing is chained yet. The caller holds auditChainLock.
+func lastAuditLink(ctx context.Context, tx *sql.Tx) (int64, string, error) {
+	query := `
+		SELECT seq, hash
+		FROM audit_events
+		WHERE seq IS NOT NULL
+		ORDER BY seq DESC
+		LIMIT 1`
+
+	var (
+		seq  int64
+		hash string
+	)
+
+	err := tx.QueryRowContext(ctx, query).Scan(&seq, &hash)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, "", err
+	}
+
+	return seq, hash, nil
+}
+
+// insertAuditEvent appends e to the audit log and chains it as part of tx.
+// auditChainLock is held until tx ends, so an event is never committed
+// without its hash.
+func insertAuditEvent(ctx context.Context, tx *sql.Tx, e *AuditEvent) error {
+	query := `
+		INSERT INTO audit_events (actor_id, action, target_type, target_id, ip, user_agent, request_id, before, after)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, occurred_at, before, after`
+
+	chainQuery := `
+		UPDATE audit_events
+		SET seq = $1, prev_hash = $2, hash = $3
+		WHERE id = $4`
+
+	before, err := auditJSON(e.Before)
+
+	if err != nil {
+		return err
+	}
+
+	after, err := auditJSON(e.After)
+
+	if err != nil {
+		return err
+	}
+
+	// a nil RawMessage is stored as NULL, not as the JSON null
+	args := []interface{}{
+		e.ActorID, e.Action, e.TargetType, e.TargetID, e.IP, e.UserAgent, e.RequestID,
+		[]byte(before), []byte(after),
+	}
+
+	_, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, auditChainLock)
+
+	if err != nil {
+		return err
+	}
+
+	var storedBefore, storedAfter []byte
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&e.ID, &e.OccurredAt, &storedBefore, &storedAfter)
+
+	if err != nil {
+		return err
+	}
+
+	seq, prevHash, err := lastAuditLink(ctx, tx)
+
+	if err != nil {
+		return err
+	}
+
+	seq++
+
+	// the hash covers the JSON as Postgres stores it, which is what Verify
+	// reads back
+	stored := *e
+	stored.Before, stored.After = nil, nil
+
+	if storedBefore != nil {
+		stored.Before = json.RawMessage(storedBefore)
+	}
+
+	if storedAfter != nil {
+		stored.After = json.RawMessage(storedAfter)
+	}
+
+	hash, err := stored.hash(seq, prevHash)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, chainQuery, seq, prevHash, hash, e.ID)
+
+	if err != nil {
+		return err
+	}
+
+	e.Seq = &seq
+	e.PrevHash = prevHash
+	e.Hash = hash
+
+	return nil
+}
+
+// insertJournalAudit records a journal in the audit log.
+func insertJournalAudit(ctx context.Context, tx *sql.Tx, journal *Journal) error {
+	return insertAuditEvent(ctx, tx, &AuditEvent{
+		Action:     "ledger." + journal.Kind,
+		TargetType: "journal",
+		TargetID:   strconv.FormatInt(journal.ID, 10),
+		After:      journal,
+	})
+}
+
+const auditEventColumns = `
+	id, occurred_at, actor_id, action, target_type, target_id, ip, user_agent, request_id,
+	before, after, seq, COALESCE(prev_hash, ''), COALESCE(hash, '')`
+
+func scanAuditEvent(row rowScanner) (*AuditEvent, error) {
+	var (
+		e             AuditEvent
+		before, after []byte
+	)
+
+	err := row.Scan(
+		&e.ID,
+		&e.OccurredAt,
+		&e.ActorID,
+		&e.Action,
+		&e.TargetType,
+		&e.TargetID,
+		&e.IP,
+		&e.UserAgent,
+		&e.RequestID,
+		&before,
+		&after,
+		&e.Seq,
+		&e.PrevHash,
+		&e.Hash,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if before != nil {
+		e.Before = json.RawMessage(before)
+	}
+
+	if after != nil {
+		e.After = json.RawMessage(after)
+	}
+
+	return &e, nil
+}
+
+func (m *AuditModel) Insert(e *AuditEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	err = insertAuditEvent(ctx, tx, e)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetAll lists the events that pass the filters, newest first.
+func (m *AuditModel) GetAll(filters AuditFilters) ([]*AuditEvent, CursorMetadata, error) {
+	query := `
+		SELECT ` + auditEventColumns + `
+		FROM audit_events
+		WHERE ($1::bigint = 0 OR id < $1)
+		AND ($2::bigint = 0 OR actor_id = $2)
+		AND ($3 = '' OR action = $3)
+		AND ($4 = '' OR target_type = $4)
+		AND ($5 = '' OR target_id = $5)
+		AND ($6::timestamptz IS NULL OR occurred_at >= $6)
+		AND ($7::timestamptz IS NULL OR occurred_at <= $7)
+		ORDER BY id DESC
+		LIMIT $8`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var from, to sql.NullTime
+
+	if filters.From != nil {
+		from = sql.NullTime{Time: *filters.From, Valid: true}
+	}
+
+	if filters.To != nil {
+		to = sql.NullTime{Time: *filters.To, Valid: true}
+	}
+
+	// fetch one extra row to find out whether there is a next page
+	args := []interface{}{
+		filters.Cursor,
+		filters.ActorID,
+		filters.Action,
+		filters.TargetType,
+		filters.TargetID,
+		from,
+		to,
+		filters.PageSize + 1,
+	}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+
+	if err != nil {
+		return nil, CursorMetadata{}, err
+	}
+
+	defer rows.Close()
+
+	events := []*AuditEvent{}
+
+	for rows.Next() {
+		e, err := scanAuditEvent(rows)
+
+		if err != nil {
+			return nil, CursorMetadata{}, err
+		}
+
+		events = append(events, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, CursorMetadata{}, err
+	}
+
+	metadata := CursorMetadata{PageSize: filters.PageSize}
+
+	if len(events) > filters.PageSize {
+		events = events[:filters.PageSize]
+		metadata.NextCursor = EncodeCursor(events[len(events)-1].ID)
+	}
+
+	return events, metadata, nil
+}
+
+// Chain links up to limit events that are not chained yet onto the end of
+// the chain, in the order they were inserted, and returns how many it
+// chained. Events are chained as they are inserted, so only those inserted
+// before that are left for it.
+func (m *AuditModel) Chain(limit int) (int, error) {
+	pendingQuery := `
+		SELECT ` + auditEventColumns + `
+		FROM audit_events
+		WHERE seq IS NULL
+		ORDER BY id
+		LIMIT $1`
+
+	updateQuery := `
+		UPDATE audit_events
+		SET seq = $1, prev_hash = $2, hash = $3
+		WHERE id = $4`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, auditChainLock)
+
+	if err != nil {
+		return 0, err
+	}
+
+	seq, prevHash, err := lastAuditLink(ctx, tx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := tx.QueryContext(ctx, pendingQuery, limit)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var pending []*AuditEvent
+
+	for rows.Next() {
+		e, err := scanAuditEvent(rows)
+
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		pending = append(pending, e)
+	}
+
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, e := range pending {
+		seq++
+
+		hash, err := e.hash(seq, prevHash)
+
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = tx.ExecContext(ctx, updateQuery, seq, prevHash, hash, e.ID)
+
+		if err != nil {
+			return 0, err
+		}
+
+		prevHash = hash
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(pending), nil
+}
+
+// Verify recomputes the whole chain and reports the first event that was
+// changed, removed or inserted out of turn.
+func (m *AuditModel) Verify() (*AuditVerification, error) {
+	chainQuery := `
+		SELECT ` + auditEventColumns + `
+		FROM audit_events
+		WHERE seq IS NOT NULL
+		ORDER BY seq`
+
+	unchainedQuery := `
+		SELECT COUNT(*)
+		FROM audit_events
+		WHERE seq IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	verifier := auditVerifier{result: AuditVerification{Valid: true}}
+
+	err = tx.QueryRowContext(ctx, unchainedQuery).Scan(&verifier.result.Unchained)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, chainQuery)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanAuditEvent(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err = verifier.check(e); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &verifier.result, nil
+}
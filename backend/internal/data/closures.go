@@ -0,0 +1,154 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/fx"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+)
+
+var (
+	ErrBalanceNotZero = errors.New("account balance must be zero or swept to another account")
+	ErrFundsHeld      = errors.New("account has funds on hold")
+)
+
+// Closure closes a user's wallet. What is left in it is swept to the wallet
+// of SweepToUserID in SweepToCurrency, converted at Rate when the currencies
+// differ, without a sweep the wallet must already be empty. Only staff close
+// frozen wallets, with AllowFrozen.
+type Closure struct {
+	UserID          int64
+	Currency        string
+	SweepToUserID   int64
+	SweepToCurrency string
+	Rate            *fx.Rate
+	SpreadBps       int
+	AllowFrozen     bool
+
+	Account *Account
+	Sweep   *Transfer
+}
+
+func (c *Closure) sweeps() bool {
+	return c.SweepToUserID != 0
+}
+
+func ValidateClosure(v *validator.Validator, c *Closure) {
+	v.Check(IsSupportedCurrency(c.Currency), "currency", "is not supported")
+
+	if c.sweeps() {
+		v.Check(IsSupportedCurrency(c.SweepToCurrency), "sweep_to_currency", "is not supported")
+		v.Check(c.SweepToUserID != c.UserID || c.SweepToCurrency != c.Currency, "sweep_to_currency", "must not be the account being closed")
+	}
+}
+
+// check fails unless account can be closed.
+func (c *Closure) check(account *Account) error {
+	switch {
+	case account.Status == AccountClosed:
+		return ErrAccountClosed
+	case account.Status != AccountActive && !c.AllowFrozen:
+		return ErrAccountFrozen
+	case account.Held.Amount != 0:
+		return ErrFundsHeld
+	case account.Balance.Amount != 0 && !c.sweeps():
+		return ErrBalanceNotZero
+	}
+
+	return nil
+}
+
+// sweep is the transfer emptying a wallet holding balance.
+func (c *Closure) sweep(balance Money) (*Transfer, error) {
+	transfer := &Transfer{
+		FromUserID: c.UserID,
+		ToUserID:   c.SweepToUserID,
+		Amount:     balance,
+	}
+
+	if c.SweepToCurrency != balance.Currency {
+		if c.Rate == nil || c.Rate.To != c.SweepToCurrency {
+			return nil, ErrCurrencyMismatch
+		}
+
+		conversion, err := NewConversion(balance, *c.Rate, c.SpreadBps)
+
+		if err != nil {
+			return nil, err
+		}
+
+		transfer.Conversion = conversion
+	}
+
+	return transfer, nil
+}
+
+// Close closes the wallet c names, sweeping its balance first. The sweep is
+// not bound by limits or risk screening, it only moves money the user
+// already has to a wallet staff or the user nominated.
+func (m *AccountModel) Close(c *Closure) error {
+	query := `
+		UPDATE accounts
+		SET status = 'closed', closed_at = NOW()
+		WHERE user_id = $1 AND currency = $2
+		RETURNING closed_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	key := walletKey{c.UserID, c.Currency}
+	keys := []walletKey{key}
+
+	if c.sweeps() {
+		keys = append(keys, walletKey{c.SweepToUserID, c.SweepToCurrency})
+	}
+
+	accounts, err := lockAccounts(ctx, tx, keys...)
+
+	if err != nil {
+		return err
+	}
+
+	account := accounts[key]
+
+	if err = c.check(account); err != nil {
+		return err
+	}
+
+	if account.Balance.IsPositive() {
+		c.Sweep, err = c.sweep(account.Balance)
+
+		if err != nil {
+			return err
+		}
+
+		err = executeTransfer(ctx, tx, JournalKindClosure, c.Sweep)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.QueryRowContext(ctx, query, c.UserID, c.Currency).Scan(&account.ClosedAt)
+
+	if err != nil {
+		return err
+	}
+
+	account.Status = AccountClosed
+	account.Balance.Amount = 0
+	account.setAvailable()
+
+	c.Account = account
+
+	return tx.Commit()
+}
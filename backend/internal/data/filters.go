@@ -0,0 +1,77 @@
+package data
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+const (
+	DirectionCredit = "credit"
+	DirectionDebit  = "debit"
+)
+
+type TransactionFilters struct {
+	Cursor    int64
+	PageSize  int
+	From      *time.Time
+	To        *time.Time
+	Direction string
+	Currency  string
+	MinAmount Money
+	MaxAmount Money
+}
+
+type CursorMetadata struct {
+	PageSize   int    `json:"page_size"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+func ValidateTransactionFilters(v *validator.Validator, f TransactionFilters) {
+	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
+	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
+
+	v.Check(f.Direction == "" || f.Direction == DirectionCredit || f.Direction == DirectionDebit, "direction", "must be credit or debit")
+
+	v.Check(f.Currency == "" || IsSupportedCurrency(f.Currency), "currency", "is not supported")
+
+	v.Check(!f.MinAmount.IsNegative(), "min_amount", "must not be negative")
+	v.Check(!f.MaxAmount.IsNegative(), "max_amount", "must not be negative")
+
+	if f.MinAmount.IsPositive() && f.MaxAmount.IsPositive() {
+		v.Check(f.MinAmount.Amount <= f.MaxAmount.Amount, "max_amount", "must not be less than min_amount")
+	}
+
+	if f.From != nil && f.To != nil {
+		v.Check(!f.To.Before(*f.From), "to", "must not be before from")
+	}
+}
+
+// EncodeCursor turns the id of the last item on a page into an opaque token
+// clients pass back to fetch the next page.
+func EncodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func DecodeCursor(cursor string) (int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+
+	id, err := strconv.ParseInt(string(b), 10, 64)
+
+	if err != nil || id < 1 {
+		return 0, ErrInvalidCursor
+	}
+
+	return id, nil
+}
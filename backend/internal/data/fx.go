@@ -0,0 +1,83 @@
+package data
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/fx"
+)
+
+var (
+	ErrConversionTooSmall = errors.New("amount is too small to convert")
+)
+
+// rates are rounded to this many decimal places before converting, so the
+// recorded rate reproduces the converted amount exactly
+const rateDecimals = 10
+
+// Conversion records how the amount debited from the sender was turned into
+// the amount credited to the recipient.
+type Conversion struct {
+	Rate      string `json:"rate"`
+	SpreadBps int    `json:"spread_bps"`
+	Source    Money  `json:"source"`
+	Target    Money  `json:"target"`
+}
+
+// NewConversion converts source at rate, keeping spreadBps basis points of
+// the converted value as the platform's margin. The result is rounded down to
+// the target currency's minor unit.
+func NewConversion(source Money, rate fx.Rate, spreadBps int) (*Conversion, error) {
+	if rate.From != source.Currency {
+		return nil, ErrCurrencyMismatch
+	}
+
+	sourceExp, err := CurrencyExponent(rate.From)
+
+	if err != nil {
+		return nil, err
+	}
+
+	targetExp, err := CurrencyExponent(rate.To)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if spreadBps < 0 || spreadBps >= 10_000 {
+		return nil, fx.ErrInvalidRate
+	}
+
+	rounded := rate.Value.FloatString(rateDecimals)
+	value, _ := new(big.Rat).SetString(rounded)
+
+	if value.Sign() <= 0 {
+		return nil, fx.ErrInvalidRate
+	}
+
+	target := new(big.Rat).SetInt64(source.Amount)
+	target.Mul(target, value)
+	target.Mul(target, big.NewRat(int64(10_000-spreadBps), 10_000))
+	target.Mul(target, new(big.Rat).SetFrac(pow10(targetExp), pow10(sourceExp)))
+
+	amount := new(big.Int).Quo(target.Num(), target.Denom())
+
+	if !amount.IsInt64() {
+		return nil, ErrAmountOverflow
+	}
+
+	if amount.Sign() <= 0 {
+		return nil, ErrConversionTooSmall
+	}
+
+	return &Conversion{
+		Rate:      rounded,
+		SpreadBps: spreadBps,
+		Source:    source,
+		Target:    Money{Amount: amount.Int64(), Currency: rate.To},
+	}, nil
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
@@ -0,0 +1,634 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrUnknownMember            = errors.New("group member does not exist")
+	ErrSettlementExceedsBalance = errors.New("settlement exceeds what is owed")
+)
+
+const MaxGroupMembers = 50
+
+// GroupModel screens settlements with Risk when it is set.
+type GroupModel struct {
+	DB   *sql.DB
+	Risk *RiskEngine
+}
+
+// Group is a set of users sharing expenses in one currency.
+type Group struct {
+	ID        int64          `json:"id"`
+	Name      string         `json:"name"`
+	Currency  string         `json:"currency"`
+	CreatedBy int64          `json:"created_by"`
+	CreatedAt time.Time      `json:"created_at"`
+	Members   []*GroupMember `json:"members,omitempty"`
+}
+
+type GroupMember struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// IsMember reports whether the user belongs to the group, the group must have
+// been read with its members.
+func (g *Group) IsMember(userID int64) bool {
+	for _, m := range g.Members {
+		if m.UserID == userID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Expense is paid by one member and shared by the members in Shares.
+type Expense struct {
+	ID          int64          `json:"id"`
+	GroupID     int64          `json:"group_id"`
+	PaidBy      int64          `json:"paid_by"`
+	Amount      Money          `json:"amount"`
+	Description string         `json:"description"`
+	Split       string         `json:"split"`
+	Shares      []ExpenseShare `json:"shares"`
+	CreatedBy   int64          `json:"created_by"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+type ExpenseShare struct {
+	UserID int64 `json:"user_id"`
+	Amount Money `json:"amount"`
+}
+
+// MemberBalance is what the group owes a member, negative when the member
+// owes the group.
+type MemberBalance struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Balance  Money  `json:"balance"`
+}
+
+// Settlement is a transfer between members that pays off group debt.
+type Settlement struct {
+	ID         int64     `json:"id"`
+	GroupID    int64     `json:"group_id"`
+	FromUserID int64     `json:"from_user_id"`
+	ToUserID   int64     `json:"to_user_id"`
+	Amount     Money     `json:"amount"`
+	JournalID  int64     `json:"transaction_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func ValidateGroup(v *validator.Validator, group *Group, usernames []string) {
+	v.ValidateEmpty(group.Name, "name")
+	v.Check(len(group.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(IsSupportedCurrency(group.Currency), "currency", "is not supported")
+	v.Check(len(usernames) < MaxGroupMembers, "members", "must be fewer than 50")
+
+	for _, username := range usernames {
+		v.Check(username != "", "members", "must not contain empty usernames")
+	}
+}
+
+// ValidateExpense checks the expense against the group it is added to.
+func ValidateExpense(v *validator.Validator, expense *Expense, group *Group) {
+	ValidateMoney(v, "amount", expense.Amount)
+	v.Check(expense.Amount.Currency == group.Currency, "amount", "must be in the currency of the group")
+	v.Check(len(expense.Description) <= 280, "description", "must not be more than 280 bytes long")
+	v.Check(group.IsMember(expense.PaidBy), "paid_by", "must be a member of the group")
+	v.Check(len(expense.Shares) > 0, "shares", "must be provided")
+
+	seen := make(map[int64]bool)
+	total := Money{Currency: expense.Amount.Currency}
+
+	for _, share := range expense.Shares {
+		v.Check(group.IsMember(share.UserID), "shares", "must only include members of the group")
+		v.Check(!seen[share.UserID], "shares", "must not include a member twice")
+		v.Check(!share.Amount.IsNegative(), "shares", "must not be negative")
+
+		seen[share.UserID] = true
+
+		var err error
+
+		if total, err = total.Add(share.Amount); err != nil {
+			v.AddError("shares", "must be in the currency of the group")
+			return
+		}
+	}
+
+	v.Check(total == expense.Amount, "shares", "must add up to the amount")
+}
+
+// Insert creates the group with its creator and the users named in usernames
+// as members. It fails with ErrUnknownMember when a username does not exist.
+func (m *GroupModel) Insert(group *Group, usernames []string) error {
+	usersQuery := `
+		SELECT id, username
+		FROM users
+		WHERE username = ANY($1) OR id = $2`
+
+	groupQuery := `
+		INSERT INTO groups (name, currency, created_by)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`
+
+	memberQuery := `
+		INSERT INTO group_members (group_id, user_id)
+		VALUES ($1, $2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, usersQuery, pq.Array(usernames), group.CreatedBy)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	var members []*GroupMember
+	found := make(map[string]bool)
+
+	for rows.Next() {
+		var member GroupMember
+
+		if err = rows.Scan(&member.UserID, &member.Username); err != nil {
+			return err
+		}
+
+		found[member.Username] = true
+		members = append(members, &member)
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, username := range usernames {
+		if !found[username] {
+			return ErrUnknownMember
+		}
+	}
+
+	err = tx.QueryRowContext(ctx, groupQuery, group.Name, group.Currency, group.CreatedBy).Scan(&group.ID, &group.CreatedAt)
+
+	if err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		_, err = tx.ExecContext(ctx, memberQuery, group.ID, member.UserID)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Username < members[j].Username
+	})
+
+	group.Members = members
+
+	return nil
+}
+
+// Get returns the group together with its members.
+func (m *GroupModel) Get(id int64) (*Group, error) {
+	groupQuery := `
+		SELECT id, name, currency, created_by, created_at
+		FROM groups
+		WHERE id = $1`
+
+	membersQuery := `
+		SELECT users.id, users.username
+		FROM group_members
+		INNER JOIN users ON users.id = group_members.user_id
+		WHERE group_members.group_id = $1
+		ORDER BY users.username`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var group Group
+
+	err := m.DB.QueryRowContext(ctx, groupQuery, id).Scan(&group.ID, &group.Name, &group.Currency, &group.CreatedBy, &group.CreatedAt)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	rows, err := m.DB.QueryContext(ctx, membersQuery, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var member GroupMember
+
+		if err = rows.Scan(&member.UserID, &member.Username); err != nil {
+			return nil, err
+		}
+
+		group.Members = append(group.Members, &member)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &group, nil
+}
+
+// GetAllForUser lists the groups the user is a member of, without members.
+func (m *GroupModel) GetAllForUser(userID int64) ([]*Group, error) {
+	query := `
+		SELECT groups.id, groups.name, groups.currency, groups.created_by, groups.created_at
+		FROM groups
+		INNER JOIN group_members ON group_members.group_id = groups.id
+		WHERE group_members.user_id = $1
+		ORDER BY groups.id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	groups := []*Group{}
+
+	for rows.Next() {
+		var group Group
+
+		err = rows.Scan(&group.ID, &group.Name, &group.Currency, &group.CreatedBy, &group.CreatedAt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		groups = append(groups, &group)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+func (m *GroupModel) AddExpense(expense *Expense) error {
+	expenseQuery := `
+		INSERT INTO group_expenses (group_id, paid_by, amount, description, split, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+
+	shareQuery := `
+		INSERT INTO group_expense_shares (expense_id, user_id, amount)
+		VALUES ($1, $2, $3)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	args := []interface{}{
+		expense.GroupID,
+		expense.PaidBy,
+		expense.Amount.Amount,
+		expense.Description,
+		expense.Split,
+		expense.CreatedBy,
+	}
+
+	err = tx.QueryRowContext(ctx, expenseQuery, args...).Scan(&expense.ID, &expense.CreatedAt)
+
+	if err != nil {
+		return err
+	}
+
+	for _, share := range expense.Shares {
+		_, err = tx.ExecContext(ctx, shareQuery, expense.ID, share.UserID, share.Amount.Amount)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetExpenses returns the expenses of the group with their shares, latest
+// first.
+func (m *GroupModel) GetExpenses(groupID int64) ([]*Expense, error) {
+	query := `
+		SELECT group_expenses.id, group_expenses.group_id, group_expenses.paid_by, group_expenses.amount,
+			groups.currency, group_expenses.description, group_expenses.split, group_expenses.created_by,
+			group_expenses.created_at, group_expense_shares.user_id, group_expense_shares.amount
+		FROM group_expenses
+		INNER JOIN groups ON groups.id = group_expenses.group_id
+		INNER JOIN group_expense_shares ON group_expense_shares.expense_id = group_expenses.id
+		WHERE group_expenses.group_id = $1
+		ORDER BY group_expenses.id DESC, group_expense_shares.user_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, groupID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	expenses := []*Expense{}
+
+	for rows.Next() {
+		var (
+			e     Expense
+			share ExpenseShare
+		)
+
+		err = rows.Scan(
+			&e.ID,
+			&e.GroupID,
+			&e.PaidBy,
+			&e.Amount.Amount,
+			&e.Amount.Currency,
+			&e.Description,
+			&e.Split,
+			&e.CreatedBy,
+			&e.CreatedAt,
+			&share.UserID,
+			&share.Amount.Amount,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		share.Amount.Currency = e.Amount.Currency
+
+		if n := len(expenses); n == 0 || expenses[n-1].ID != e.ID {
+			expenses = append(expenses, &e)
+		}
+
+		last := expenses[len(expenses)-1]
+		last.Shares = append(last.Shares, share)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return expenses, nil
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// groupBalances works out every member's balance as what they paid for
+// expenses and in settlements, less their shares and the settlements they
+// received.
+func groupBalances(ctx context.Context, q queryer, groupID int64) ([]*MemberBalance, error) {
+	query := `
+		SELECT users.id, users.username, groups.currency,
+			COALESCE((
+				SELECT SUM(amount) FROM group_expenses
+				WHERE group_id = groups.id AND paid_by = users.id
+			), 0)
+			- COALESCE((
+				SELECT SUM(group_expense_shares.amount) FROM group_expense_shares
+				INNER JOIN group_expenses ON group_expenses.id = group_expense_shares.expense_id
+				WHERE group_expenses.group_id = groups.id AND group_expense_shares.user_id = users.id
+			), 0)
+			+ COALESCE((
+				SELECT SUM(amount) FROM group_settlements
+				WHERE group_id = groups.id AND from_user_id = users.id
+			), 0)
+			- COALESCE((
+				SELECT SUM(amount) FROM group_settlements
+				WHERE group_id = groups.id AND to_user_id = users.id
+			), 0)
+		FROM groups
+		INNER JOIN group_members ON group_members.group_id = groups.id
+		INNER JOIN users ON users.id = group_members.user_id
+		WHERE groups.id = $1
+		ORDER BY users.username`
+
+	rows, err := q.QueryContext(ctx, query, groupID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	balances := []*MemberBalance{}
+
+	for rows.Next() {
+		var b MemberBalance
+
+		err = rows.Scan(&b.UserID, &b.Username, &b.Balance.Currency, &b.Balance.Amount)
+
+		if err != nil {
+			return nil, err
+		}
+
+		balances = append(balances, &b)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return balances, nil
+}
+
+// Owed is the most fromUserID can settle with toUserID, the lesser of what
+// the payer owes and what the recipient is owed. It fails with
+// ErrSettlementExceedsBalance when there is nothing to settle.
+func Owed(balances []*MemberBalance, fromUserID, toUserID int64) (Money, error) {
+	var from, to *MemberBalance
+
+	for _, b := range balances {
+		switch b.UserID {
+		case fromUserID:
+			from = b
+		case toUserID:
+			to = b
+		}
+	}
+
+	if from == nil || to == nil {
+		return Money{}, ErrRecordNotFound
+	}
+
+	owed := Money{Amount: min(-from.Balance.Amount, to.Balance.Amount), Currency: from.Balance.Currency}
+
+	if !owed.IsPositive() {
+		return Money{}, ErrSettlementExceedsBalance
+	}
+
+	return owed, nil
+}
+
+func (m *GroupModel) Balances(groupID int64) ([]*MemberBalance, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return groupBalances(ctx, m.DB, groupID)
+}
+
+// Settle pays group debt from one member to another with a transfer. The
+// amount is bounded by what the payer owes and what the recipient is owed,
+// without one the largest such amount is paid. A settlement risk screening
+// holds is recorded when its review is released.
+func (m *GroupModel) Settle(groupID, fromUserID, toUserID int64, amount *Money) (*Settlement, *Transfer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer tx.Rollback()
+
+	settlement, transfer, err := settle(ctx, tx, m.Risk, groupID, fromUserID, toUserID, amount)
+
+	if err != nil {
+		return nil, nil, commitScreened(tx, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	return settlement, transfer, nil
+}
+
+func settle(ctx context.Context, tx *sql.Tx, engine *RiskEngine, groupID, fromUserID, toUserID int64, amount *Money) (*Settlement, *Transfer, error) {
+	lockQuery := `
+		SELECT id
+		FROM groups
+		WHERE id = $1
+		FOR UPDATE`
+
+	settlementQuery := `
+		INSERT INTO group_settlements (group_id, from_user_id, to_user_id, amount, journal_id)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	// settlements of a group are serialized so balances cannot be paid twice
+	err := tx.QueryRowContext(ctx, lockQuery, groupID).Scan(&groupID)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+
+	balances, err := groupBalances(ctx, tx, groupID)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	owed, err := Owed(balances, fromUserID, toUserID)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pay := owed
+
+	if amount != nil {
+		pay = *amount
+	}
+
+	cmp, err := pay.Cmp(owed)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cmp > 0 {
+		return nil, nil, ErrSettlementExceedsBalance
+	}
+
+	transfer := &Transfer{
+		FromUserID: fromUserID,
+		ToUserID:   toUserID,
+		Amount:     pay,
+	}
+
+	origin := &ReviewOrigin{Type: ReviewOriginGroup, ID: groupID}
+
+	err = screenedTransfer(ctx, tx, engine, JournalKindSettlement, transfer, origin)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	settlement := &Settlement{
+		GroupID:    groupID,
+		FromUserID: fromUserID,
+		ToUserID:   toUserID,
+		Amount:     pay,
+		JournalID:  transfer.JournalID,
+	}
+
+	args := []interface{}{groupID, fromUserID, toUserID, pay.Amount, transfer.JournalID}
+
+	err = tx.QueryRowContext(ctx, settlementQuery, args...).Scan(&settlement.ID, &settlement.CreatedAt)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return settlement, transfer, nil
+}
@@ -0,0 +1,358 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+)
+
+var (
+	ErrHoldNotActive      = errors.New("hold is no longer active")
+	ErrCaptureExceedsHold = errors.New("capture amount exceeds the held amount")
+)
+
+const (
+	HoldStatusActive   = "active"
+	HoldStatusCaptured = "captured"
+	HoldStatusVoided   = "voided"
+	HoldStatusExpired  = "expired"
+)
+
+// HoldModel screens captures with Risk when it is set.
+type HoldModel struct {
+	DB   *sql.DB
+	Risk *RiskEngine
+}
+
+// Hold reserves part of a user's available balance for a payee. The payee
+// captures it into a transfer, or it is voided or expires and the reserved
+// amount becomes available again.
+type Hold struct {
+	ID             int64     `json:"id"`
+	UserID         int64     `json:"user_id"`
+	PayeeID        int64     `json:"payee_id"`
+	Amount         Money     `json:"amount"`
+	CapturedAmount Money     `json:"captured_amount"`
+	Status         string    `json:"status"`
+	JournalID      *int64    `json:"transaction_id,omitempty"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func ValidateHold(v *validator.Validator, hold *Hold) {
+	ValidateMoney(v, "amount", hold.Amount)
+	v.Check(hold.PayeeID > 0, "payee_id", "must be provided")
+	v.Check(hold.PayeeID != hold.UserID, "payee_id", "must not be yourself")
+	v.Check(hold.ExpiresAt.After(time.Now()), "expires_in", "must be in the future")
+}
+
+func updateHeld(ctx context.Context, tx *sql.Tx, userID int64, amount Money) error {
+	query := `
+		UPDATE accounts
+		SET held = held + $1
+		WHERE user_id = $2 AND currency = $3`
+
+	_, err := tx.ExecContext(ctx, query, amount.Amount, userID, amount.Currency)
+
+	return err
+}
+
+// Insert places the hold, reserving its amount from the payer's wallet.
+func (m *HoldModel) Insert(hold *Hold) error {
+	query := `
+		INSERT INTO holds (user_id, currency, payee_id, amount, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, status, created_at, updated_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	account, err := lockAccount(ctx, tx, hold.UserID, hold.Amount.Currency)
+
+	if err != nil {
+		return err
+	}
+
+	if err = account.checkDebit(); err != nil {
+		return err
+	}
+
+	if account.Available.Amount < hold.Amount.Amount {
+		return ErrInsuffientBalance
+	}
+
+	err = updateHeld(ctx, tx, hold.UserID, hold.Amount)
+
+	if err != nil {
+		return err
+	}
+
+	args := []interface{}{hold.UserID, hold.Amount.Currency, hold.PayeeID, hold.Amount.Amount, hold.ExpiresAt}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&hold.ID, &hold.Status, &hold.CreatedAt, &hold.UpdatedAt)
+
+	if err != nil {
+		return err
+	}
+
+	hold.CapturedAmount = Money{Currency: hold.Amount.Currency}
+
+	return tx.Commit()
+}
+
+const holdColumns = `
+	id, user_id, payee_id, amount, captured_amount, currency, status, journal_id,
+	expires_at, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanHold(row rowScanner) (*Hold, error) {
+	var hold Hold
+
+	err := row.Scan(
+		&hold.ID,
+		&hold.UserID,
+		&hold.PayeeID,
+		&hold.Amount.Amount,
+		&hold.CapturedAmount.Amount,
+		&hold.Amount.Currency,
+		&hold.Status,
+		&hold.JournalID,
+		&hold.ExpiresAt,
+		&hold.CreatedAt,
+		&hold.UpdatedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	hold.CapturedAmount.Currency = hold.Amount.Currency
+
+	return &hold, nil
+}
+
+func (m *HoldModel) Get(id int64) (*Hold, error) {
+	query := `SELECT ` + holdColumns + ` FROM holds WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return scanHold(m.DB.QueryRowContext(ctx, query, id))
+}
+
+// lockActiveHold locks the hold until tx ends and fails unless it can still
+// be captured or voided.
+func lockActiveHold(ctx context.Context, tx *sql.Tx, id int64) (*Hold, error) {
+	query := `SELECT ` + holdColumns + ` FROM holds WHERE id = $1 FOR UPDATE`
+
+	hold, err := scanHold(tx.QueryRowContext(ctx, query, id))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if hold.Status != HoldStatusActive || !time.Now().Before(hold.ExpiresAt) {
+		return nil, ErrHoldNotActive
+	}
+
+	return hold, nil
+}
+
+func finishHold(ctx context.Context, tx *sql.Tx, hold *Hold) error {
+	query := `
+		UPDATE holds
+		SET status = $1, captured_amount = $2, journal_id = $3, updated_at = NOW()
+		WHERE id = $4
+		RETURNING updated_at`
+
+	args := []interface{}{hold.Status, hold.CapturedAmount.Amount, hold.JournalID, hold.ID}
+
+	return tx.QueryRowContext(ctx, query, args...).Scan(&hold.UpdatedAt)
+}
+
+// Capture transfers amount of the hold to the payee. A hold is captured once,
+// whatever is not captured is released back to the payer. A capture risk
+// screening holds leaves the hold active until its review is released.
+func (m *HoldModel) Capture(id int64, amount Money) (*Hold, *Transfer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer tx.Rollback()
+
+	hold, transfer, err := captureHold(ctx, tx, m.Risk, id, amount)
+
+	if err != nil {
+		return nil, nil, commitScreened(tx, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	return hold, transfer, nil
+}
+
+func captureHold(ctx context.Context, tx *sql.Tx, engine *RiskEngine, id int64, amount Money) (*Hold, *Transfer, error) {
+	hold, err := lockActiveHold(ctx, tx, id)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cmp, err := amount.Cmp(hold.Amount)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cmp > 0 {
+		return nil, nil, ErrCaptureExceedsHold
+	}
+
+	transfer := &Transfer{
+		FromUserID: hold.UserID,
+		ToUserID:   hold.PayeeID,
+		Amount:     amount,
+	}
+
+	// the hold keeps its amount reserved while the capture is reviewed
+	err = checkRisk(ctx, tx, engine, transfer, &ReviewOrigin{Type: ReviewOriginHold, ID: hold.ID})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = lockAccounts(ctx, tx, walletKey{hold.UserID, hold.Amount.Currency}, walletKey{hold.PayeeID, hold.Amount.Currency})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = updateHeld(ctx, tx, hold.UserID, hold.Amount.Neg())
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = executeTransfer(ctx, tx, JournalKindCapture, transfer)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hold.Status = HoldStatusCaptured
+	hold.CapturedAmount = amount
+	hold.JournalID = &transfer.JournalID
+
+	err = finishHold(ctx, tx, hold)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return hold, transfer, nil
+}
+
+// Void cancels the hold and makes its amount available again.
+func (m *HoldModel) Void(id int64) (*Hold, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	hold, err := lockActiveHold(ctx, tx, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = lockAccount(ctx, tx, hold.UserID, hold.Amount.Currency)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = updateHeld(ctx, tx, hold.UserID, hold.Amount.Neg())
+
+	if err != nil {
+		return nil, err
+	}
+
+	hold.Status = HoldStatusVoided
+
+	err = finishHold(ctx, tx, hold)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return hold, nil
+}
+
+// ExpireDue expires every active hold past its expiry and releases the
+// reserved amounts. It returns the number of holds expired.
+func (m *HoldModel) ExpireDue() (int64, error) {
+	query := `
+		WITH expired AS (
+			UPDATE holds
+			SET status = 'expired', updated_at = NOW()
+			WHERE status = 'active' AND expires_at <= NOW()
+			RETURNING user_id, currency, amount
+		), released AS (
+			UPDATE accounts
+			SET held = accounts.held - totals.amount
+			FROM (
+				SELECT user_id, currency, SUM(amount) AS amount
+				FROM expired
+				GROUP BY user_id, currency
+			) totals
+			WHERE accounts.user_id = totals.user_id AND accounts.currency = totals.currency
+		)
+		SELECT COUNT(*) FROM expired`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var count int64
+
+	err := m.DB.QueryRowContext(ctx, query).Scan(&count)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
@@ -0,0 +1,116 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrIdempotencyKeyInUse    = errors.New("idempotency key is already being processed")
+	ErrIdempotencyKeyMismatch = errors.New("idempotency key was used with a different request")
+)
+
+// a reservation that never completed, because the process died mid request,
+// can be taken over by the same request once it is older than this
+const idempotencyLockTimeout = time.Minute
+
+type IdempotencyModel struct {
+	DB *sql.DB
+}
+
+type IdempotentResponse struct {
+	StatusCode int
+	Body       []byte
+}
+
+// Begin reserves key for the user. When the key has already been used for the
+// same request the stored response is returned and the request must not be
+// processed again.
+func (m *IdempotencyModel) Begin(userID int64, key string, requestHash []byte) (*IdempotentResponse, error) {
+	insertQuery := `
+		INSERT INTO idempotency_keys (user_id, key, request_hash)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, key) DO UPDATE
+		SET created_at = NOW()
+		WHERE idempotency_keys.status_code IS NULL
+		AND idempotency_keys.request_hash = EXCLUDED.request_hash
+		AND idempotency_keys.created_at < NOW() - make_interval(secs => $4)`
+
+	selectQuery := `
+		SELECT request_hash, status_code, response_body
+		FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, insertQuery, userID, key, requestHash, idempotencyLockTimeout.Seconds())
+
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if rowsAffected == 1 {
+		return nil, nil
+	}
+
+	var (
+		storedHash []byte
+		statusCode sql.NullInt64
+		body       []byte
+	)
+
+	err = m.DB.QueryRowContext(ctx, selectQuery, userID, key).Scan(&storedHash, &statusCode, &body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(storedHash, requestHash) {
+		return nil, ErrIdempotencyKeyMismatch
+	}
+
+	if !statusCode.Valid {
+		return nil, ErrIdempotencyKeyInUse
+	}
+
+	return &IdempotentResponse{StatusCode: int(statusCode.Int64), Body: body}, nil
+}
+
+// Complete stores the response for a key reserved with Begin.
+func (m *IdempotencyModel) Complete(userID int64, key string, response *IdempotentResponse) error {
+	query := `
+		UPDATE idempotency_keys
+		SET status_code = $1, response_body = $2
+		WHERE user_id = $3 AND key = $4`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, response.StatusCode, response.Body, userID, key)
+
+	return err
+}
+
+// Release drops a reservation so the request can be retried with the same key.
+func (m *IdempotencyModel) Release(userID int64, key string) error {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2 AND status_code IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, key)
+
+	return err
+}
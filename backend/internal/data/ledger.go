@@ -0,0 +1,264 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrUnbalancedJournal  = errors.New("journal postings do not balance")
+	ErrDuplicateReference = errors.New("a transaction with this reference already exists")
+)
+
+const (
+	JournalKindOpening  = "opening"
+	JournalKindTopUp    = "top_up"
+	JournalKindTransfer = "transfer"
+	JournalKindCapture  = "hold_capture"
+	JournalKindRefund   = "refund"
+	JournalKindOrder    = "order_payment"
+
+	// adjustments are made by staff, see balance_adjustments for the reason
+	JournalKindAdjustment = "adjustment"
+
+	// closures sweep what is left in a wallet that is being closed
+	JournalKindClosure = "account_closure"
+
+	// settlements are not refundable, group balances would no longer add up
+	JournalKindSettlement = "group_settlement"
+)
+
+// ExternalAccount is the ledger counterpart for money entering or leaving the
+// platform, it is stored as a posting with a NULL user_id.
+const ExternalAccount int64 = 0
+
+type LedgerModel struct {
+	DB *sql.DB
+}
+
+type Journal struct {
+	ID        int64     `json:"id"`
+	Kind      string    `json:"kind"`
+	RefundOf  *int64    `json:"refund_of,omitempty"`
+	Reference *string   `json:"reference,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Postings  []Posting `json:"postings"`
+}
+
+type Posting struct {
+	ID        int64     `json:"id"`
+	JournalID int64     `json:"journal_id"`
+	UserID    int64     `json:"user_id"`
+	Amount    Money     `json:"amount"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Reconciliation struct {
+	UserID        int64 `json:"user_id"`
+	Balance       Money `json:"balance"`
+	LedgerBalance Money `json:"ledger_balance"`
+}
+
+// checkBalanced fails unless the postings sum to zero in every currency, a
+// credit to one account is always a debit to another.
+func checkBalanced(postings []Posting) error {
+	if len(postings) < 2 {
+		return ErrUnbalancedJournal
+	}
+
+	sums := make(map[string]Money)
+
+	for _, p := range postings {
+		if p.Amount.IsZero() {
+			return ErrUnbalancedJournal
+		}
+
+		sum, ok := sums[p.Amount.Currency]
+
+		if !ok {
+			sum = Money{Currency: p.Amount.Currency}
+		}
+
+		sum, err := sum.Add(p.Amount)
+
+		if err != nil {
+			return err
+		}
+
+		sums[p.Amount.Currency] = sum
+	}
+
+	for _, sum := range sums {
+		if !sum.IsZero() {
+			return ErrUnbalancedJournal
+		}
+	}
+
+	return nil
+}
+
+// insertJournal records a balanced journal and its postings as part of tx,
+// filling in their ids, audits it and queues the webhook events about it. A
+// journal with a reference is only ever recorded once, the second attempt
+// fails with ErrDuplicateReference.
+func insertJournal(ctx context.Context, tx *sql.Tx, journal *Journal) error {
+	if err := checkBalanced(journal.Postings); err != nil {
+		return err
+	}
+
+	journalQuery := `
+		INSERT INTO journals (kind, refund_of, reference)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`
+
+	postingQuery := `
+		INSERT INTO postings (journal_id, user_id, amount, currency)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`
+
+	args := []interface{}{journal.Kind, journal.RefundOf, journal.Reference}
+
+	err := tx.QueryRowContext(ctx, journalQuery, args...).Scan(&journal.ID, &journal.CreatedAt)
+
+	if err != nil {
+		switch {
+		case err.Error() == "pq: duplicate key value violates unique constraint \"journals_reference_key\"":
+			return ErrDuplicateReference
+		default:
+			return err
+		}
+	}
+
+	for i := range journal.Postings {
+		p := &journal.Postings[i]
+		p.JournalID = journal.ID
+
+		userID := sql.NullInt64{Int64: p.UserID, Valid: p.UserID != ExternalAccount}
+
+		args := []interface{}{p.JournalID, userID, p.Amount.Amount, p.Amount.Currency}
+
+		err = tx.QueryRowContext(ctx, postingQuery, args...).Scan(&p.ID, &p.CreatedAt)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	err = insertJournalAudit(ctx, tx, journal)
+
+	if err != nil {
+		return err
+	}
+
+	// the events go out only once this transaction commits
+	return insertJournalEvents(ctx, tx, journal)
+}
+
+// Reconcile returns every account whose stored balance differs from the sum
+// of its postings. An empty result means the ledger and balances agree.
+func (m *LedgerModel) Reconcile() ([]*Reconciliation, error) {
+	query := `
+		SELECT accounts.user_id, accounts.currency, accounts.balance, COALESCE(SUM(postings.amount), 0)
+		FROM accounts
+		LEFT JOIN postings ON postings.user_id = accounts.user_id AND postings.currency = accounts.currency
+		GROUP BY accounts.user_id, accounts.currency, accounts.balance
+		HAVING accounts.balance <> COALESCE(SUM(postings.amount), 0)
+		ORDER BY accounts.user_id, accounts.currency`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var mismatches []*Reconciliation
+
+	for rows.Next() {
+		var r Reconciliation
+
+		err = rows.Scan(&r.UserID, &r.Balance.Currency, &r.Balance.Amount, &r.LedgerBalance.Amount)
+
+		if err != nil {
+			return nil, err
+		}
+
+		r.LedgerBalance.Currency = r.Balance.Currency
+
+		mismatches = append(mismatches, &r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return mismatches, nil
+}
+
+// GetJournal returns a journal together with all of its postings.
+func (m *LedgerModel) GetJournal(id int64) (*Journal, error) {
+	journalQuery := `
+		SELECT id, kind, refund_of, reference, created_at
+		FROM journals
+		WHERE id = $1`
+
+	postingsQuery := `
+		SELECT id, journal_id, COALESCE(user_id, 0), amount, currency, created_at
+		FROM postings
+		WHERE journal_id = $1
+		ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var journal Journal
+
+	err := m.DB.QueryRowContext(ctx, journalQuery, id).Scan(
+		&journal.ID,
+		&journal.Kind,
+		&journal.RefundOf,
+		&journal.Reference,
+		&journal.CreatedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	rows, err := m.DB.QueryContext(ctx, postingsQuery, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var p Posting
+
+		err = rows.Scan(&p.ID, &p.JournalID, &p.UserID, &p.Amount.Amount, &p.Amount.Currency, &p.CreatedAt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		journal.Postings = append(journal.Postings, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &journal, nil
+}
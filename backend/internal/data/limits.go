@@ -0,0 +1,290 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Verification levels, higher levels get higher limits.
+const (
+	VerificationNone    = 0
+	VerificationContact = 1
+	VerificationKYC     = 2
+)
+
+// LimitError is returned when a transfer or top-up would break one of the
+// user's limits, Code tells the limits apart.
+type LimitError struct {
+	Code    string
+	Message string
+}
+
+func (e *LimitError) Error() string {
+	return e.Message
+}
+
+var (
+	ErrTransactionLimit = &LimitError{Code: "transaction_limit_exceeded", Message: "amount exceeds the per transaction limit"}
+	ErrDailyLimit       = &LimitError{Code: "daily_limit_exceeded", Message: "transfer exceeds the daily outgoing limit"}
+	ErrMonthlyLimit     = &LimitError{Code: "monthly_limit_exceeded", Message: "transfer exceeds the monthly outgoing limit"}
+	ErrVelocityLimit    = &LimitError{Code: "velocity_limit_exceeded", Message: "too many transfers in the last hour"}
+	ErrBalanceLimit     = &LimitError{Code: "balance_limit_exceeded", Message: "resulting balance exceeds the wallet limit"}
+)
+
+// limitedKinds are the journals that count towards and are checked against
+// the sender's outgoing limits. Refunds return money and are never limited.
+var limitedKinds = []string{
+	JournalKindTransfer,
+	JournalKindCapture,
+	JournalKindSettlement,
+	JournalKindOrder,
+}
+
+type LimitModel struct {
+	DB *sql.DB
+}
+
+// Limits are what a user may do in one currency, a nil limit is no limit.
+type Limits struct {
+	VerificationLevel int    `json:"verification_level"`
+	Currency          string `json:"currency"`
+	MaxTransaction    *Money `json:"max_transaction,omitempty"`
+	DailyOutgoing     *Money `json:"daily_outgoing,omitempty"`
+	MonthlyOutgoing   *Money `json:"monthly_outgoing,omitempty"`
+	TransfersPerHour  *int   `json:"transfers_per_hour,omitempty"`
+	MaxBalance        *Money `json:"max_balance,omitempty"`
+}
+
+// LimitUsage is how much of their limits a user has used so far.
+type LimitUsage struct {
+	SentToday     Money `json:"sent_today"`
+	SentThisMonth Money `json:"sent_this_month"`
+	TransfersHour int   `json:"transfers_last_hour"`
+}
+
+// UserLimits is what the limits endpoint shows for one currency.
+type UserLimits struct {
+	*Limits
+	Usage *LimitUsage `json:"usage"`
+}
+
+func isLimitedKind(kind string) bool {
+	for _, k := range limitedKinds {
+		if k == kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getLimits reads the limits of the user's verification level in currency.
+// With lock the user row is locked for the rest of tx, it is always locked
+// after the wallets of the transfer.
+func getLimits(ctx context.Context, tx *sql.Tx, userID int64, currency string, lock bool) (*Limits, error) {
+	query := `
+		SELECT users.verification_level, max_transaction, daily_outgoing, monthly_outgoing,
+			transfers_per_hour, max_balance
+		FROM users
+		LEFT JOIN limit_tiers ON limit_tiers.verification_level = users.verification_level
+			AND limit_tiers.currency = $2
+		WHERE users.id = $1`
+
+	if lock {
+		query += `
+		FOR NO KEY UPDATE OF users`
+	}
+
+	var maxTransaction, daily, monthly, maxBalance sql.NullInt64
+
+	limits := &Limits{Currency: currency}
+
+	err := tx.QueryRowContext(ctx, query, userID, currency).Scan(
+		&limits.VerificationLevel,
+		&maxTransaction,
+		&daily,
+		&monthly,
+		&limits.TransfersPerHour,
+		&maxBalance,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	limits.MaxTransaction = nullMoney(maxTransaction, currency)
+	limits.DailyOutgoing = nullMoney(daily, currency)
+	limits.MonthlyOutgoing = nullMoney(monthly, currency)
+	limits.MaxBalance = nullMoney(maxBalance, currency)
+
+	return limits, nil
+}
+
+func nullMoney(n sql.NullInt64, currency string) *Money {
+	if !n.Valid {
+		return nil
+	}
+
+	return &Money{Amount: n.Int64, Currency: currency}
+}
+
+// getLimitUsage adds up what the user sent in currency today and this month
+// and counts their transfers in any currency over the last hour.
+func getLimitUsage(ctx context.Context, tx *sql.Tx, userID int64, currency string) (*LimitUsage, error) {
+	query := `
+		SELECT
+			COALESCE(SUM(-postings.amount) FILTER (WHERE postings.currency = $2 AND postings.created_at >= date_trunc('day', NOW())), 0),
+			COALESCE(SUM(-postings.amount) FILTER (WHERE postings.currency = $2 AND postings.created_at >= date_trunc('month', NOW())), 0),
+			COUNT(DISTINCT postings.journal_id) FILTER (WHERE postings.created_at >= NOW() - interval '1 hour')
+		FROM postings
+		INNER JOIN journals ON journals.id = postings.journal_id
+		WHERE postings.user_id = $1 AND postings.amount < 0
+		AND journals.kind = ANY($3)
+		AND postings.created_at >= LEAST(date_trunc('month', NOW()), NOW() - interval '1 hour')`
+
+	usage := &LimitUsage{
+		SentToday:     Money{Currency: currency},
+		SentThisMonth: Money{Currency: currency},
+	}
+
+	err := tx.QueryRowContext(ctx, query, userID, currency, pq.Array(limitedKinds)).Scan(
+		&usage.SentToday.Amount,
+		&usage.SentThisMonth.Amount,
+		&usage.TransfersHour,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return usage, nil
+}
+
+// checkOutgoingLimits fails with a LimitError when sending amount would break
+// one of the sender's limits. It must run in the transaction that sends it,
+// after getLimits locked the sender.
+func checkOutgoingLimits(ctx context.Context, tx *sql.Tx, userID int64, limits *Limits, amount Money) error {
+	if limits.MaxTransaction != nil && amount.Amount > limits.MaxTransaction.Amount {
+		return ErrTransactionLimit
+	}
+
+	if limits.DailyOutgoing == nil && limits.MonthlyOutgoing == nil && limits.TransfersPerHour == nil {
+		return nil
+	}
+
+	usage, err := getLimitUsage(ctx, tx, userID, amount.Currency)
+
+	if err != nil {
+		return err
+	}
+
+	return limits.checkUsage(usage, amount)
+}
+
+// checkUsage fails with a LimitError when sending amount on top of usage
+// would break the velocity, daily or monthly limit.
+func (limits *Limits) checkUsage(usage *LimitUsage, amount Money) error {
+	if limits.TransfersPerHour != nil && usage.TransfersHour >= *limits.TransfersPerHour {
+		return ErrVelocityLimit
+	}
+
+	if limits.DailyOutgoing != nil && !withinLimit(usage.SentToday, amount, *limits.DailyOutgoing) {
+		return ErrDailyLimit
+	}
+
+	if limits.MonthlyOutgoing != nil && !withinLimit(usage.SentThisMonth, amount, *limits.MonthlyOutgoing) {
+		return ErrMonthlyLimit
+	}
+
+	return nil
+}
+
+// checkBalanceLimit fails when crediting amount to a wallet holding balance
+// would take it over the user's wallet limit.
+func checkBalanceLimit(limits *Limits, balance, amount Money) error {
+	if limits.MaxBalance != nil && !withinLimit(balance, amount, *limits.MaxBalance) {
+		return ErrBalanceLimit
+	}
+
+	return nil
+}
+
+func withinLimit(used, amount, limit Money) bool {
+	total, err := used.Add(amount)
+
+	return err == nil && total.Amount <= limit.Amount
+}
+
+// GetForUser returns the user's limits and usage in each currency they hold a
+// wallet in.
+func (m *LimitModel) GetForUser(userID int64) ([]*UserLimits, error) {
+	currenciesQuery := `
+		SELECT currency
+		FROM accounts
+		WHERE user_id = $1
+		ORDER BY currency`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, currenciesQuery, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var currencies []string
+
+	for rows.Next() {
+		var currency string
+
+		if err = rows.Scan(&currency); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		currencies = append(currencies, currency)
+	}
+
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	all := []*UserLimits{}
+
+	for _, currency := range currencies {
+		limits, err := getLimits(ctx, tx, userID, currency, false)
+
+		if err != nil {
+			return nil, err
+		}
+
+		usage, err := getLimitUsage(ctx, tx, userID, currency)
+
+		if err != nil {
+			return nil, err
+		}
+
+		all = append(all, &UserLimits{Limits: limits, Usage: usage})
+	}
+
+	return all, nil
+}
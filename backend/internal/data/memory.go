@@ -0,0 +1,1461 @@
+package data
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/totp"
+)
+
+// memoryDB is the state behind the in-memory stores. A single mutex guards
+// all of it, so a transfer or a refund is as atomic as its Postgres
+// counterpart.
+type memoryDB struct {
+	mu sync.Mutex
+
+	lastUserID       int64
+	lastJournalID    int64
+	lastPostingID    int64
+	lastSessionID    int64
+	lastAdjustmentID int64
+	auditEvents      []*AuditEvent
+
+	users         map[int64]*User
+	accounts      map[walletKey]*Account
+	journals      map[int64]*Journal
+	conversions   map[int64]*Conversion
+	sessions      map[int64]*Session
+	refreshTokens map[string]*memoryRefreshToken
+	idempotency   map[memoryIdempotencyKey]*memoryIdempotencyEntry
+	totp          map[int64]*TOTP
+	recoveryCodes map[int64]map[string]bool
+	pins          map[int64]*TransactionPIN
+	throttles     map[string]*Throttle
+	resetTokens   map[string]*memoryResetToken
+	verifications map[memoryVerificationKey]*memoryVerification
+}
+
+type memoryVerificationKey struct {
+	userID  int64
+	channel string
+}
+
+type memoryVerification struct {
+	destination string
+	hash        []byte
+	attempts    int
+	expiry      time.Time
+	createdAt   time.Time
+}
+
+type memoryResetToken struct {
+	userID int64
+	expiry time.Time
+}
+
+type memoryRefreshToken struct {
+	sessionID int64
+	expiry    time.Time
+	used      bool
+}
+
+type memoryLimitTierKey struct {
+	verificationLevel int
+	currency          string
+}
+
+// memoryLimitTier is a row of limit_tiers in minor units, zero is no limit.
+type memoryLimitTier struct {
+	maxTransaction   int64
+	dailyOutgoing    int64
+	monthlyOutgoing  int64
+	transfersPerHour int
+	maxBalance       int64
+}
+
+// memoryLimitTiers are the tiers the migrations seed.
+var memoryLimitTiers = map[memoryLimitTierKey]memoryLimitTier{
+	{VerificationNone, "INR"}:    {1000000, 2000000, 5000000, 10, 1000000},
+	{VerificationContact, "INR"}: {10000000, 10000000, 20000000, 20, 20000000},
+	{VerificationKYC, "INR"}:     {20000000, 50000000, 100000000, 50, 20000000},
+	{VerificationNone, "AED"}:    {44000, 88000, 220000, 10, 44000},
+	{VerificationContact, "AED"}: {440000, 440000, 880000, 20, 880000},
+	{VerificationKYC, "AED"}:     {880000, 2200000, 4400000, 50, 880000},
+	{VerificationNone, "BHD"}:    {45000, 90000, 225000, 10, 45000},
+	{VerificationContact, "BHD"}: {450000, 450000, 900000, 20, 900000},
+	{VerificationKYC, "BHD"}:     {900000, 2250000, 4500000, 50, 900000},
+	{VerificationNone, "EUR"}:    {11000, 22000, 55000, 10, 11000},
+	{VerificationContact, "EUR"}: {110000, 110000, 220000, 20, 220000},
+	{VerificationKYC, "EUR"}:     {220000, 550000, 1100000, 50, 220000},
+	{VerificationNone, "GBP"}:    {9500, 19000, 47500, 10, 9500},
+	{VerificationContact, "GBP"}: {95000, 95000, 190000, 20, 190000},
+	{VerificationKYC, "GBP"}:     {190000, 475000, 950000, 50, 190000},
+	{VerificationNone, "JPY"}:    {18000, 36000, 90000, 10, 18000},
+	{VerificationContact, "JPY"}: {180000, 180000, 360000, 20, 360000},
+	{VerificationKYC, "JPY"}:     {360000, 900000, 1800000, 50, 360000},
+	{VerificationNone, "USD"}:    {12000, 24000, 60000, 10, 12000},
+	{VerificationContact, "USD"}: {120000, 120000, 240000, 20, 240000},
+	{VerificationKYC, "USD"}:     {240000, 600000, 1200000, 50, 240000},
+}
+
+type memoryIdempotencyKey struct {
+	userID int64
+	key    string
+}
+
+type memoryIdempotencyEntry struct {
+	requestHash []byte
+	response    *IdempotentResponse
+	createdAt   time.Time
+}
+
+type memoryUsers struct{ db *memoryDB }
+type memoryAccounts struct{ db *memoryDB }
+type memorySessions struct{ db *memoryDB }
+type memoryIdempotency struct{ db *memoryDB }
+type memoryAudit struct{ db *memoryDB }
+type memoryMFA struct{ db *memoryDB }
+type memoryPINs struct{ db *memoryDB }
+type memoryThrottles struct{ db *memoryDB }
+type memoryPasswordResets struct{ db *memoryDB }
+type memoryVerifications struct{ db *memoryDB }
+type memoryLimits struct{ db *memoryDB }
+
+// NewMemoryModels returns models that keep everything in memory, for tests
+// and for running the API without a database. Users, accounts, limits,
+// sessions, two-factor secrets, transaction PINs, sign-in throttles, password
+// reset tokens, verification codes, idempotency keys and the audit log are
+// supported. The ledger queries, holds, scheduled transfers, payment
+// requests, groups, merchants, orders, webhooks and risk reviews still need
+// Postgres and are left unset, so their routes and jobs must not be started.
+// Transfers are not screened for risk, as with an AccountModel without Risk.
+func NewMemoryModels() Models {
+	db := &memoryDB{
+		users:         make(map[int64]*User),
+		accounts:      make(map[walletKey]*Account),
+		journals:      make(map[int64]*Journal),
+		conversions:   make(map[int64]*Conversion),
+		sessions:      make(map[int64]*Session),
+		refreshTokens: make(map[string]*memoryRefreshToken),
+		idempotency:   make(map[memoryIdempotencyKey]*memoryIdempotencyEntry),
+		totp:          make(map[int64]*TOTP),
+		recoveryCodes: make(map[int64]map[string]bool),
+		pins:          make(map[int64]*TransactionPIN),
+		throttles:     make(map[string]*Throttle),
+		resetTokens:   make(map[string]*memoryResetToken),
+		verifications: make(map[memoryVerificationKey]*memoryVerification),
+	}
+
+	return Models{
+		Users:          &memoryUsers{db: db},
+		Accounts:       &memoryAccounts{db: db},
+		Idempotency:    &memoryIdempotency{db: db},
+		Sessions:       &memorySessions{db: db},
+		MFA:            &memoryMFA{db: db},
+		PINs:           &memoryPINs{db: db},
+		Throttles:      &memoryThrottles{db: db},
+		PasswordResets: &memoryPasswordResets{db: db},
+		Verifications:  &memoryVerifications{db: db},
+		Limits:         &memoryLimits{db: db},
+		Audit:          &memoryAudit{db: db},
+	}
+}
+
+func (m *memoryUsers) Insert(user *User) error {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	for _, existing := range m.db.users {
+		if existing.UserName == user.UserName {
+			return ErrDuplicateUsername
+		}
+
+		if user.Email != "" && existing.Email == user.Email {
+			return ErrDuplicateEmail
+		}
+
+		if user.Phone != "" && existing.Phone == user.Phone {
+			return ErrDuplicatePhone
+		}
+	}
+
+	m.db.lastUserID++
+
+	user.ID = m.db.lastUserID
+	user.CreatedAt = time.Now().Truncate(time.Second)
+	user.Role = RoleUser
+	user.Version = 1
+
+	stored := *user
+	m.db.users[user.ID] = &stored
+
+	return nil
+}
+
+func (m *memoryUsers) GetByUsername(username string) (*User, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	for _, user := range m.db.users {
+		if user.UserName == username {
+			found := *user
+			return &found, nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+func (m *memoryUsers) GetByID(id int64) (*User, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	user, ok := m.db.users[id]
+
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	found := *user
+
+	return &found, nil
+}
+
+func (m *memoryUsers) GetByEmail(email string) (*User, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	for _, user := range m.db.users {
+		if user.Email != "" && user.Email == email {
+			found := *user
+			return &found, nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+func (m *memoryUsers) GetUsers(searchTerm string) ([]*User, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	var users []*User
+
+	for _, user := range m.db.users {
+		if strings.Contains(user.UserName, searchTerm) {
+			found := *user
+			users = append(users, &found)
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
+
+	return users, nil
+}
+
+// UpdateUser fails with ErrEditConflict when the user was changed since it
+// was read.
+func (m *memoryUsers) UpdateUser(user *User) error {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	stored, ok := m.db.users[user.ID]
+
+	if !ok || stored.Version != user.Version {
+		return ErrEditConflict
+	}
+
+	for _, existing := range m.db.users {
+		if existing.ID != user.ID && existing.UserName == user.UserName {
+			return ErrDuplicateUsername
+		}
+
+		if existing.ID != user.ID && user.Email != "" && existing.Email == user.Email {
+			return ErrDuplicateEmail
+		}
+
+		if existing.ID != user.ID && user.Phone != "" && existing.Phone == user.Phone {
+			return ErrDuplicatePhone
+		}
+	}
+
+	user.Version++
+
+	updated := *user
+	m.db.users[user.ID] = &updated
+
+	return nil
+}
+
+func (m *memoryUsers) SetRole(id int64, role string) error {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	user, ok := m.db.users[id]
+
+	if !ok {
+		return ErrRecordNotFound
+	}
+
+	user.Role = role
+
+	return nil
+}
+
+func (m *memoryAccounts) CreateAccount(userID int64, currency string) error {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	key := walletKey{userID, currency}
+
+	if account, ok := m.db.accounts[key]; ok && account.Status != AccountClosed {
+		return ErrDuplicateAccount
+	}
+
+	m.db.accounts[key] = &Account{
+		UserID:    userID,
+		Balance:   Money{Currency: currency},
+		Status:    AccountActive,
+		CreatedAt: time.Now().Truncate(time.Second),
+	}
+
+	return nil
+}
+
+func (m *memoryAccounts) GetAccounts(userID int64) ([]*Account, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	accounts := []*Account{}
+
+	for key, account := range m.db.accounts {
+		if key.userID == userID {
+			found := *account
+			found.setAvailable()
+			accounts = append(accounts, &found)
+		}
+	}
+
+	sort.Slice(accounts, func(i, j int) bool {
+		if !accounts[i].CreatedAt.Equal(accounts[j].CreatedAt) {
+			return accounts[i].CreatedAt.Before(accounts[j].CreatedAt)
+		}
+		return accounts[i].Balance.Currency < accounts[j].Balance.Currency
+	})
+
+	return accounts, nil
+}
+
+// account returns the stored wallet, the caller must hold the lock.
+func (db *memoryDB) account(userID int64, currency string) (*Account, error) {
+	account, ok := db.accounts[walletKey{userID, currency}]
+
+	if !ok {
+		return nil, ErrNoAccount
+	}
+
+	account.setAvailable()
+
+	return account, nil
+}
+
+// insertJournal records a balanced journal, the caller must hold the lock.
+func (db *memoryDB) insertJournal(journal *Journal) error {
+	if err := checkBalanced(journal.Postings); err != nil {
+		return err
+	}
+
+	if journal.Reference != nil {
+		for _, existing := range db.journals {
+			if existing.Reference != nil && *existing.Reference == *journal.Reference {
+				return ErrDuplicateReference
+			}
+		}
+	}
+
+	db.lastJournalID++
+
+	journal.ID = db.lastJournalID
+	journal.CreatedAt = time.Now()
+
+	for i := range journal.Postings {
+		db.lastPostingID++
+
+		p := &journal.Postings[i]
+		p.ID = db.lastPostingID
+		p.JournalID = journal.ID
+		p.CreatedAt = journal.CreatedAt
+	}
+
+	stored := *journal
+	stored.Postings = append([]Posting(nil), journal.Postings...)
+	db.journals[journal.ID] = &stored
+
+	return nil
+}
+
+func (m *memoryAccounts) AddMoney(userID int64, amount Money) error {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	account, err := m.db.account(userID, amount.Currency)
+
+	if err != nil {
+		return err
+	}
+
+	if err = account.checkCredit(); err != nil {
+		return err
+	}
+
+	balance, err := account.Balance.Add(amount)
+
+	if err != nil {
+		return err
+	}
+
+	limits, err := m.db.limits(userID, amount.Currency)
+
+	if err != nil {
+		return err
+	}
+
+	if err = checkBalanceLimit(limits, account.Balance, amount); err != nil {
+		return err
+	}
+
+	err = m.db.insertJournal(&Journal{
+		Kind: JournalKindTopUp,
+		Postings: []Posting{
+			{UserID: userID, Amount: amount},
+			{UserID: ExternalAccount, Amount: amount.Neg()},
+		},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	account.Balance = balance
+
+	return nil
+}
+
+func (m *memoryAccounts) TransferMoney(t *Transfer) error {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	return m.db.executeTransfer(JournalKindTransfer, t)
+}
+
+// executeTransfer mirrors the Postgres executeTransfer, the caller must hold
+// the lock.
+func (db *memoryDB) executeTransfer(kind string, t *Transfer) error {
+	if t.Conversion != nil && t.Conversion.Source != t.Amount {
+		return ErrCurrencyMismatch
+	}
+
+	credit := t.Credit()
+
+	from, err := db.account(t.FromUserID, t.Amount.Currency)
+
+	if err != nil {
+		return err
+	}
+
+	to, err := db.account(t.ToUserID, credit.Currency)
+
+	if err != nil {
+		return err
+	}
+
+	if kind != JournalKindClosure {
+		if err = from.checkDebit(); err != nil {
+			return err
+		}
+	}
+
+	if err = to.checkCredit(); err != nil {
+		return err
+	}
+
+	if from.Available.Amount < t.Amount.Amount {
+		return ErrInsuffientBalance
+	}
+
+	if _, err = to.Balance.Add(credit); err != nil {
+		return err
+	}
+
+	if isLimitedKind(kind) {
+		if err = db.checkOutgoingLimits(t.FromUserID, t.Amount); err != nil {
+			return err
+		}
+
+		recipientLimits, err := db.limits(t.ToUserID, credit.Currency)
+
+		if err != nil {
+			return err
+		}
+
+		if err = checkBalanceLimit(recipientLimits, to.Balance, credit); err != nil {
+			return err
+		}
+	}
+
+	postings := []Posting{
+		{UserID: t.FromUserID, Amount: t.Amount.Neg()},
+		{UserID: t.ToUserID, Amount: credit},
+	}
+
+	if t.Conversion != nil {
+		postings = append(postings,
+			Posting{UserID: ExternalAccount, Amount: t.Amount},
+			Posting{UserID: ExternalAccount, Amount: credit.Neg()},
+		)
+	}
+
+	journal := &Journal{Kind: kind, RefundOf: t.RefundOf, Reference: t.Reference, Postings: postings}
+
+	if err = db.insertJournal(journal); err != nil {
+		return err
+	}
+
+	// from and to are the same wallet on a transfer to oneself, so apply the
+	// debit before reading the balance to credit
+	from.Balance.Amount -= t.Amount.Amount
+	to.Balance.Amount += credit.Amount
+
+	if t.Conversion != nil {
+		conversion := *t.Conversion
+		db.conversions[journal.ID] = &conversion
+	}
+
+	t.JournalID = journal.ID
+	t.CreatedAt = journal.CreatedAt
+
+	return nil
+}
+
+// limits returns the limits of the user's verification level in currency,
+// the caller must hold the lock.
+func (db *memoryDB) limits(userID int64, currency string) (*Limits, error) {
+	user, ok := db.users[userID]
+
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	limits := &Limits{VerificationLevel: user.VerificationLevel, Currency: currency}
+
+	tier, ok := memoryLimitTiers[memoryLimitTierKey{user.VerificationLevel, currency}]
+
+	if !ok {
+		return limits, nil
+	}
+
+	limit := func(amount int64) *Money {
+		if amount == 0 {
+			return nil
+		}
+
+		return &Money{Amount: amount, Currency: currency}
+	}
+
+	limits.MaxTransaction = limit(tier.maxTransaction)
+	limits.DailyOutgoing = limit(tier.dailyOutgoing)
+	limits.MonthlyOutgoing = limit(tier.monthlyOutgoing)
+	limits.MaxBalance = limit(tier.maxBalance)
+
+	if tier.transfersPerHour != 0 {
+		limits.TransfersPerHour = &tier.transfersPerHour
+	}
+
+	return limits, nil
+}
+
+// limitUsage mirrors getLimitUsage, the caller must hold the lock.
+func (db *memoryDB) limitUsage(userID int64, currency string) *LimitUsage {
+	now := time.Now()
+
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	hour := now.Add(-time.Hour)
+
+	usage := &LimitUsage{
+		SentToday:     Money{Currency: currency},
+		SentThisMonth: Money{Currency: currency},
+	}
+
+	for _, journal := range db.journals {
+		if !isLimitedKind(journal.Kind) {
+			continue
+		}
+
+		counted := false
+
+		for _, p := range journal.Postings {
+			if p.UserID != userID || p.Amount.Amount >= 0 {
+				continue
+			}
+
+			if p.Amount.Currency == currency && !p.CreatedAt.Before(day) {
+				usage.SentToday.Amount -= p.Amount.Amount
+			}
+
+			if p.Amount.Currency == currency && !p.CreatedAt.Before(month) {
+				usage.SentThisMonth.Amount -= p.Amount.Amount
+			}
+
+			if !counted && !p.CreatedAt.Before(hour) {
+				usage.TransfersHour++
+				counted = true
+			}
+		}
+	}
+
+	return usage
+}
+
+// checkOutgoingLimits mirrors the Postgres checkOutgoingLimits, the caller
+// must hold the lock.
+func (db *memoryDB) checkOutgoingLimits(userID int64, amount Money) error {
+	limits, err := db.limits(userID, amount.Currency)
+
+	if err != nil {
+		return err
+	}
+
+	if limits.MaxTransaction != nil && amount.Amount > limits.MaxTransaction.Amount {
+		return ErrTransactionLimit
+	}
+
+	return limits.checkUsage(db.limitUsage(userID, amount.Currency), amount)
+}
+
+func (m *memoryLimits) GetForUser(userID int64) ([]*UserLimits, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	var currencies []string
+
+	for key := range m.db.accounts {
+		if key.userID == userID {
+			currencies = append(currencies, key.currency)
+		}
+	}
+
+	sort.Strings(currencies)
+
+	all := []*UserLimits{}
+
+	for _, currency := range currencies {
+		limits, err := m.db.limits(userID, currency)
+
+		if err != nil {
+			return nil, err
+		}
+
+		all = append(all, &UserLimits{Limits: limits, Usage: m.db.limitUsage(userID, currency)})
+	}
+
+	return all, nil
+}
+
+func (m *memoryAccounts) Refund(journalID, recipientID int64, amount *Money) (*Transfer, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	journal, ok := m.db.journals[journalID]
+
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	if !refundableKinds[journal.Kind] || journal.RefundOf != nil {
+		return nil, ErrNotRefundable
+	}
+
+	original := &refundableTransfer{journal: *journal, conversion: m.db.conversions[journalID]}
+
+	for _, p := range journal.Postings {
+		switch {
+		case p.UserID == ExternalAccount:
+		case p.Amount.IsNegative():
+			original.sender = p
+		default:
+			original.recipient = p
+		}
+	}
+
+	if original.sender.ID == 0 || original.recipient.ID == 0 || original.sender.UserID == original.recipient.UserID {
+		return nil, ErrNotRefundable
+	}
+
+	debited := Money{Currency: original.recipient.Amount.Currency}
+	credited := Money{Currency: original.sender.Amount.Currency}
+
+	for _, refund := range m.db.journals {
+		if refund.RefundOf == nil || *refund.RefundOf != journalID {
+			continue
+		}
+
+		for _, p := range refund.Postings {
+			switch {
+			case p.UserID == original.recipient.UserID && p.Amount.Currency == debited.Currency:
+				debited.Amount -= p.Amount.Amount
+			case p.UserID == original.sender.UserID && p.Amount.Currency == credited.Currency:
+				credited.Amount += p.Amount.Amount
+			}
+		}
+	}
+
+	transfer, err := original.newRefund(recipientID, amount, debited, credited)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.db.executeTransfer(JournalKindRefund, transfer)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return transfer, nil
+}
+
+func (m *memoryAccounts) CheckIfUserExists(userID int64) (bool, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	for key := range m.db.accounts {
+		if key.userID == userID {
+			return true, nil
+		}
+	}
+
+	return false, ErrNoAccount
+}
+
+func (m *memoryAccounts) SetStatus(userID int64, currency, status string) ([]*Account, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	accounts := []*Account{}
+
+	for key, account := range m.db.accounts {
+		if key.userID == userID && (currency == "" || key.currency == currency) && account.Status != AccountClosed {
+			account.Status = status
+			account.setAvailable()
+
+			found := *account
+			accounts = append(accounts, &found)
+		}
+	}
+
+	if len(accounts) == 0 {
+		return nil, ErrNoAccount
+	}
+
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].Balance.Currency < accounts[j].Balance.Currency
+	})
+
+	return accounts, nil
+}
+
+func (m *memoryAccounts) Adjust(adj *Adjustment) error {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	account, err := m.db.account(adj.UserID, adj.Amount.Currency)
+
+	if err != nil {
+		return err
+	}
+
+	if account.Status == AccountClosed {
+		return ErrAccountClosed
+	}
+
+	if account.Available.Amount+adj.Amount.Amount < 0 && adj.Amount.IsNegative() {
+		return ErrInsuffientBalance
+	}
+
+	balance, err := account.Balance.Add(adj.Amount)
+
+	if err != nil {
+		return err
+	}
+
+	journal := adjustmentJournal(adj)
+
+	if err = m.db.insertJournal(journal); err != nil {
+		return err
+	}
+
+	account.Balance = balance
+
+	m.db.lastAdjustmentID++
+
+	adj.ID = m.db.lastAdjustmentID
+	adj.JournalID = journal.ID
+	adj.CreatedAt = journal.CreatedAt
+
+	return nil
+}
+
+func (m *memoryAccounts) Close(c *Closure) error {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	account, err := m.db.account(c.UserID, c.Currency)
+
+	if err != nil {
+		return err
+	}
+
+	if c.sweeps() {
+		if _, err = m.db.account(c.SweepToUserID, c.SweepToCurrency); err != nil {
+			return err
+		}
+	}
+
+	if err = c.check(account); err != nil {
+		return err
+	}
+
+	if account.Balance.IsPositive() {
+		c.Sweep, err = c.sweep(account.Balance)
+
+		if err != nil {
+			return err
+		}
+
+		err = m.db.executeTransfer(JournalKindClosure, c.Sweep)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	closedAt := time.Now().Truncate(time.Second)
+
+	account.Status = AccountClosed
+	account.ClosedAt = &closedAt
+	account.setAvailable()
+
+	closed := *account
+	c.Account = &closed
+
+	return nil
+}
+
+// insertRefreshToken issues a refresh token, the caller must hold the lock.
+func (db *memoryDB) insertRefreshToken(sessionID int64, ttl time.Duration) (*Token, error) {
+	token, err := generateToken(ttl)
+
+	if err != nil {
+		return nil, err
+	}
+
+	db.refreshTokens[string(token.Hash)] = &memoryRefreshToken{sessionID: sessionID, expiry: token.Expiry}
+
+	return token, nil
+}
+
+func (m *memorySessions) New(userID int64, refreshTTL time.Duration) (*Session, *Token, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	m.db.lastSessionID++
+
+	session := &Session{ID: m.db.lastSessionID, UserID: userID, CreatedAt: time.Now()}
+
+	token, err := m.db.insertRefreshToken(session.ID, refreshTTL)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stored := *session
+	m.db.sessions[session.ID] = &stored
+
+	return session, token, nil
+}
+
+func (m *memorySessions) Rotate(plaintext string, refreshTTL time.Duration) (*Session, *Token, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	refreshToken, ok := m.db.refreshTokens[string(hashToken(plaintext))]
+
+	if !ok {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	session := m.db.sessions[refreshToken.sessionID]
+
+	if session.RevokedAt != nil || time.Now().After(refreshToken.expiry) {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	if refreshToken.used {
+		now := time.Now()
+		session.RevokedAt = &now
+
+		return nil, nil, ErrRefreshTokenReused
+	}
+
+	refreshToken.used = true
+
+	token, err := m.db.insertRefreshToken(session.ID, refreshTTL)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	found := *session
+
+	return &found, token, nil
+}
+
+func (m *memorySessions) Revoke(sessionID int64) error {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if session, ok := m.db.sessions[sessionID]; ok && session.RevokedAt == nil {
+		now := time.Now()
+		session.RevokedAt = &now
+	}
+
+	return nil
+}
+
+func (m *memorySessions) RevokeAllForUser(userID int64) error {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	now := time.Now()
+
+	for _, session := range m.db.sessions {
+		if session.UserID == userID && session.RevokedAt == nil {
+			session.RevokedAt = &now
+		}
+	}
+
+	return nil
+}
+
+func (m *memorySessions) IsActive(sessionID, userID int64) (bool, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	session, ok := m.db.sessions[sessionID]
+
+	return ok && session.UserID == userID && session.RevokedAt == nil, nil
+}
+
+func (m *memoryMFA) Enroll(userID int64) (*TOTP, error) {
+	secret, err := totp.GenerateSecret()
+
+	if err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if existing, ok := m.db.totp[userID]; ok && existing.ConfirmedAt != nil {
+		return nil, ErrMFAEnabled
+	}
+
+	t := &TOTP{UserID: userID, Secret: secret, CreatedAt: time.Now().Truncate(time.Second)}
+
+	stored := *t
+	m.db.totp[userID] = &stored
+
+	return t, nil
+}
+
+func (m *memoryMFA) Confirm(userID int64, code string) ([]string, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	t, ok := m.db.totp[userID]
+
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	if t.ConfirmedAt != nil {
+		return nil, ErrMFAEnabled
+	}
+
+	counter, ok, err := totp.Validate(t.Secret, code, time.Now())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Truncate(time.Second)
+
+	t.ConfirmedAt = &now
+	t.LastCounter = counter
+
+	m.db.recoveryCodes[userID] = make(map[string]bool)
+
+	for _, hash := range hashes {
+		m.db.recoveryCodes[userID][string(hash)] = false
+	}
+
+	return codes, nil
+}
+
+func (m *memoryMFA) Enabled(userID int64) (bool, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	t, ok := m.db.totp[userID]
+
+	return ok && t.ConfirmedAt != nil, nil
+}
+
+func (m *memoryMFA) Verify(userID int64, code string) error {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if !isTOTPCode(code) {
+		hash := string(hashRecoveryCode(code))
+
+		if used, ok := m.db.recoveryCodes[userID][hash]; !ok || used {
+			return ErrInvalidMFACode
+		}
+
+		m.db.recoveryCodes[userID][hash] = true
+
+		return nil
+	}
+
+	t, ok := m.db.totp[userID]
+
+	if !ok || t.ConfirmedAt == nil {
+		return ErrMFANotEnabled
+	}
+
+	counter, ok, err := totp.Validate(t.Secret, code, time.Now())
+
+	if err != nil {
+		return err
+	}
+
+	if !ok || counter <= t.LastCounter {
+		return ErrInvalidMFACode
+	}
+
+	t.LastCounter = counter
+
+	return nil
+}
+
+func (m *memoryMFA) Disable(userID int64) error {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if _, ok := m.db.totp[userID]; !ok {
+		return ErrMFANotEnabled
+	}
+
+	delete(m.db.totp, userID)
+	delete(m.db.recoveryCodes, userID)
+
+	return nil
+}
+
+func (m *memoryPINs) Insert(userID int64, pin string) error {
+	hash, err := hashPIN(pin)
+
+	if err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if _, ok := m.db.pins[userID]; ok {
+		return ErrPINExists
+	}
+
+	m.db.pins[userID] = &TransactionPIN{UserID: userID, hash: password{hash: hash}}
+
+	return nil
+}
+
+func (m *memoryPINs) Update(userID int64, pin string) error {
+	hash, err := hashPIN(pin)
+
+	if err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if _, ok := m.db.pins[userID]; !ok {
+		return ErrPINNotSet
+	}
+
+	m.db.pins[userID] = &TransactionPIN{UserID: userID, hash: password{hash: hash}}
+
+	return nil
+}
+
+func (m *memoryPINs) Verify(userID int64, pin string) error {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	p, ok := m.db.pins[userID]
+
+	if !ok {
+		return ErrPINNotSet
+	}
+
+	return p.check(pin, time.Now())
+}
+
+func (m *memoryThrottles) Check(keys ...string) error {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	throttles := []*Throttle{}
+
+	for _, key := range keys {
+		if t, ok := m.db.throttles[key]; ok {
+			throttles = append(throttles, t)
+		}
+	}
+
+	return blocked(throttles, time.Now())
+}
+
+func (m *memoryThrottles) Fail(key string, p ThrottlePolicy) error {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	t, ok := m.db.throttles[key]
+
+	if !ok {
+		t = &Throttle{Key: key}
+		m.db.throttles[key] = t
+	}
+
+	p.fail(t, time.Now())
+
+	return nil
+}
+
+func (m *memoryThrottles) Reset(key string) error {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	delete(m.db.throttles, key)
+
+	return nil
+}
+
+func (m *memoryPasswordResets) New(userID int64, ttl time.Duration) (*Token, error) {
+	token, err := generateToken(ttl)
+
+	if err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	for hash, t := range m.db.resetTokens {
+		if t.userID == userID {
+			delete(m.db.resetTokens, hash)
+		}
+	}
+
+	m.db.resetTokens[string(token.Hash)] = &memoryResetToken{userID: userID, expiry: token.Expiry}
+
+	return token, nil
+}
+
+func (m *memoryPasswordResets) Reset(plaintext, newPassword string) (int64, error) {
+	var p password
+
+	err := p.Set(newPassword)
+
+	if err != nil {
+		return 0, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	t, ok := m.db.resetTokens[string(hashToken(plaintext))]
+
+	if !ok || time.Now().After(t.expiry) {
+		return 0, ErrInvalidResetToken
+	}
+
+	user, ok := m.db.users[t.userID]
+
+	if !ok {
+		return 0, ErrRecordNotFound
+	}
+
+	for hash, other := range m.db.resetTokens {
+		if other.userID == t.userID {
+			delete(m.db.resetTokens, hash)
+		}
+	}
+
+	updated := *user
+	updated.Password = p
+	updated.Version++
+	m.db.users[t.userID] = &updated
+
+	return t.userID, nil
+}
+
+func (m *memoryVerifications) New(userID int64, channel, destination string) (*Token, error) {
+	code, err := generateVerificationCode()
+
+	if err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	key := memoryVerificationKey{userID: userID, channel: channel}
+
+	if v, ok := m.db.verifications[key]; ok && v.destination == destination {
+		if until := v.createdAt.Add(verificationResendInterval); time.Now().Before(until) {
+			return nil, &ThrottledError{Key: "verification:" + channel, Until: until}
+		}
+	}
+
+	m.db.verifications[key] = &memoryVerification{
+		destination: destination,
+		hash:        code.Hash,
+		expiry:      code.Expiry,
+		createdAt:   time.Now(),
+	}
+
+	return code, nil
+}
+
+func (m *memoryVerifications) Confirm(userID int64, channel, destination, code string) error {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	key := memoryVerificationKey{userID: userID, channel: channel}
+
+	v, ok := m.db.verifications[key]
+
+	if !ok || v.destination != destination || v.attempts >= verificationMaxAttempts || time.Now().After(v.expiry) {
+		return ErrInvalidVerificationCode
+	}
+
+	if !bytes.Equal(v.hash, hashToken(code)) {
+		v.attempts++
+		return ErrInvalidVerificationCode
+	}
+
+	delete(m.db.verifications, key)
+
+	user, ok := m.db.users[userID]
+
+	if !ok {
+		return ErrInvalidVerificationCode
+	}
+
+	now := time.Now().Truncate(time.Second)
+
+	switch {
+	case channel == ChannelEmail && user.Email == destination:
+		user.EmailVerifiedAt = &now
+	case channel == ChannelPhone && user.Phone == destination:
+		user.PhoneVerifiedAt = &now
+	default:
+		return ErrInvalidVerificationCode
+	}
+
+	user.VerificationLevel = max(user.VerificationLevel, VerificationContact)
+	user.Version++
+
+	return nil
+}
+
+func (m *memoryIdempotency) Begin(userID int64, key string, requestHash []byte) (*IdempotentResponse, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	k := memoryIdempotencyKey{userID, key}
+
+	entry, ok := m.db.idempotency[k]
+
+	if !ok || (entry.response == nil && bytes.Equal(entry.requestHash, requestHash) && time.Since(entry.createdAt) > idempotencyLockTimeout) {
+		m.db.idempotency[k] = &memoryIdempotencyEntry{
+			requestHash: append([]byte(nil), requestHash...),
+			createdAt:   time.Now(),
+		}
+
+		return nil, nil
+	}
+
+	if !bytes.Equal(entry.requestHash, requestHash) {
+		return nil, ErrIdempotencyKeyMismatch
+	}
+
+	if entry.response == nil {
+		return nil, ErrIdempotencyKeyInUse
+	}
+
+	response := *entry.response
+
+	return &response, nil
+}
+
+func (m *memoryIdempotency) Complete(userID int64, key string, response *IdempotentResponse) error {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if entry, ok := m.db.idempotency[memoryIdempotencyKey{userID, key}]; ok {
+		stored := *response
+		stored.Body = append([]byte(nil), response.Body...)
+		entry.response = &stored
+	}
+
+	return nil
+}
+
+func (m *memoryIdempotency) Release(userID int64, key string) error {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	k := memoryIdempotencyKey{userID, key}
+
+	if entry, ok := m.db.idempotency[k]; ok && entry.response == nil {
+		delete(m.db.idempotency, k)
+	}
+
+	return nil
+}
+
+// Insert chains the event straight away, there is no one else to wait for.
+func (m *memoryAudit) Insert(e *AuditEvent) error {
+	before, err := auditJSON(e.Before)
+
+	if err != nil {
+		return err
+	}
+
+	after, err := auditJSON(e.After)
+
+	if err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	seq := int64(len(m.db.auditEvents)) + 1
+
+	var prevHash string
+
+	if seq > 1 {
+		prevHash = m.db.auditEvents[seq-2].Hash
+	}
+
+	e.ID = seq
+	e.OccurredAt = time.Now()
+
+	stored := *e
+
+	if before != nil {
+		stored.Before = before
+	}
+
+	if after != nil {
+		stored.After = after
+	}
+
+	stored.Seq = &seq
+	stored.PrevHash = prevHash
+	stored.Hash, err = stored.hash(seq, prevHash)
+
+	if err != nil {
+		return err
+	}
+
+	m.db.auditEvents = append(m.db.auditEvents, &stored)
+
+	return nil
+}
+
+func (m *memoryAudit) GetAll(filters AuditFilters) ([]*AuditEvent, CursorMetadata, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	events := []*AuditEvent{}
+	metadata := CursorMetadata{PageSize: filters.PageSize}
+
+	for i := len(m.db.auditEvents) - 1; i >= 0; i-- {
+		e := m.db.auditEvents[i]
+
+		if !filters.matches(e) {
+			continue
+		}
+
+		if len(events) == filters.PageSize {
+			metadata.NextCursor = EncodeCursor(events[len(events)-1].ID)
+			break
+		}
+
+		event := *e
+		events = append(events, &event)
+	}
+
+	return events, metadata, nil
+}
+
+func (m *memoryAudit) Chain(limit int) (int, error) {
+	return 0, nil
+}
+
+func (m *memoryAudit) Verify() (*AuditVerification, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	verifier := auditVerifier{result: AuditVerification{Valid: true}}
+
+	for _, e := range m.db.auditEvents {
+		if err := verifier.check(e); err != nil {
+			return nil, err
+		}
+	}
+
+	return &verifier.result, nil
+}
@@ -0,0 +1,299 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrInvalidAPIKey = errors.New("invalid or revoked api key")
+)
+
+// Scopes an API key can be granted.
+const (
+	ScopeOrdersRead  = "orders:read"
+	ScopeOrdersWrite = "orders:write"
+)
+
+var APIKeyScopes = []string{ScopeOrdersRead, ScopeOrdersWrite}
+
+// apiKeyPrefix marks API keys so they are recognisable in logs and secret
+// scanners, the shown prefix also carries the first characters of the secret.
+const (
+	apiKeyPrefix      = "sk_"
+	apiKeyShownLength = len(apiKeyPrefix) + 8
+)
+
+type MerchantModel struct {
+	DB *sql.DB
+}
+
+// Merchant is a shop run by a user, the orders it is paid for are credited to
+// that user's account.
+type Merchant struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// APIKey lets a merchant's servers call the API. Only its hash is stored, the
+// plaintext is returned once when the key is created.
+type APIKey struct {
+	ID         int64      `json:"id"`
+	MerchantID int64      `json:"merchant_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+func ValidateMerchant(v *validator.Validator, merchant *Merchant) {
+	v.ValidateEmpty(merchant.Name, "name")
+	v.Check(len(merchant.Name) <= 100, "name", "must not be more than 100 bytes long")
+}
+
+func ValidateAPIKey(v *validator.Validator, key *APIKey) {
+	v.Check(len(key.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(len(key.Scopes) > 0, "scopes", "must be provided")
+
+	for _, scope := range key.Scopes {
+		v.Check(validator.PermittedValue(scope, APIKeyScopes...), "scopes", "must only contain orders:read or orders:write")
+	}
+}
+
+func (m *MerchantModel) Insert(merchant *Merchant) error {
+	query := `
+		INSERT INTO merchants (user_id, name)
+		VALUES ($1, $2)
+		RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, merchant.UserID, merchant.Name).Scan(&merchant.ID, &merchant.CreatedAt)
+}
+
+func (m *MerchantModel) Get(id int64) (*Merchant, error) {
+	query := `
+		SELECT id, user_id, name, created_at
+		FROM merchants
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var merchant Merchant
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&merchant.ID, &merchant.UserID, &merchant.Name, &merchant.CreatedAt)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &merchant, nil
+}
+
+func (m *MerchantModel) GetAllForUser(userID int64) ([]*Merchant, error) {
+	query := `
+		SELECT id, user_id, name, created_at
+		FROM merchants
+		WHERE user_id = $1
+		ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	merchants := []*Merchant{}
+
+	for rows.Next() {
+		var merchant Merchant
+
+		err = rows.Scan(&merchant.ID, &merchant.UserID, &merchant.Name, &merchant.CreatedAt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		merchants = append(merchants, &merchant)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return merchants, nil
+}
+
+const apiKeyColumns = `id, merchant_id, name, prefix, scopes, last_used_at, revoked_at, created_at`
+
+func scanAPIKey(row rowScanner) (*APIKey, error) {
+	var key APIKey
+
+	err := row.Scan(
+		&key.ID,
+		&key.MerchantID,
+		&key.Name,
+		&key.Prefix,
+		pq.Array(&key.Scopes),
+		&key.LastUsedAt,
+		&key.RevokedAt,
+		&key.CreatedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &key, nil
+}
+
+// NewAPIKey issues a key for the merchant and returns it with its plaintext.
+func (m *MerchantModel) NewAPIKey(key *APIKey) (string, error) {
+	query := `
+		INSERT INTO api_keys (merchant_id, name, prefix, hash, scopes)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	token, err := generateToken(0)
+
+	if err != nil {
+		return "", err
+	}
+
+	plaintext := apiKeyPrefix + token.Plaintext
+
+	key.Prefix = plaintext[:apiKeyShownLength]
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{key.MerchantID, key.Name, key.Prefix, hashToken(plaintext), pq.Array(key.Scopes)}
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&key.ID, &key.CreatedAt)
+
+	if err != nil {
+		return "", err
+	}
+
+	return plaintext, nil
+}
+
+func (m *MerchantModel) GetAPIKeys(merchantID int64) ([]*APIKey, error) {
+	query := `
+		SELECT ` + apiKeyColumns + `
+		FROM api_keys
+		WHERE merchant_id = $1
+		ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, merchantID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	keys := []*APIKey{}
+
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey stops the key from authenticating, revoking a key twice is not
+// an error.
+func (m *MerchantModel) RevokeAPIKey(merchantID, keyID int64) (*APIKey, error) {
+	query := `
+		UPDATE api_keys
+		SET revoked_at = COALESCE(revoked_at, NOW())
+		WHERE id = $1 AND merchant_id = $2
+		RETURNING ` + apiKeyColumns
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return scanAPIKey(m.DB.QueryRowContext(ctx, query, keyID, merchantID))
+}
+
+// Authenticate looks up an unrevoked key by its plaintext and records that it
+// was used.
+func (m *MerchantModel) Authenticate(plaintext string) (*APIKey, *Merchant, error) {
+	query := `
+		UPDATE api_keys
+		SET last_used_at = NOW()
+		WHERE hash = $1 AND revoked_at IS NULL
+		RETURNING ` + apiKeyColumns
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	key, err := scanAPIKey(m.DB.QueryRowContext(ctx, query, hashToken(plaintext)))
+
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			return nil, nil, ErrInvalidAPIKey
+		default:
+			return nil, nil, err
+		}
+	}
+
+	merchant, err := m.Get(key.MerchantID)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return key, merchant, nil
+}
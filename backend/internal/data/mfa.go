@@ -0,0 +1,325 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/totp"
+)
+
+var (
+	ErrMFAEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled  = errors.New("two-factor authentication is not enabled")
+	ErrInvalidMFACode = errors.New("invalid two-factor code")
+)
+
+const recoveryCodeCount = 10
+
+type MFAModel struct {
+	DB *sql.DB
+}
+
+// TOTP is a user's authenticator secret, it only counts as a second factor
+// once a code from it was confirmed.
+type TOTP struct {
+	UserID      int64      `json:"-"`
+	Secret      string     `json:"secret"`
+	ConfirmedAt *time.Time `json:"confirmed_at,omitempty"`
+	LastCounter int64      `json:"-"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// isTOTPCode tells a code from an authenticator from a recovery code.
+func isTOTPCode(code string) bool {
+	if len(code) != totp.Digits {
+		return false
+	}
+
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hashRecoveryCode ignores case, spaces and dashes, recovery codes are
+// typed in from paper.
+func hashRecoveryCode(code string) []byte {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+
+	return hashToken(code)
+}
+
+// generateRecoveryCodes returns recoveryCodeCount codes like
+// "k3q7-m2xa-9fjt-w4pb" and their hashes.
+func generateRecoveryCodes() ([]string, [][]byte, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([][]byte, recoveryCodeCount)
+
+	for i := range codes {
+		b := make([]byte, 10)
+
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+
+		s := strings.ToLower(encoding.EncodeToString(b))
+
+		codes[i] = s[0:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:16]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+
+	return codes, hashes, nil
+}
+
+// Enroll gives the user a new secret to add to their authenticator, replacing
+// one they never confirmed.
+func (m *MFAModel) Enroll(userID int64) (*TOTP, error) {
+	query := `
+		INSERT INTO user_totp (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_counter = 0, created_at = NOW()
+		WHERE user_totp.confirmed_at IS NULL
+		RETURNING created_at`
+
+	secret, err := totp.GenerateSecret()
+
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	t := &TOTP{UserID: userID, Secret: secret}
+
+	err = m.DB.QueryRowContext(ctx, query, userID, secret).Scan(&t.CreatedAt)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrMFAEnabled
+		default:
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+// Confirm turns two-factor authentication on once the user proves their
+// authenticator has the secret, and returns their recovery codes. They are
+// only ever shown this once.
+func (m *MFAModel) Confirm(userID int64, code string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	var t TOTP
+
+	query := `SELECT secret, confirmed_at FROM user_totp WHERE user_id = $1 FOR UPDATE`
+
+	err = tx.QueryRowContext(ctx, query, userID).Scan(&t.Secret, &t.ConfirmedAt)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if t.ConfirmedAt != nil {
+		return nil, ErrMFAEnabled
+	}
+
+	counter, ok, err := totp.Validate(t.Secret, code, time.Now())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	query = `UPDATE user_totp SET confirmed_at = NOW(), last_counter = $1 WHERE user_id = $2`
+
+	_, err = tx.ExecContext(ctx, query, counter, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hash := range hashes {
+		_, err = tx.ExecContext(ctx, `INSERT INTO recovery_codes (user_id, hash) VALUES ($1, $2)`, userID, hash)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (m *MFAModel) Enabled(userID int64) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM user_totp WHERE user_id = $1 AND confirmed_at IS NOT NULL)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var enabled bool
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&enabled)
+
+	return enabled, err
+}
+
+// Verify accepts a code from the user's authenticator or one of their unused
+// recovery codes, using it up. An authenticator code is not accepted twice.
+func (m *MFAModel) Verify(userID int64, code string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if !isTOTPCode(code) {
+		query := `
+			UPDATE recovery_codes
+			SET used_at = NOW()
+			WHERE user_id = $1 AND hash = $2 AND used_at IS NULL`
+
+		result, err := m.DB.ExecContext(ctx, query, userID, hashRecoveryCode(code))
+
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return ErrInvalidMFACode
+		}
+
+		return nil
+	}
+
+	var secret string
+
+	query := `SELECT secret FROM user_totp WHERE user_id = $1 AND confirmed_at IS NOT NULL`
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&secret)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrMFANotEnabled
+		default:
+			return err
+		}
+	}
+
+	counter, ok, err := totp.Validate(secret, code, time.Now())
+
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrInvalidMFACode
+	}
+
+	// only the first request with a code moves the counter past it
+	query = `UPDATE user_totp SET last_counter = $1 WHERE user_id = $2 AND last_counter < $1`
+
+	result, err := m.DB.ExecContext(ctx, query, counter, userID)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrInvalidMFACode
+	}
+
+	return nil
+}
+
+// Disable turns two-factor authentication off and drops the recovery codes.
+func (m *MFAModel) Disable(userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrMFANotEnabled
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -3,20 +3,143 @@ package data
 import (
 	"database/sql"
 	"errors"
+	"time"
 )
 
 var (
 	ErrRecordNotFound = errors.New("record not found")
+	ErrEditConflict   = errors.New("edit conflict")
 )
 
+// UserStore, AccountStore, SessionStore, MFAStore, PINStore, ThrottleStore,
+// PasswordResetStore, VerificationStore, IdempotencyStore and AuditStore are
+// implemented by the Postgres models and by the in-memory store, both return
+// the errors declared in this package.
+type UserStore interface {
+	Insert(user *User) error
+	GetByUsername(username string) (*User, error)
+	GetByID(id int64) (*User, error)
+	GetByEmail(email string) (*User, error)
+	GetUsers(searchTerm string) ([]*User, error)
+	UpdateUser(user *User) error
+	SetRole(id int64, role string) error
+}
+
+type AccountStore interface {
+	CreateAccount(userID int64, currency string) error
+	GetAccounts(userID int64) ([]*Account, error)
+	AddMoney(userID int64, amount Money) error
+	TransferMoney(t *Transfer) error
+	Refund(journalID, recipientID int64, amount *Money) (*Transfer, error)
+	CheckIfUserExists(userID int64) (bool, error)
+	SetStatus(userID int64, currency, status string) ([]*Account, error)
+	Adjust(adj *Adjustment) error
+	Close(c *Closure) error
+}
+
+type SessionStore interface {
+	New(userID int64, refreshTTL time.Duration) (*Session, *Token, error)
+	Rotate(plaintext string, refreshTTL time.Duration) (*Session, *Token, error)
+	Revoke(sessionID int64) error
+	RevokeAllForUser(userID int64) error
+	IsActive(sessionID, userID int64) (bool, error)
+}
+
+type MFAStore interface {
+	Enroll(userID int64) (*TOTP, error)
+	Confirm(userID int64, code string) ([]string, error)
+	Enabled(userID int64) (bool, error)
+	Verify(userID int64, code string) error
+	Disable(userID int64) error
+}
+
+type PINStore interface {
+	Insert(userID int64, pin string) error
+	Update(userID int64, pin string) error
+	Verify(userID int64, pin string) error
+}
+
+type ThrottleStore interface {
+	Check(keys ...string) error
+	Fail(key string, p ThrottlePolicy) error
+	Reset(key string) error
+}
+
+type PasswordResetStore interface {
+	New(userID int64, ttl time.Duration) (*Token, error)
+	Reset(plaintext, password string) (int64, error)
+}
+
+type VerificationStore interface {
+	New(userID int64, channel, destination string) (*Token, error)
+	Confirm(userID int64, channel, destination, code string) error
+}
+
+type LimitStore interface {
+	GetForUser(userID int64) ([]*UserLimits, error)
+}
+
+type IdempotencyStore interface {
+	Begin(userID int64, key string, requestHash []byte) (*IdempotentResponse, error)
+	Complete(userID int64, key string, response *IdempotentResponse) error
+	Release(userID int64, key string) error
+}
+
+// AuditStore chains events as they are inserted. Chain links any left
+// unchained from before that.
+type AuditStore interface {
+	Insert(e *AuditEvent) error
+	GetAll(filters AuditFilters) ([]*AuditEvent, CursorMetadata, error)
+	Chain(limit int) (int, error)
+	Verify() (*AuditVerification, error)
+}
+
 type Models struct {
-	Users    UserModel
-	Accounts AccountModel
+	Users              UserStore
+	Accounts           AccountStore
+	Ledger             LedgerModel
+	Idempotency        IdempotencyStore
+	Sessions           SessionStore
+	MFA                MFAStore
+	PINs               PINStore
+	Throttles          ThrottleStore
+	PasswordResets     PasswordResetStore
+	Verifications      VerificationStore
+	Audit              AuditStore
+	Holds              HoldModel
+	ScheduledTransfers ScheduledTransferModel
+	PaymentRequests    PaymentRequestModel
+	Groups             GroupModel
+	Merchants          MerchantModel
+	Orders             OrderModel
+	Webhooks           WebhookModel
+	Limits             LimitStore
+	RiskReviews        RiskReviewModel
 }
 
 func NewModels(db *sql.DB) Models {
+	risk := DefaultRiskEngine()
+
 	return Models{
-		Users:    UserModel{DB: db},
-		Accounts: AccountModel{DB: db},
+		Users:              &UserModel{DB: db},
+		Accounts:           &AccountModel{DB: db, Risk: risk},
+		Ledger:             LedgerModel{DB: db},
+		Idempotency:        &IdempotencyModel{DB: db},
+		Sessions:           &SessionModel{DB: db},
+		MFA:                &MFAModel{DB: db},
+		PINs:               &PINModel{DB: db},
+		Throttles:          &ThrottleModel{DB: db},
+		PasswordResets:     &PasswordResetModel{DB: db},
+		Verifications:      &VerificationModel{DB: db},
+		Audit:              &AuditModel{DB: db},
+		Holds:              HoldModel{DB: db, Risk: risk},
+		ScheduledTransfers: ScheduledTransferModel{DB: db},
+		PaymentRequests:    PaymentRequestModel{DB: db, Risk: risk},
+		Groups:             GroupModel{DB: db, Risk: risk},
+		Merchants:          MerchantModel{DB: db},
+		Orders:             OrderModel{DB: db, Risk: risk},
+		Webhooks:           WebhookModel{DB: db},
+		Limits:             &LimitModel{DB: db},
+		RiskReviews:        RiskReviewModel{DB: db},
 	}
 }
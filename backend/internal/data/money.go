@@ -0,0 +1,236 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+)
+
+var (
+	ErrInvalidAmount       = errors.New("invalid amount")
+	ErrUnsupportedCurrency = errors.New("unsupported currency")
+	ErrCurrencyMismatch    = errors.New("currency mismatch")
+	ErrAmountOverflow      = errors.New("amount overflow")
+)
+
+const DefaultCurrency = "INR"
+
+// currencyExponents holds the ISO-4217 minor unit exponent of every currency
+// the platform supports.
+var currencyExponents = map[string]int{
+	"AED": 2,
+	"BHD": 3,
+	"EUR": 2,
+	"GBP": 2,
+	"INR": 2,
+	"JPY": 0,
+	"USD": 2,
+}
+
+// Money is an exact amount in the minor unit of its currency, 125.50 INR is
+// stored as 12550.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+func IsSupportedCurrency(currency string) bool {
+	_, ok := currencyExponents[currency]
+	return ok
+}
+
+// CurrencyExponent returns the number of decimal places used by currency.
+func CurrencyExponent(currency string) (int, error) {
+	exp, ok := currencyExponents[currency]
+
+	if !ok {
+		return 0, ErrUnsupportedCurrency
+	}
+
+	return exp, nil
+}
+
+// ParseMoney parses a decimal string such as "125.50" in the given currency.
+// More decimal places than the currency allows is an error, not a rounding.
+func ParseMoney(value, currency string) (Money, error) {
+	exp, err := CurrencyExponent(currency)
+
+	if err != nil {
+		return Money{}, err
+	}
+
+	negative := strings.HasPrefix(value, "-")
+	value = strings.TrimPrefix(value, "-")
+
+	whole, fraction, hasFraction := strings.Cut(value, ".")
+
+	if whole == "" || (hasFraction && fraction == "") || len(fraction) > exp {
+		return Money{}, ErrInvalidAmount
+	}
+
+	for _, c := range whole + fraction {
+		if c < '0' || c > '9' {
+			return Money{}, ErrInvalidAmount
+		}
+	}
+
+	fraction += strings.Repeat("0", exp-len(fraction))
+
+	amount, err := strconv.ParseInt(whole+fraction, 10, 64)
+
+	if err != nil {
+		return Money{}, ErrAmountOverflow
+	}
+
+	if negative {
+		amount = -amount
+	}
+
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// String formats m as a decimal string with the currency's decimal places.
+func (m Money) String() string {
+	exp := currencyExponents[m.Currency]
+
+	digits := strconv.FormatUint(absInt64(m.Amount), 10)
+
+	if len(digits) <= exp {
+		digits = strings.Repeat("0", exp-len(digits)+1) + digits
+	}
+
+	s := digits
+
+	if exp > 0 {
+		s = digits[:len(digits)-exp] + "." + digits[len(digits)-exp:]
+	}
+
+	if m.Amount < 0 {
+		s = "-" + s
+	}
+
+	return s
+}
+
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+func (m Money) Abs() Money {
+	if m.Amount < 0 {
+		return m.Neg()
+	}
+
+	return m
+}
+
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+
+	if (other.Amount > 0 && m.Amount > math.MaxInt64-other.Amount) ||
+		(other.Amount < 0 && m.Amount < math.MinInt64-other.Amount) {
+		return Money{}, ErrAmountOverflow
+	}
+
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}, nil
+}
+
+func (m Money) Sub(other Money) (Money, error) {
+	if other.Amount == math.MinInt64 {
+		return Money{}, ErrAmountOverflow
+	}
+
+	return m.Add(other.Neg())
+}
+
+// Cmp returns -1, 0 or +1 depending on whether m is less than, equal to or
+// greater than other.
+func (m Money) Cmp(other Money) (int, error) {
+	if m.Currency != other.Currency {
+		return 0, ErrCurrencyMismatch
+	}
+
+	switch {
+	case m.Amount < other.Amount:
+		return -1, nil
+	case m.Amount > other.Amount:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+type moneyJSON struct {
+	Value    string `json:"value"`
+	Currency string `json:"currency"`
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(moneyJSON{Value: m.String(), Currency: m.Currency})
+}
+
+func (m *Money) UnmarshalJSON(b []byte) error {
+	var input moneyJSON
+
+	err := json.Unmarshal(b, &input)
+
+	if err != nil {
+		return errors.New(`amount must be an object like {"value": "125.50", "currency": "INR"}`)
+	}
+
+	if input.Currency == "" {
+		return errors.New("amount currency must be provided")
+	}
+
+	money, err := ParseMoney(input.Value, input.Currency)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrUnsupportedCurrency):
+			return errors.New("amount currency is not supported")
+		case errors.Is(err, ErrAmountOverflow):
+			return errors.New("amount is too large")
+		default:
+			return errors.New("amount value must be a decimal string within the currency's decimal places")
+		}
+	}
+
+	*m = money
+
+	return nil
+}
+
+func ValidateMoney(v *validator.Validator, key string, m Money) {
+	v.Check(IsSupportedCurrency(m.Currency), key, "currency is not supported")
+	v.Check(m.IsPositive(), key, "must be greater than 0")
+}
+
+func absInt64(i int64) uint64 {
+	if i < 0 {
+		return uint64(-(i + 1)) + 1
+	}
+
+	return uint64(i)
+}
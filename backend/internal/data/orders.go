@@ -0,0 +1,310 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+)
+
+var (
+	ErrOrderNotPending         = errors.New("order is no longer pending")
+	ErrDuplicateOrderReference = errors.New("an order with this merchant reference already exists")
+)
+
+const (
+	OrderPending   = "pending"
+	OrderPaid      = "paid"
+	OrderCancelled = "cancelled"
+	OrderExpired   = "expired"
+)
+
+// OrderModel screens payments with Risk when it is set.
+type OrderModel struct {
+	DB   *sql.DB
+	Risk *RiskEngine
+}
+
+// Order is created by a merchant at checkout and paid by a customer, paying
+// it transfers the amount to the merchant's user.
+type Order struct {
+	ID                int64      `json:"id"`
+	MerchantID        int64      `json:"merchant_id"`
+	MerchantName      string     `json:"merchant_name"`
+	MerchantUserID    int64      `json:"-"`
+	Amount            Money      `json:"amount"`
+	Description       string     `json:"description"`
+	MerchantReference *string    `json:"merchant_reference,omitempty"`
+	Status            string     `json:"status"`
+	CustomerID        *int64     `json:"customer_id,omitempty"`
+	JournalID         *int64     `json:"transaction_id,omitempty"`
+	ExpiresAt         time.Time  `json:"expires_at"`
+	PaidAt            *time.Time `json:"paid_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+func ValidateOrder(v *validator.Validator, order *Order) {
+	ValidateMoney(v, "amount", order.Amount)
+	v.Check(len(order.Description) <= 280, "description", "must not be more than 280 bytes long")
+	v.Check(order.ExpiresAt.After(time.Now()), "expires_in", "must be in the future")
+
+	if order.MerchantReference != nil {
+		v.ValidateEmpty(*order.MerchantReference, "merchant_reference")
+		v.Check(len(*order.MerchantReference) <= 100, "merchant_reference", "must not be more than 100 bytes long")
+	}
+}
+
+const orderSelect = `
+	SELECT orders.id, merchant_id, merchants.name, merchants.user_id, amount, currency,
+		description, merchant_reference, status, customer_id, journal_id, expires_at,
+		paid_at, orders.created_at, updated_at
+	FROM orders
+	INNER JOIN merchants ON merchants.id = orders.merchant_id`
+
+func scanOrder(row rowScanner) (*Order, error) {
+	var order Order
+
+	err := row.Scan(
+		&order.ID,
+		&order.MerchantID,
+		&order.MerchantName,
+		&order.MerchantUserID,
+		&order.Amount.Amount,
+		&order.Amount.Currency,
+		&order.Description,
+		&order.MerchantReference,
+		&order.Status,
+		&order.CustomerID,
+		&order.JournalID,
+		&order.ExpiresAt,
+		&order.PaidAt,
+		&order.CreatedAt,
+		&order.UpdatedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &order, nil
+}
+
+func (m *OrderModel) Insert(order *Order) error {
+	query := `
+		INSERT INTO orders (merchant_id, amount, currency, description, merchant_reference, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{order.MerchantID, order.Amount.Amount, order.Amount.Currency, order.Description, order.MerchantReference, order.ExpiresAt}
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&order.ID)
+
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "orders_merchant_id_merchant_reference_key"`:
+			return ErrDuplicateOrderReference
+		default:
+			return err
+		}
+	}
+
+	inserted, err := scanOrder(m.DB.QueryRowContext(ctx, orderSelect+` WHERE orders.id = $1`, order.ID))
+
+	if err != nil {
+		return err
+	}
+
+	*order = *inserted
+
+	return nil
+}
+
+func (m *OrderModel) Get(id int64) (*Order, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return scanOrder(m.DB.QueryRowContext(ctx, orderSelect+` WHERE orders.id = $1`, id))
+}
+
+// GetAllForMerchant lists the merchant's orders newest first, optionally only
+// those with status.
+func (m *OrderModel) GetAllForMerchant(merchantID int64, status string) ([]*Order, error) {
+	query := orderSelect + `
+		WHERE merchant_id = $1
+		AND (status = $2 OR $2 = '')
+		ORDER BY orders.id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, merchantID, status)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	orders := []*Order{}
+
+	for rows.Next() {
+		order, err := scanOrder(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		orders = append(orders, order)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+// Pay transfers the order amount from the customer to the merchant's user.
+// A payment risk screening holds leaves the order pending until its review is
+// released.
+func (m *OrderModel) Pay(id, customerID int64) (*Order, *Transfer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer tx.Rollback()
+
+	order, transfer, err := payOrder(ctx, tx, m.Risk, id, customerID)
+
+	if err != nil {
+		return nil, nil, commitScreened(tx, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	return order, transfer, nil
+}
+
+func payOrder(ctx context.Context, tx *sql.Tx, engine *RiskEngine, id, customerID int64) (*Order, *Transfer, error) {
+	lockQuery := orderSelect + `
+		WHERE orders.id = $1
+		FOR UPDATE OF orders`
+
+	updateQuery := `
+		UPDATE orders
+		SET status = 'paid', customer_id = $1, journal_id = $2, paid_at = NOW(), updated_at = NOW()
+		WHERE id = $3
+		RETURNING paid_at, updated_at`
+
+	order, err := scanOrder(tx.QueryRowContext(ctx, lockQuery, id))
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if order.Status != OrderPending || !time.Now().Before(order.ExpiresAt) {
+		return nil, nil, ErrOrderNotPending
+	}
+
+	reference := fmt.Sprintf("order:%d", order.ID)
+
+	transfer := &Transfer{
+		FromUserID: customerID,
+		ToUserID:   order.MerchantUserID,
+		Amount:     order.Amount,
+		Reference:  &reference,
+	}
+
+	origin := &ReviewOrigin{Type: ReviewOriginOrder, ID: order.ID}
+
+	err = screenedTransfer(ctx, tx, engine, JournalKindOrder, transfer, origin)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	order.Status = OrderPaid
+	order.CustomerID = &customerID
+	order.JournalID = &transfer.JournalID
+
+	err = tx.QueryRowContext(ctx, updateQuery, customerID, transfer.JournalID, order.ID).Scan(&order.PaidAt, &order.UpdatedAt)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = insertWebhookEvent(ctx, tx, order.MerchantUserID, &order.MerchantID, WebhookOrderPaid, order)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return order, transfer, nil
+}
+
+// Cancel withdraws a pending order so it can no longer be paid.
+func (m *OrderModel) Cancel(id int64) (*Order, error) {
+	query := `
+		UPDATE orders
+		SET status = 'cancelled', updated_at = NOW()
+		WHERE id = $1 AND status = 'pending' AND expires_at > NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		return nil, ErrOrderNotPending
+	}
+
+	return m.Get(id)
+}
+
+// ExpireDue expires every pending order past its expiry and returns how many
+// there were.
+func (m *OrderModel) ExpireDue() (int64, error) {
+	query := `
+		UPDATE orders
+		SET status = 'expired', updated_at = NOW()
+		WHERE status = 'pending' AND expires_at <= NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,137 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+)
+
+type PasswordResetModel struct {
+	DB *sql.DB
+}
+
+// New issues a password reset token for the user, replacing any they were
+// sent before so that only the latest mail works.
+func (m *PasswordResetModel) New(userID int64, ttl time.Duration) (*Token, error) {
+	token, err := generateToken(ttl)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	query := `
+		DELETE FROM password_reset_tokens
+		WHERE user_id = $1`
+
+	_, err = tx.ExecContext(ctx, query, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		INSERT INTO password_reset_tokens (hash, user_id, expiry)
+		VALUES ($1, $2, $3)`
+
+	_, err = tx.ExecContext(ctx, query, token.Hash, userID, token.Expiry)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// Reset sets the password of the user a token was issued to and uses the
+// token up in the same transaction, so a token only stops working once the
+// password has changed and cannot be used twice. It returns the user's id.
+func (m *PasswordResetModel) Reset(plaintext, newPassword string) (int64, error) {
+	tokenQuery := `
+		DELETE FROM password_reset_tokens
+		WHERE user_id = (
+			SELECT user_id
+			FROM password_reset_tokens
+			WHERE hash = $1 AND expiry > NOW()
+		)
+		RETURNING user_id`
+
+	// the version changes so that an edit made from before the reset cannot
+	// undo it
+	userQuery := `
+		UPDATE users
+		SET password_hash = $1, password_changed_at = NOW(), version = version + 1
+		WHERE id = $2`
+
+	var p password
+
+	// hashed before the transaction, bcrypt is slow on purpose
+	err := p.Set(newPassword)
+
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	var userID int64
+
+	err = tx.QueryRowContext(ctx, tokenQuery, hashToken(plaintext)).Scan(&userID)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrInvalidResetToken
+		default:
+			return 0, err
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, userQuery, p.hash, userID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if rowsAffected == 0 {
+		return 0, ErrRecordNotFound
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
@@ -0,0 +1,364 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrRequestNotPending = errors.New("payment request is no longer pending")
+)
+
+const (
+	PaymentRequestPending   = "pending"
+	PaymentRequestAccepted  = "accepted"
+	PaymentRequestDeclined  = "declined"
+	PaymentRequestCancelled = "cancelled"
+	PaymentRequestExpired   = "expired"
+)
+
+const (
+	PaymentRequestsIncoming = "incoming"
+	PaymentRequestsOutgoing = "outgoing"
+)
+
+// PaymentRequestModel screens acceptances with Risk when it is set.
+type PaymentRequestModel struct {
+	DB   *sql.DB
+	Risk *RiskEngine
+}
+
+// PaymentRequest asks PayerID to pay Amount to RequesterID. The payer accepts
+// it, which transfers the amount, or declines it, the requester can cancel it
+// and a request nobody answers expires.
+type PaymentRequest struct {
+	ID                int64      `json:"id"`
+	RequesterID       int64      `json:"requester_id"`
+	RequesterUsername string     `json:"requester_username"`
+	PayerID           int64      `json:"payer_id"`
+	PayerUsername     string     `json:"payer_username"`
+	Amount            Money      `json:"amount"`
+	Note              string     `json:"note"`
+	Status            string     `json:"status"`
+	JournalID         *int64     `json:"transaction_id,omitempty"`
+	ExpiresAt         time.Time  `json:"expires_at"`
+	RespondedAt       *time.Time `json:"responded_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+func ValidatePaymentRequest(v *validator.Validator, pr *PaymentRequest) {
+	ValidateMoney(v, "amount", pr.Amount)
+	v.Check(pr.PayerID > 0, "payer_id", "must be provided")
+	v.Check(pr.PayerID != pr.RequesterID, "payer_id", "must not be yourself")
+	v.Check(len(pr.Note) <= 280, "note", "must not be more than 280 bytes long")
+	v.Check(pr.ExpiresAt.After(time.Now()), "expires_in", "must be in the future")
+}
+
+// paymentRequestSelect reads payment requests together with the usernames of
+// both parties.
+const paymentRequestSelect = `
+	SELECT payment_requests.id, requester_id, requesters.username, payer_id, payers.username,
+		amount, currency, note, status, journal_id, expires_at, responded_at,
+		payment_requests.created_at, updated_at
+	FROM payment_requests
+	INNER JOIN users requesters ON requesters.id = payment_requests.requester_id
+	INNER JOIN users payers ON payers.id = payment_requests.payer_id`
+
+func scanPaymentRequest(row rowScanner) (*PaymentRequest, error) {
+	var pr PaymentRequest
+
+	err := row.Scan(
+		&pr.ID,
+		&pr.RequesterID,
+		&pr.RequesterUsername,
+		&pr.PayerID,
+		&pr.PayerUsername,
+		&pr.Amount.Amount,
+		&pr.Amount.Currency,
+		&pr.Note,
+		&pr.Status,
+		&pr.JournalID,
+		&pr.ExpiresAt,
+		&pr.RespondedAt,
+		&pr.CreatedAt,
+		&pr.UpdatedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &pr, nil
+}
+
+func (m *PaymentRequestModel) Insert(pr *PaymentRequest) error {
+	query := `
+		INSERT INTO payment_requests (requester_id, payer_id, amount, currency, note, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{pr.RequesterID, pr.PayerID, pr.Amount.Amount, pr.Amount.Currency, pr.Note, pr.ExpiresAt}
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&pr.ID)
+
+	if err != nil {
+		return err
+	}
+
+	inserted, err := scanPaymentRequest(m.DB.QueryRowContext(ctx, paymentRequestSelect+` WHERE payment_requests.id = $1`, pr.ID))
+
+	if err != nil {
+		return err
+	}
+
+	*pr = *inserted
+
+	return nil
+}
+
+func (m *PaymentRequestModel) Get(id int64) (*PaymentRequest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return scanPaymentRequest(m.DB.QueryRowContext(ctx, paymentRequestSelect+` WHERE payment_requests.id = $1`, id))
+}
+
+// GetAllForUser lists the requests the user received (incoming) or sent
+// (outgoing), newest first, optionally only those with status.
+func (m *PaymentRequestModel) GetAllForUser(userID int64, direction, status string) ([]*PaymentRequest, error) {
+	column := "payer_id"
+
+	if direction == PaymentRequestsOutgoing {
+		column = "requester_id"
+	}
+
+	query := paymentRequestSelect + fmt.Sprintf(`
+		WHERE %s = $1
+		AND (status = $2 OR $2 = '')
+		ORDER BY payment_requests.id DESC`, column)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, status)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	requests := []*PaymentRequest{}
+
+	for rows.Next() {
+		pr, err := scanPaymentRequest(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		requests = append(requests, pr)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return requests, nil
+}
+
+// Accept pays the request, transferring its amount from the payer to the
+// requester. An acceptance risk screening holds leaves the request pending
+// until its review is released.
+func (m *PaymentRequestModel) Accept(id int64) (*PaymentRequest, *Transfer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer tx.Rollback()
+
+	pr, transfer, err := acceptPaymentRequest(ctx, tx, m.Risk, id)
+
+	if err != nil {
+		return nil, nil, commitScreened(tx, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	return pr, transfer, nil
+}
+
+func acceptPaymentRequest(ctx context.Context, tx *sql.Tx, engine *RiskEngine, id int64) (*PaymentRequest, *Transfer, error) {
+	lockQuery := paymentRequestSelect + `
+		WHERE payment_requests.id = $1
+		FOR UPDATE OF payment_requests`
+
+	updateQuery := `
+		UPDATE payment_requests
+		SET status = 'accepted', journal_id = $1, responded_at = NOW(), updated_at = NOW()
+		WHERE id = $2
+		RETURNING responded_at, updated_at`
+
+	pr, err := scanPaymentRequest(tx.QueryRowContext(ctx, lockQuery, id))
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if pr.Status != PaymentRequestPending || !time.Now().Before(pr.ExpiresAt) {
+		return nil, nil, ErrRequestNotPending
+	}
+
+	reference := fmt.Sprintf("payment_request:%d", pr.ID)
+
+	transfer := &Transfer{
+		FromUserID: pr.PayerID,
+		ToUserID:   pr.RequesterID,
+		Amount:     pr.Amount,
+		Reference:  &reference,
+	}
+
+	origin := &ReviewOrigin{Type: ReviewOriginPaymentRequest, ID: pr.ID}
+
+	err = screenedTransfer(ctx, tx, engine, JournalKindTransfer, transfer, origin)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pr.Status = PaymentRequestAccepted
+	pr.JournalID = &transfer.JournalID
+
+	err = tx.QueryRowContext(ctx, updateQuery, transfer.JournalID, pr.ID).Scan(&pr.RespondedAt, &pr.UpdatedAt)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pr, transfer, nil
+}
+
+// respond moves a pending request that has not expired to status.
+func (m *PaymentRequestModel) respond(id int64, status string) (*PaymentRequest, error) {
+	query := `
+		UPDATE payment_requests
+		SET status = $1, responded_at = NOW(), updated_at = NOW()
+		WHERE id = $2 AND status = 'pending' AND expires_at > NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, status, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		return nil, ErrRequestNotPending
+	}
+
+	return m.Get(id)
+}
+
+func (m *PaymentRequestModel) Decline(id int64) (*PaymentRequest, error) {
+	return m.respond(id, PaymentRequestDeclined)
+}
+
+func (m *PaymentRequestModel) Cancel(id int64) (*PaymentRequest, error) {
+	return m.respond(id, PaymentRequestCancelled)
+}
+
+// ExpireDue expires every pending request past its expiry and returns them,
+// so that their requesters can be told.
+func (m *PaymentRequestModel) ExpireDue() ([]*PaymentRequest, error) {
+	query := `
+		UPDATE payment_requests
+		SET status = 'expired', updated_at = NOW()
+		WHERE status = 'pending' AND expires_at <= NOW()
+		RETURNING id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var ids []int64
+
+	for rows.Next() {
+		var id int64
+
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	rows, err = m.DB.QueryContext(ctx, paymentRequestSelect+` WHERE payment_requests.id = ANY($1)`, pq.Array(ids))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var expired []*PaymentRequest
+
+	for rows.Next() {
+		pr, err := scanPaymentRequest(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		expired = append(expired, pr)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return expired, nil
+}
@@ -0,0 +1,246 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+)
+
+var (
+	ErrPINExists   = errors.New("transaction PIN is already set")
+	ErrPINNotSet   = errors.New("transaction PIN is not set")
+	ErrInvalidPIN  = errors.New("invalid transaction PIN")
+	ErrPINDisabled = errors.New("transaction PIN is disabled until it is reset")
+)
+
+// After pinMaxAttempts wrong PINs in a row the PIN is locked for pinLockout,
+// a short PIN is otherwise guessed quickly. Each lockout doubles the next
+// one, and after pinMaxLockouts the PIN is disabled until the user resets it
+// with their password.
+const (
+	pinMaxAttempts = 5
+	pinLockout     = 15 * time.Minute
+	pinMaxLockouts = 3
+)
+
+// PINLockedError is returned while a PIN is locked after too many wrong
+// attempts, even for the right PIN.
+type PINLockedError struct {
+	Until time.Time
+}
+
+func (e *PINLockedError) Error() string {
+	return fmt.Sprintf("transaction PIN is locked until %s", e.Until.Format(time.RFC3339))
+}
+
+type PINModel struct {
+	DB *sql.DB
+}
+
+// TransactionPIN is a user's PIN, how many times in a row it was got wrong
+// and how many times it was locked since it was last set.
+type TransactionPIN struct {
+	UserID         int64
+	hash           password
+	FailedAttempts int
+	Lockouts       int
+	LockedUntil    *time.Time
+}
+
+func ValidatePIN(v *validator.Validator, key, pin string) {
+	digits := len(pin) == 4 || len(pin) == 6
+
+	for _, c := range pin {
+		if c < '0' || c > '9' {
+			digits = false
+		}
+	}
+
+	v.Check(digits, key, "must be 4 or 6 digits")
+}
+
+func hashPIN(pin string) ([]byte, error) {
+	var p password
+
+	if err := p.Set(pin); err != nil {
+		return nil, err
+	}
+
+	return p.hash, nil
+}
+
+// check verifies pin at now, counting a wrong PIN and locking the PIN once
+// there were pinMaxAttempts of them in a row. The caller stores p whatever
+// the result.
+func (p *TransactionPIN) check(pin string, now time.Time) error {
+	if p.Lockouts >= pinMaxLockouts {
+		return ErrPINDisabled
+	}
+
+	if p.LockedUntil != nil && now.Before(*p.LockedUntil) {
+		return &PINLockedError{Until: *p.LockedUntil}
+	}
+
+	match, err := p.hash.Match(pin)
+
+	if err != nil {
+		return err
+	}
+
+	if match {
+		p.FailedAttempts = 0
+		p.LockedUntil = nil
+		return nil
+	}
+
+	p.FailedAttempts++
+
+	if p.FailedAttempts >= pinMaxAttempts {
+		p.FailedAttempts = 0
+		p.Lockouts++
+
+		if p.Lockouts >= pinMaxLockouts {
+			p.LockedUntil = nil
+			return ErrPINDisabled
+		}
+
+		until := now.Add(pinLockout << (p.Lockouts - 1)).Truncate(time.Second)
+
+		p.LockedUntil = &until
+
+		return &PINLockedError{Until: until}
+	}
+
+	return ErrInvalidPIN
+}
+
+// Insert sets the user's first PIN.
+func (m *PINModel) Insert(userID int64, pin string) error {
+	query := `
+		INSERT INTO transaction_pins (user_id, hash)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO NOTHING`
+
+	hash, err := hashPIN(pin)
+
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, hash)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrPINExists
+	}
+
+	return nil
+}
+
+// Update replaces the user's PIN and lifts any lockout, the caller has
+// checked the current PIN or the user's password.
+func (m *PINModel) Update(userID int64, pin string) error {
+	query := `
+		UPDATE transaction_pins
+		SET hash = $1, failed_attempts = 0, lockouts = 0, locked_until = NULL, updated_at = NOW()
+		WHERE user_id = $2`
+
+	hash, err := hashPIN(pin)
+
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, hash, userID)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrPINNotSet
+	}
+
+	return nil
+}
+
+// Verify checks pin, failing with ErrInvalidPIN, a PINLockedError or
+// ErrPINDisabled. The attempt is counted before the error is returned.
+func (m *PINModel) Verify(userID int64, pin string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	p := TransactionPIN{UserID: userID}
+
+	query := `
+		SELECT hash, failed_attempts, lockouts, locked_until
+		FROM transaction_pins
+		WHERE user_id = $1
+		FOR UPDATE`
+
+	err = tx.QueryRowContext(ctx, query, userID).Scan(&p.hash.hash, &p.FailedAttempts, &p.Lockouts, &p.LockedUntil)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrPINNotSet
+		default:
+			return err
+		}
+	}
+
+	checkErr := p.check(pin, time.Now())
+
+	if checkErr != nil && !errors.Is(checkErr, ErrInvalidPIN) && !errors.Is(checkErr, ErrPINDisabled) && !errors.As(checkErr, new(*PINLockedError)) {
+		return checkErr
+	}
+
+	query = `
+		UPDATE transaction_pins
+		SET failed_attempts = $1, lockouts = $2, locked_until = $3
+		WHERE user_id = $4`
+
+	_, err = tx.ExecContext(ctx, query, p.FailedAttempts, p.Lockouts, p.LockedUntil, userID)
+
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	return checkErr
+}
@@ -0,0 +1,277 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/big"
+	"time"
+)
+
+var (
+	ErrNotRefundable         = errors.New("transaction cannot be refunded")
+	ErrRefundExceedsOriginal = errors.New("refund exceeds the amount left to refund")
+)
+
+// refundableKinds are the journals that move money between two users.
+var refundableKinds = map[string]bool{
+	JournalKindTransfer: true,
+	JournalKindCapture:  true,
+	JournalKindOrder:    true,
+}
+
+// refundableTransfer is an original transfer as seen when refunding it.
+type refundableTransfer struct {
+	journal    Journal
+	sender     Posting
+	recipient  Posting
+	conversion *Conversion
+}
+
+func lockRefundableTransfer(ctx context.Context, tx *sql.Tx, journalID int64) (*refundableTransfer, error) {
+	journalQuery := `
+		SELECT id, kind, refund_of, created_at
+		FROM journals
+		WHERE id = $1
+		FOR UPDATE`
+
+	postingsQuery := `
+		SELECT id, journal_id, user_id, amount, currency, created_at
+		FROM postings
+		WHERE journal_id = $1 AND user_id IS NOT NULL`
+
+	conversionQuery := `
+		SELECT source_amount, source_currency, target_amount, target_currency, rate, spread_bps
+		FROM fx_conversions
+		WHERE journal_id = $1`
+
+	var original refundableTransfer
+
+	j := &original.journal
+
+	err := tx.QueryRowContext(ctx, journalQuery, journalID).Scan(&j.ID, &j.Kind, &j.RefundOf, &j.CreatedAt)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if !refundableKinds[j.Kind] || j.RefundOf != nil {
+		return nil, ErrNotRefundable
+	}
+
+	rows, err := tx.QueryContext(ctx, postingsQuery, journalID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var p Posting
+
+		err = rows.Scan(&p.ID, &p.JournalID, &p.UserID, &p.Amount.Amount, &p.Amount.Currency, &p.CreatedAt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if p.Amount.IsNegative() {
+			original.sender = p
+		} else {
+			original.recipient = p
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if original.sender.ID == 0 || original.recipient.ID == 0 || original.sender.UserID == original.recipient.UserID {
+		return nil, ErrNotRefundable
+	}
+
+	var c Conversion
+
+	err = tx.QueryRowContext(ctx, conversionQuery, journalID).Scan(
+		&c.Source.Amount,
+		&c.Source.Currency,
+		&c.Target.Amount,
+		&c.Target.Currency,
+		&c.Rate,
+		&c.SpreadBps,
+	)
+
+	switch {
+	case err == nil:
+		original.conversion = &c
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+
+	return &original, nil
+}
+
+// refundedSoFar returns how much of the original has been refunded, both as
+// debited from the recipient and as credited back to the sender.
+func (o *refundableTransfer) refundedSoFar(ctx context.Context, tx *sql.Tx) (debited, credited Money, err error) {
+	query := `
+		SELECT
+			COALESCE(SUM(-postings.amount) FILTER (WHERE postings.user_id = $2 AND postings.currency = $3), 0),
+			COALESCE(SUM(postings.amount) FILTER (WHERE postings.user_id = $4 AND postings.currency = $5), 0)
+		FROM journals
+		INNER JOIN postings ON postings.journal_id = journals.id
+		WHERE journals.refund_of = $1`
+
+	debited.Currency = o.recipient.Amount.Currency
+	credited.Currency = o.sender.Amount.Currency
+
+	args := []interface{}{
+		o.journal.ID,
+		o.recipient.UserID,
+		debited.Currency,
+		o.sender.UserID,
+		credited.Currency,
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&debited.Amount, &credited.Amount)
+
+	return debited, credited, err
+}
+
+// Refund sends amount, in the currency the recipient received, from the
+// recipient of the original transfer back to its sender. Refunds of a
+// transfer never add up to more than the original. When the original was
+// converted, the sender gets back the same share of what they paid, at the
+// original rate.
+func (m *AccountModel) Refund(journalID, recipientID int64, amount *Money) (*Transfer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	original, err := lockRefundableTransfer(ctx, tx, journalID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	debited, credited, err := original.refundedSoFar(ctx, tx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	transfer, err := original.newRefund(recipientID, amount, debited, credited)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = executeTransfer(ctx, tx, JournalKindRefund, transfer)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return transfer, nil
+}
+
+// newRefund builds the transfer refunding amount, or whatever is left when
+// amount is nil, given how much has been refunded already.
+func (o *refundableTransfer) newRefund(recipientID int64, amount *Money, debited, credited Money) (*Transfer, error) {
+	// only the recipient can refund, to anyone else the transfer does not exist
+	if o.recipient.UserID != recipientID {
+		return nil, ErrRecordNotFound
+	}
+
+	remaining, err := o.recipient.Amount.Sub(debited)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !remaining.IsPositive() {
+		return nil, ErrRefundExceedsOriginal
+	}
+
+	refund := remaining
+
+	if amount != nil {
+		refund = *amount
+	}
+
+	cmp, err := refund.Cmp(remaining)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if cmp > 0 {
+		return nil, ErrRefundExceedsOriginal
+	}
+
+	transfer := &Transfer{
+		FromUserID: o.recipient.UserID,
+		ToUserID:   o.sender.UserID,
+		Amount:     refund,
+		RefundOf:   &o.journal.ID,
+	}
+
+	if o.conversion != nil {
+		transfer.Conversion, err = o.refundConversion(refund, debited, credited)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return transfer, nil
+}
+
+// refundConversion converts a refund of a converted transfer back into the
+// sender's currency. The sender's share is computed on the running total so
+// that refunding everything returns exactly what they paid.
+func (o *refundableTransfer) refundConversion(refund, debited, credited Money) (*Conversion, error) {
+	paid := o.sender.Amount.Neg()
+	received := o.recipient.Amount
+
+	share := func(part int64) int64 {
+		n := new(big.Int).Mul(big.NewInt(paid.Amount), big.NewInt(part))
+		return n.Quo(n, big.NewInt(received.Amount)).Int64()
+	}
+
+	target := share(debited.Amount+refund.Amount) - credited.Amount
+
+	if target <= 0 {
+		return nil, ErrConversionTooSmall
+	}
+
+	rate := new(big.Rat)
+	rate.SetString(o.conversion.Rate)
+
+	if rate.Sign() > 0 {
+		rate.Inv(rate)
+	}
+
+	return &Conversion{
+		Rate:      rate.FloatString(rateDecimals),
+		SpreadBps: 0,
+		Source:    refund,
+		Target:    Money{Amount: target, Currency: paid.Currency},
+	}, nil
+}
@@ -0,0 +1,509 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrTransferBlocked  = errors.New("transfer was blocked by risk screening")
+	ErrReviewNotPending = errors.New("review is no longer pending")
+)
+
+const (
+	ReviewPending  = "pending"
+	ReviewReleased = "released"
+	ReviewRejected = "rejected"
+	ReviewBlocked  = "blocked"
+)
+
+// TransferHeldError is returned instead of making a transfer that risk
+// screening held for review. Its amount stays reserved in the sender's wallet
+// until the review is released or rejected.
+type TransferHeldError struct {
+	Review *RiskReview
+}
+
+func (e *TransferHeldError) Error() string {
+	return "transfer was held for review"
+}
+
+// Origins of a held transfer that was not a plain transfer. Releasing its
+// review completes the origin as well as making the transfer.
+const (
+	ReviewOriginPaymentRequest = "payment_request"
+	ReviewOriginOrder          = "order"
+	ReviewOriginHold           = "hold"
+	ReviewOriginGroup          = "group"
+)
+
+// ReviewOrigin is what a held transfer was made for. The amount of a capture
+// is already reserved by its hold, so its review reserves nothing more.
+type ReviewOrigin struct {
+	Type string `json:"type"`
+	ID   int64  `json:"id"`
+}
+
+type RiskReviewModel struct {
+	DB *sql.DB
+}
+
+// RiskReview is a transfer that risk screening held or blocked. A pending
+// review is released, which makes the transfer, or rejected.
+type RiskReview struct {
+	ID         int64         `json:"id"`
+	UserID     int64         `json:"user_id"`
+	ToUserID   int64         `json:"to_user_id"`
+	Amount     Money         `json:"amount"`
+	Conversion *Conversion   `json:"conversion,omitempty"`
+	Reference  *string       `json:"reference,omitempty"`
+	Origin     *ReviewOrigin `json:"origin,omitempty"`
+	Score      int           `json:"score"`
+	Decision   string        `json:"decision"`
+	Signals    []RiskSignal  `json:"signals"`
+	Status     string        `json:"status"`
+	JournalID  *int64        `json:"transaction_id,omitempty"`
+	ReviewedBy *int64        `json:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time    `json:"reviewed_at,omitempty"`
+	Note       string        `json:"note"`
+	CreatedAt  time.Time     `json:"created_at"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+}
+
+// Transfer is the transfer the review holds.
+func (r *RiskReview) Transfer() *Transfer {
+	return &Transfer{
+		FromUserID: r.UserID,
+		ToUserID:   r.ToUserID,
+		Amount:     r.Amount,
+		Conversion: r.Conversion,
+		Reference:  r.Reference,
+	}
+}
+
+const riskReviewColumns = `
+	id, user_id, to_user_id, amount, currency, conversion, reference, origin_type, origin_id,
+	score, decision, signals, status, journal_id, reviewed_by, reviewed_at, note, created_at, updated_at`
+
+func scanRiskReview(row rowScanner) (*RiskReview, error) {
+	var (
+		review     RiskReview
+		conversion []byte
+		signals    []byte
+		originType sql.NullString
+		originID   sql.NullInt64
+	)
+
+	err := row.Scan(
+		&review.ID,
+		&review.UserID,
+		&review.ToUserID,
+		&review.Amount.Amount,
+		&review.Amount.Currency,
+		&conversion,
+		&review.Reference,
+		&originType,
+		&originID,
+		&review.Score,
+		&review.Decision,
+		&signals,
+		&review.Status,
+		&review.JournalID,
+		&review.ReviewedBy,
+		&review.ReviewedAt,
+		&review.Note,
+		&review.CreatedAt,
+		&review.UpdatedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if conversion != nil {
+		if err = json.Unmarshal(conversion, &review.Conversion); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = json.Unmarshal(signals, &review.Signals); err != nil {
+		return nil, err
+	}
+
+	if originType.Valid {
+		review.Origin = &ReviewOrigin{Type: originType.String, ID: originID.Int64}
+	}
+
+	return &review, nil
+}
+
+// checkRisk screens t with engine, unless engine is nil. A transfer screening
+// holds fails with a TransferHeldError and one it blocks with
+// ErrTransferBlocked, the review is recorded in tx and the caller passes the
+// error through commitScreened.
+func checkRisk(ctx context.Context, tx *sql.Tx, engine *RiskEngine, t *Transfer, origin *ReviewOrigin) error {
+	if engine == nil {
+		return nil
+	}
+
+	review, err := screenTransfer(ctx, tx, engine, t, origin)
+
+	if err != nil || review == nil {
+		return err
+	}
+
+	if review.Status == ReviewBlocked {
+		return ErrTransferBlocked
+	}
+
+	return &TransferHeldError{Review: review}
+}
+
+// screenedTransfer performs t as part of tx when risk screening allows it.
+func screenedTransfer(ctx context.Context, tx *sql.Tx, engine *RiskEngine, kind string, t *Transfer, origin *ReviewOrigin) error {
+	if err := checkRisk(ctx, tx, engine, t, origin); err != nil {
+		return err
+	}
+
+	return executeTransfer(ctx, tx, kind, t)
+}
+
+// commitScreened commits tx when err is the outcome of risk screening, so the
+// review it recorded is kept, and returns err.
+func commitScreened(tx *sql.Tx, err error) error {
+	var held *TransferHeldError
+
+	if errors.Is(err, ErrTransferBlocked) || errors.As(err, &held) {
+		if cerr := tx.Commit(); cerr != nil {
+			return cerr
+		}
+	}
+
+	return err
+}
+
+// screenTransfer assesses t once its wallets are locked. A transfer that is
+// not allowed is recorded as a review, reserving its amount when it is held,
+// and the review is returned. A transfer whose origin already has a pending
+// review between the same users returns that review instead of a second one.
+func screenTransfer(ctx context.Context, tx *sql.Tx, engine *RiskEngine, t *Transfer, origin *ReviewOrigin) (*RiskReview, error) {
+	query := `
+		INSERT INTO risk_reviews (user_id, to_user_id, amount, currency, conversion, reference, origin_type, origin_id,
+			score, decision, signals, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING ` + riskReviewColumns
+
+	pendingQuery := `
+		SELECT ` + riskReviewColumns + `
+		FROM risk_reviews
+		WHERE origin_type = $1 AND origin_id = $2 AND user_id = $3 AND to_user_id = $4 AND status = 'pending'
+		LIMIT 1`
+
+	from := walletKey{t.FromUserID, t.Amount.Currency}
+
+	to := walletKey{t.ToUserID, t.Credit().Currency}
+
+	accounts, err := lockAccounts(ctx, tx, from, to)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// there is nothing to review about a transfer that cannot happen
+	if err = accounts[from].checkDebit(); err != nil {
+		return nil, err
+	}
+
+	if err = accounts[to].checkCredit(); err != nil {
+		return nil, err
+	}
+
+	var (
+		originType *string
+		originID   *int64
+	)
+
+	if origin != nil {
+		originType, originID = &origin.Type, &origin.ID
+
+		review, err := scanRiskReview(tx.QueryRowContext(ctx, pendingQuery, origin.Type, origin.ID, t.FromUserID, t.ToUserID))
+
+		switch {
+		case err == nil:
+			return review, nil
+		case !errors.Is(err, ErrRecordNotFound):
+			return nil, err
+		}
+	}
+
+	assessment, err := engine.Assess(ctx, tx, t)
+
+	if err != nil || assessment.Decision == RiskDecisionAllow {
+		return nil, err
+	}
+
+	status := ReviewBlocked
+
+	if assessment.Decision == RiskDecisionReview {
+		status = ReviewPending
+
+		if !origin.reserved() {
+			if accounts[from].Available.Amount < t.Amount.Amount {
+				return nil, ErrInsuffientBalance
+			}
+
+			err = updateHeld(ctx, tx, t.FromUserID, t.Amount)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var conversion []byte
+
+	if t.Conversion != nil {
+		conversion, err = json.Marshal(t.Conversion)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	signals, err := json.Marshal(assessment.Signals)
+
+	if err != nil {
+		return nil, err
+	}
+
+	args := []interface{}{
+		t.FromUserID, t.ToUserID, t.Amount.Amount, t.Amount.Currency, conversion, t.Reference, originType, originID,
+		assessment.Score, assessment.Decision, signals, status,
+	}
+
+	return scanRiskReview(tx.QueryRowContext(ctx, query, args...))
+}
+
+// reserved tells whether the amount of a transfer from o is reserved before
+// it is screened.
+func (o *ReviewOrigin) reserved() bool {
+	return o != nil && o.Type == ReviewOriginHold
+}
+
+func (m *RiskReviewModel) Get(id int64) (*RiskReview, error) {
+	query := `SELECT ` + riskReviewColumns + ` FROM risk_reviews WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return scanRiskReview(m.DB.QueryRowContext(ctx, query, id))
+}
+
+// GetAll lists the reviews with status, the oldest first so that the queue is
+// worked in order, or every review newest first when status is empty.
+func (m *RiskReviewModel) GetAll(status string) ([]*RiskReview, error) {
+	query := `
+		SELECT ` + riskReviewColumns + `
+		FROM risk_reviews
+		WHERE status = $1 OR $1 = ''
+		ORDER BY CASE WHEN $1 = '' THEN -id ELSE id END
+		LIMIT 500`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, status)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	reviews := []*RiskReview{}
+
+	for rows.Next() {
+		review, err := scanRiskReview(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		reviews = append(reviews, review)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reviews, nil
+}
+
+// lockPendingReview locks the review until tx ends and returns the reserved
+// amount to the sender's available balance. It fails unless the review is
+// still pending.
+func lockPendingReview(ctx context.Context, tx *sql.Tx, id int64) (*RiskReview, error) {
+	query := `SELECT ` + riskReviewColumns + ` FROM risk_reviews WHERE id = $1 FOR UPDATE`
+
+	review, err := scanRiskReview(tx.QueryRowContext(ctx, query, id))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if review.Status != ReviewPending {
+		return nil, ErrReviewNotPending
+	}
+
+	// the wallets are locked before the held amount changes, in the same
+	// order as every transfer
+	_, err = lockAccounts(ctx, tx,
+		walletKey{review.UserID, review.Amount.Currency},
+		walletKey{review.ToUserID, review.Transfer().Credit().Currency},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !review.Origin.reserved() {
+		err = updateHeld(ctx, tx, review.UserID, review.Amount.Neg())
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return review, nil
+}
+
+// finishReview records the outcome of a pending review.
+func finishReview(ctx context.Context, tx *sql.Tx, review *RiskReview, reviewerID int64, note string) error {
+	query := `
+		UPDATE risk_reviews
+		SET status = $1, journal_id = $2, reviewed_by = $3, reviewed_at = NOW(), note = $4, updated_at = NOW()
+		WHERE id = $5
+		RETURNING reviewed_at, updated_at`
+
+	review.ReviewedBy = &reviewerID
+	review.Note = note
+
+	args := []interface{}{review.Status, review.JournalID, reviewerID, note, review.ID}
+
+	return tx.QueryRowContext(ctx, query, args...).Scan(&review.ReviewedAt, &review.UpdatedAt)
+}
+
+// releaseTransfer makes the transfer review held, completing its origin.
+func releaseTransfer(ctx context.Context, tx *sql.Tx, review *RiskReview) (*Transfer, error) {
+	var (
+		transfer *Transfer
+		err      error
+	)
+
+	if review.Origin == nil {
+		transfer = review.Transfer()
+
+		return transfer, executeTransfer(ctx, tx, JournalKindTransfer, transfer)
+	}
+
+	id := review.Origin.ID
+
+	switch review.Origin.Type {
+	case ReviewOriginPaymentRequest:
+		_, transfer, err = acceptPaymentRequest(ctx, tx, nil, id)
+	case ReviewOriginOrder:
+		_, transfer, err = payOrder(ctx, tx, nil, id, review.UserID)
+	case ReviewOriginHold:
+		_, transfer, err = captureHold(ctx, tx, nil, id, review.Amount)
+	case ReviewOriginGroup:
+		_, transfer, err = settle(ctx, tx, nil, id, review.UserID, review.ToUserID, &review.Amount)
+	default:
+		err = fmt.Errorf("unknown review origin %q", review.Origin.Type)
+	}
+
+	return transfer, err
+}
+
+// Release makes the transfer a pending review held, it is still bound by the
+// sender's limits and balance and by the state of its origin.
+func (m *RiskReviewModel) Release(id, reviewerID int64, note string) (*RiskReview, *Transfer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer tx.Rollback()
+
+	review, err := lockPendingReview(ctx, tx, id)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	transfer, err := releaseTransfer(ctx, tx, review)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	review.Status = ReviewReleased
+	review.JournalID = &transfer.JournalID
+
+	err = finishReview(ctx, tx, review, reviewerID, note)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	return review, transfer, nil
+}
+
+// Reject drops the transfer a pending review held and makes its amount
+// available to the sender again.
+func (m *RiskReviewModel) Reject(id, reviewerID int64, note string) (*RiskReview, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	review, err := lockPendingReview(ctx, tx, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	review.Status = ReviewRejected
+
+	err = finishReview(ctx, tx, review, reviewerID, note)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return review, nil
+}
@@ -0,0 +1,228 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Decisions of the risk engine. A transfer that is allowed goes through, one
+// under review is held until someone releases or rejects it and a blocked one
+// never happens.
+const (
+	RiskDecisionAllow  = "allow"
+	RiskDecisionReview = "review"
+	RiskDecisionBlock  = "block"
+)
+
+// RiskRule scores one kind of suspicious transfer. Evaluate runs inside the
+// transaction of the transfer, after the wallets are locked, and returns a
+// score of zero when the rule does not apply.
+type RiskRule interface {
+	Name() string
+	Evaluate(ctx context.Context, tx *sql.Tx, t *Transfer) (score int, reason string, err error)
+}
+
+// RiskSignal is a rule that scored a transfer and why.
+type RiskSignal struct {
+	Rule   string `json:"rule"`
+	Score  int    `json:"score"`
+	Reason string `json:"reason"`
+}
+
+type RiskAssessment struct {
+	Score    int          `json:"score"`
+	Decision string       `json:"decision"`
+	Signals  []RiskSignal `json:"signals"`
+}
+
+// RiskEngine adds up the scores of its rules, a transfer scoring ReviewScore
+// or more is held for review and one scoring BlockScore or more is blocked.
+type RiskEngine struct {
+	Rules       []RiskRule
+	ReviewScore int
+	BlockScore  int
+}
+
+// DefaultRiskEngine returns the engine with the built-in rules.
+func DefaultRiskEngine() *RiskEngine {
+	return &RiskEngine{
+		Rules: []RiskRule{
+			NewRecipientRule{LargeAmounts: map[string]int64{"INR": 2500000, "USD": 50000, "EUR": 50000, "GBP": 40000}, Score: 40},
+			FanOutRule{Window: time.Hour, Recipients: 5, Score: 40},
+			RoundTripRule{Window: 24 * time.Hour, Score: 30},
+			PasswordChangeRule{Window: 24 * time.Hour, Score: 40},
+		},
+		ReviewScore: 50,
+		BlockScore:  100,
+	}
+}
+
+func (e *RiskEngine) Assess(ctx context.Context, tx *sql.Tx, t *Transfer) (*RiskAssessment, error) {
+	assessment := &RiskAssessment{Decision: RiskDecisionAllow, Signals: []RiskSignal{}}
+
+	for _, rule := range e.Rules {
+		score, reason, err := rule.Evaluate(ctx, tx, t)
+
+		if err != nil {
+			return nil, fmt.Errorf("risk rule %s: %w", rule.Name(), err)
+		}
+
+		if score == 0 {
+			continue
+		}
+
+		assessment.Score += score
+		assessment.Signals = append(assessment.Signals, RiskSignal{Rule: rule.Name(), Score: score, Reason: reason})
+	}
+
+	switch {
+	case assessment.Score >= e.BlockScore:
+		assessment.Decision = RiskDecisionBlock
+	case assessment.Score >= e.ReviewScore:
+		assessment.Decision = RiskDecisionReview
+	}
+
+	return assessment, nil
+}
+
+// sentToQuery tells whether $1 has ever sent money to $2 since $3.
+const sentToQuery = `
+	SELECT EXISTS (
+		SELECT 1
+		FROM postings debits
+		INNER JOIN postings credits ON credits.journal_id = debits.journal_id AND credits.amount > 0
+		INNER JOIN journals ON journals.id = debits.journal_id
+		WHERE debits.user_id = $1 AND debits.amount < 0 AND credits.user_id = $2
+		AND journals.kind = ANY($4) AND debits.created_at >= $3
+	)`
+
+// NewRecipientRule scores a transfer of at least the large amount of its
+// currency to someone the sender never paid before. Currencies without a
+// large amount are not scored.
+type NewRecipientRule struct {
+	LargeAmounts map[string]int64
+	Score        int
+}
+
+func (r NewRecipientRule) Name() string {
+	return "new_recipient_large_amount"
+}
+
+func (r NewRecipientRule) Evaluate(ctx context.Context, tx *sql.Tx, t *Transfer) (int, string, error) {
+	large, ok := r.LargeAmounts[t.Amount.Currency]
+
+	if !ok || t.Amount.Amount < large {
+		return 0, "", nil
+	}
+
+	var paidBefore bool
+
+	err := tx.QueryRowContext(ctx, sentToQuery, t.FromUserID, t.ToUserID, time.Time{}, pq.Array(limitedKinds)).Scan(&paidBefore)
+
+	if err != nil || paidBefore {
+		return 0, "", err
+	}
+
+	return r.Score, "large amount to a recipient never paid before", nil
+}
+
+// FanOutRule scores a transfer that makes the sender's Recipients-th distinct
+// recipient within Window, mule accounts empty themselves this way.
+type FanOutRule struct {
+	Window     time.Duration
+	Recipients int
+	Score      int
+}
+
+func (r FanOutRule) Name() string {
+	return "rapid_fan_out"
+}
+
+func (r FanOutRule) Evaluate(ctx context.Context, tx *sql.Tx, t *Transfer) (int, string, error) {
+	query := `
+		SELECT COUNT(DISTINCT credits.user_id)
+		FROM postings debits
+		INNER JOIN postings credits ON credits.journal_id = debits.journal_id AND credits.amount > 0
+		INNER JOIN journals ON journals.id = debits.journal_id
+		WHERE debits.user_id = $1 AND debits.amount < 0 AND credits.user_id <> $2
+		AND credits.user_id IS NOT NULL
+		AND journals.kind = ANY($4) AND debits.created_at >= $3`
+
+	var others int
+
+	err := tx.QueryRowContext(ctx, query, t.FromUserID, t.ToUserID, time.Now().Add(-r.Window), pq.Array(limitedKinds)).Scan(&others)
+
+	if err != nil {
+		return 0, "", err
+	}
+
+	if others+1 < r.Recipients {
+		return 0, "", nil
+	}
+
+	return r.Score, fmt.Sprintf("%d recipients within %s", others+1, r.Window), nil
+}
+
+// RoundTripRule scores sending money back to someone who paid the sender
+// within Window, which moves money without a reason to.
+type RoundTripRule struct {
+	Window time.Duration
+	Score  int
+}
+
+func (r RoundTripRule) Name() string {
+	return "round_trip"
+}
+
+func (r RoundTripRule) Evaluate(ctx context.Context, tx *sql.Tx, t *Transfer) (int, string, error) {
+	var paidByRecipient bool
+
+	err := tx.QueryRowContext(ctx, sentToQuery, t.ToUserID, t.FromUserID, time.Now().Add(-r.Window), pq.Array(limitedKinds)).Scan(&paidByRecipient)
+
+	if err != nil || !paidByRecipient {
+		return 0, "", err
+	}
+
+	return r.Score, fmt.Sprintf("recipient paid the sender within %s", r.Window), nil
+}
+
+// PasswordChangeRule scores the first transfer made within Window of a
+// password change, which is how a taken over account is usually emptied.
+type PasswordChangeRule struct {
+	Window time.Duration
+	Score  int
+}
+
+func (r PasswordChangeRule) Name() string {
+	return "first_transfer_after_password_change"
+}
+
+func (r PasswordChangeRule) Evaluate(ctx context.Context, tx *sql.Tx, t *Transfer) (int, string, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM users
+			WHERE id = $1 AND password_changed_at >= $2
+			AND NOT EXISTS (
+				SELECT 1
+				FROM postings
+				INNER JOIN journals ON journals.id = postings.journal_id
+				WHERE postings.user_id = users.id AND postings.amount < 0
+				AND journals.kind = ANY($3) AND postings.created_at >= users.password_changed_at
+			)
+		)`
+
+	var first bool
+
+	err := tx.QueryRowContext(ctx, query, t.FromUserID, time.Now().Add(-r.Window), pq.Array(limitedKinds)).Scan(&first)
+
+	if err != nil || !first {
+		return 0, "", err
+	}
+
+	return r.Score, fmt.Sprintf("first transfer within %s of a password change", r.Window), nil
+}
@@ -0,0 +1,66 @@
+package data
+
+import (
+	"slices"
+)
+
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+// Permission codes checked by the admin endpoints.
+const (
+	PermissionUsersRead          = "users:read"
+	PermissionUsersResetPassword = "users:reset_password"
+	PermissionUsersUnlock        = "users:unlock"
+	PermissionRolesAssign        = "roles:assign"
+	PermissionAccountsFreeze     = "accounts:freeze"
+	PermissionAccountsClose      = "accounts:close"
+	PermissionBalancesAdjust     = "balances:adjust"
+	PermissionReviewsManage      = "reviews:manage"
+	PermissionAuditRead          = "audit:read"
+)
+
+// Permissions is the set of permission codes a user holds.
+type Permissions []string
+
+func (p Permissions) Include(code string) bool {
+	return slices.Contains(p, code)
+}
+
+// rolePermissions grants support staff what they need for tickets and admins
+// everything, users get nothing beyond their own data.
+var rolePermissions = map[string]Permissions{
+	RoleUser: {},
+	RoleSupport: {
+		PermissionUsersRead,
+		PermissionUsersResetPassword,
+		PermissionUsersUnlock,
+		PermissionAccountsFreeze,
+		PermissionAuditRead,
+	},
+	RoleAdmin: {
+		PermissionUsersRead,
+		PermissionUsersResetPassword,
+		PermissionUsersUnlock,
+		PermissionRolesAssign,
+		PermissionAccountsFreeze,
+		PermissionAccountsClose,
+		PermissionBalancesAdjust,
+		PermissionReviewsManage,
+		PermissionAuditRead,
+	},
+}
+
+func IsRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// PermissionsForRole returns the permissions of role, an unknown role has
+// none.
+func PermissionsForRole(role string) Permissions {
+	return slices.Clone(rolePermissions[role])
+}
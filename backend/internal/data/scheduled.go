@@ -0,0 +1,479 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+)
+
+var (
+	ErrScheduleNotActive = errors.New("scheduled transfer is no longer active")
+)
+
+const (
+	FrequencyOnce    = "once"
+	FrequencyDaily   = "daily"
+	FrequencyWeekly  = "weekly"
+	FrequencyMonthly = "monthly"
+)
+
+const (
+	ScheduleStatusActive    = "active"
+	ScheduleStatusCompleted = "completed"
+	ScheduleStatusCancelled = "cancelled"
+	ScheduleStatusFailed    = "failed"
+)
+
+const (
+	ScheduledRunSucceeded = "succeeded"
+	ScheduledRunFailed    = "failed"
+)
+
+// scheduledRetryDelays are the waits before retrying a failed occurrence,
+// once they are used up the occurrence is skipped.
+var scheduledRetryDelays = []time.Duration{15 * time.Minute, time.Hour, 6 * time.Hour}
+
+type ScheduledTransferModel struct {
+	DB *sql.DB
+}
+
+// ScheduledTransfer sends Amount to ToUserID at StartAt and, unless the
+// frequency is once, on every following day, week or month until EndAt or
+// MaxRuns occurrences. Occurrences counts the ones already run or skipped.
+type ScheduledTransfer struct {
+	ID          int64                   `json:"id"`
+	UserID      int64                   `json:"user_id"`
+	ToUserID    int64                   `json:"to_user_id"`
+	Amount      Money                   `json:"amount"`
+	Frequency   string                  `json:"frequency"`
+	StartAt     time.Time               `json:"start_at"`
+	EndAt       *time.Time              `json:"end_at,omitempty"`
+	MaxRuns     *int                    `json:"max_runs,omitempty"`
+	Occurrences int                     `json:"occurrences"`
+	Attempts    int                     `json:"attempts"`
+	NextRunAt   *time.Time              `json:"next_run_at,omitempty"`
+	Status      string                  `json:"status"`
+	CreatedAt   time.Time               `json:"created_at"`
+	UpdatedAt   time.Time               `json:"updated_at"`
+	Runs        []*ScheduledTransferRun `json:"runs,omitempty"`
+}
+
+// ScheduledTransferRun is one attempt at an occurrence.
+type ScheduledTransferRun struct {
+	ID         int64     `json:"id"`
+	Occurrence int       `json:"occurrence"`
+	Attempt    int       `json:"attempt"`
+	Status     string    `json:"status"`
+	JournalID  *int64    `json:"transaction_id,omitempty"`
+	Error      *string   `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+var frequencies = []string{FrequencyOnce, FrequencyDaily, FrequencyWeekly, FrequencyMonthly}
+
+func ValidateScheduledTransfer(v *validator.Validator, st *ScheduledTransfer) {
+	ValidateMoney(v, "amount", st.Amount)
+	v.Check(st.ToUserID > 0, "to_user_id", "must be provided")
+	v.Check(st.ToUserID != st.UserID, "to_user_id", "must not be yourself")
+	v.Check(validator.PermittedValue(st.Frequency, frequencies...), "frequency", "must be once, daily, weekly or monthly")
+	v.Check(st.StartAt.After(time.Now()), "start_at", "must be in the future")
+
+	if st.EndAt != nil {
+		v.Check(st.EndAt.After(st.StartAt), "end_at", "must be after start_at")
+		v.Check(st.Frequency != FrequencyOnce, "end_at", "must not be set for a one-off transfer")
+	}
+
+	if st.MaxRuns != nil {
+		v.Check(*st.MaxRuns > 0, "max_runs", "must be greater than zero")
+		v.Check(st.Frequency != FrequencyOnce, "max_runs", "must not be set for a one-off transfer")
+	}
+}
+
+// occurrenceAt returns when occurrence n is due, counting from zero. Monthly
+// transfers starting late in the month run on the last day of shorter months.
+func (st *ScheduledTransfer) occurrenceAt(n int) time.Time {
+	switch st.Frequency {
+	case FrequencyDaily:
+		return st.StartAt.AddDate(0, 0, n)
+	case FrequencyWeekly:
+		return st.StartAt.AddDate(0, 0, 7*n)
+	case FrequencyMonthly:
+		t := st.StartAt
+		first := time.Date(t.Year(), t.Month()+time.Month(n), 1, t.Hour(), t.Minute(), t.Second(), 0, t.Location())
+		lastDay := first.AddDate(0, 1, -1).Day()
+		return first.AddDate(0, 0, min(t.Day(), lastDay)-1)
+	default:
+		return st.StartAt
+	}
+}
+
+// scheduleNext moves on to the next occurrence, completing the schedule when
+// there is none left.
+func (st *ScheduledTransfer) scheduleNext() {
+	st.Attempts = 0
+
+	next := st.occurrenceAt(st.Occurrences)
+
+	done := st.Frequency == FrequencyOnce && st.Occurrences > 0 ||
+		st.MaxRuns != nil && st.Occurrences >= *st.MaxRuns ||
+		st.EndAt != nil && next.After(*st.EndAt)
+
+	if done {
+		st.Status = ScheduleStatusCompleted
+		st.NextRunAt = nil
+		return
+	}
+
+	st.NextRunAt = &next
+}
+
+// Reference identifies the current occurrence. Every attempt at it uses the
+// same reference, so it can only ever be transferred once.
+func (st *ScheduledTransfer) Reference() string {
+	return fmt.Sprintf("scheduled_transfer:%d:%d", st.ID, st.Occurrences)
+}
+
+// Transfer returns the transfer for the current occurrence.
+func (st *ScheduledTransfer) Transfer() *Transfer {
+	reference := st.Reference()
+
+	return &Transfer{
+		FromUserID: st.UserID,
+		ToUserID:   st.ToUserID,
+		Amount:     st.Amount,
+		Reference:  &reference,
+	}
+}
+
+// permanentTransferError reports errors that retrying cannot fix.
+func permanentTransferError(err error) bool {
+	var held *TransferHeldError
+
+	// a held occurrence is made when its review is released
+	return errors.Is(err, ErrNoAccount) || errors.Is(err, ErrAccountClosed) || errors.Is(err, ErrCurrencyMismatch) ||
+		errors.Is(err, ErrTransferBlocked) || errors.As(err, &held)
+}
+
+const scheduledTransferColumns = `
+	id, user_id, to_user_id, amount, currency, frequency, start_at, end_at, max_runs,
+	occurrence, attempts, next_run_at, status, created_at, updated_at`
+
+func scanScheduledTransfer(row rowScanner) (*ScheduledTransfer, error) {
+	var (
+		st      ScheduledTransfer
+		maxRuns sql.NullInt64
+	)
+
+	err := row.Scan(
+		&st.ID,
+		&st.UserID,
+		&st.ToUserID,
+		&st.Amount.Amount,
+		&st.Amount.Currency,
+		&st.Frequency,
+		&st.StartAt,
+		&st.EndAt,
+		&maxRuns,
+		&st.Occurrences,
+		&st.Attempts,
+		&st.NextRunAt,
+		&st.Status,
+		&st.CreatedAt,
+		&st.UpdatedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if maxRuns.Valid {
+		n := int(maxRuns.Int64)
+		st.MaxRuns = &n
+	}
+
+	return &st, nil
+}
+
+func (m *ScheduledTransferModel) Insert(st *ScheduledTransfer) error {
+	query := `
+		INSERT INTO scheduled_transfers (user_id, to_user_id, amount, currency, frequency, start_at, end_at, max_runs, next_run_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $6)
+		RETURNING ` + scheduledTransferColumns
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{
+		st.UserID,
+		st.ToUserID,
+		st.Amount.Amount,
+		st.Amount.Currency,
+		st.Frequency,
+		st.StartAt,
+		st.EndAt,
+		st.MaxRuns,
+	}
+
+	inserted, err := scanScheduledTransfer(m.DB.QueryRowContext(ctx, query, args...))
+
+	if err != nil {
+		return err
+	}
+
+	*st = *inserted
+
+	return nil
+}
+
+func (m *ScheduledTransferModel) Get(id int64) (*ScheduledTransfer, error) {
+	query := `SELECT ` + scheduledTransferColumns + ` FROM scheduled_transfers WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return scanScheduledTransfer(m.DB.QueryRowContext(ctx, query, id))
+}
+
+func (m *ScheduledTransferModel) GetAllForUser(userID int64) ([]*ScheduledTransfer, error) {
+	query := `
+		SELECT ` + scheduledTransferColumns + `
+		FROM scheduled_transfers
+		WHERE user_id = $1
+		ORDER BY id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	scheduled := []*ScheduledTransfer{}
+
+	for rows.Next() {
+		st, err := scanScheduledTransfer(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		scheduled = append(scheduled, st)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return scheduled, nil
+}
+
+// GetRuns returns the attempts made for a scheduled transfer, latest first.
+func (m *ScheduledTransferModel) GetRuns(id int64) ([]*ScheduledTransferRun, error) {
+	query := `
+		SELECT id, occurrence, attempt, status, journal_id, error, created_at
+		FROM scheduled_transfer_runs
+		WHERE scheduled_transfer_id = $1
+		ORDER BY id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	runs := []*ScheduledTransferRun{}
+
+	for rows.Next() {
+		var run ScheduledTransferRun
+
+		err = rows.Scan(&run.ID, &run.Occurrence, &run.Attempt, &run.Status, &run.JournalID, &run.Error, &run.CreatedAt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		runs = append(runs, &run)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
+
+// Cancel stops a scheduled transfer, an occurrence already being run still
+// completes.
+func (m *ScheduledTransferModel) Cancel(id int64) (*ScheduledTransfer, error) {
+	query := `
+		UPDATE scheduled_transfers
+		SET status = 'cancelled', next_run_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = 'active'
+		RETURNING ` + scheduledTransferColumns
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	st, err := scanScheduledTransfer(m.DB.QueryRowContext(ctx, query, id))
+
+	if errors.Is(err, ErrRecordNotFound) {
+		return nil, ErrScheduleNotActive
+	}
+
+	return st, err
+}
+
+// ClaimDue leases up to limit due scheduled transfers to the caller. Rows
+// leased by another instance are skipped, so each is run by one instance at
+// a time. A lease left behind by a crashed instance lapses after lease.
+func (m *ScheduledTransferModel) ClaimDue(limit int, lease time.Duration) ([]*ScheduledTransfer, error) {
+	query := `
+		UPDATE scheduled_transfers
+		SET lease_expires_at = NOW() + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT id
+			FROM scheduled_transfers
+			WHERE status = 'active' AND next_run_at <= NOW()
+			AND (lease_expires_at IS NULL OR lease_expires_at < NOW())
+			ORDER BY next_run_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + scheduledTransferColumns
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, limit, lease.Seconds())
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var due []*ScheduledTransfer
+
+	for rows.Next() {
+		st, err := scanScheduledTransfer(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		due = append(due, st)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return due, nil
+}
+
+// RecordRun records the outcome of running the current occurrence of a
+// claimed scheduled transfer and releases the lease. A failed occurrence is
+// retried after each of scheduledRetryDelays and then skipped, errors that a
+// retry cannot fix skip it straight away. A one-off transfer that is skipped
+// fails.
+func (m *ScheduledTransferModel) RecordRun(st *ScheduledTransfer, transfer *Transfer, runErr error) error {
+	referenceQuery := `
+		SELECT id
+		FROM journals
+		WHERE reference = $1`
+
+	runQuery := `
+		INSERT INTO scheduled_transfer_runs (scheduled_transfer_id, occurrence, attempt, status, journal_id, error)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+
+	updateQuery := `
+		UPDATE scheduled_transfers
+		SET occurrence = $1, attempts = $2, next_run_at = $3, status = $4, lease_expires_at = NULL, updated_at = NOW()
+		WHERE id = $5 AND status = 'active'`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	var journalID *int64
+
+	switch {
+	case runErr == nil:
+		journalID = &transfer.JournalID
+	case errors.Is(runErr, ErrDuplicateReference):
+		// an earlier attempt transferred it but did not get to record the run
+		runErr = nil
+		journalID = new(int64)
+
+		err = tx.QueryRowContext(ctx, referenceQuery, st.Reference()).Scan(journalID)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	run := []interface{}{st.ID, st.Occurrences, st.Attempts + 1, ScheduledRunSucceeded, journalID, nil}
+
+	if runErr != nil {
+		run[3] = ScheduledRunFailed
+		run[5] = runErr.Error()
+	}
+
+	_, err = tx.ExecContext(ctx, runQuery, run...)
+
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case runErr == nil:
+		st.Occurrences++
+		st.scheduleNext()
+	case !permanentTransferError(runErr) && st.Attempts < len(scheduledRetryDelays):
+		retryAt := time.Now().Add(scheduledRetryDelays[st.Attempts])
+		st.Attempts++
+		st.NextRunAt = &retryAt
+	case st.Frequency == FrequencyOnce:
+		st.Occurrences++
+		st.Attempts = 0
+		st.Status = ScheduleStatusFailed
+		st.NextRunAt = nil
+	default:
+		st.Occurrences++
+		st.scheduleNext()
+	}
+
+	args := []interface{}{st.Occurrences, st.Attempts, st.NextRunAt, st.Status, st.ID}
+
+	_, err = tx.ExecContext(ctx, updateQuery, args...)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
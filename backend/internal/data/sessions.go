@@ -0,0 +1,238 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used")
+)
+
+type SessionModel struct {
+	DB *sql.DB
+}
+
+// Session groups the access and refresh tokens issued from one sign-in.
+// Revoking it signs every one of those tokens out.
+type Session struct {
+	ID        int64      `json:"id"`
+	UserID    int64      `json:"user_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+func insertRefreshToken(ctx context.Context, tx *sql.Tx, sessionID int64, ttl time.Duration) (*Token, error) {
+	query := `
+		INSERT INTO refresh_tokens (hash, session_id, expiry)
+		VALUES ($1, $2, $3)`
+
+	token, err := generateToken(ttl)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, query, token.Hash, sessionID, token.Expiry)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// New starts a session for the user and issues its first refresh token.
+func (m *SessionModel) New(userID int64, refreshTTL time.Duration) (*Session, *Token, error) {
+	query := `
+		INSERT INTO sessions (user_id)
+		VALUES ($1)
+		RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer tx.Rollback()
+
+	session := &Session{UserID: userID}
+
+	err = tx.QueryRowContext(ctx, query, userID).Scan(&session.ID, &session.CreatedAt)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	token, err := insertRefreshToken(ctx, tx, session.ID, refreshTTL)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	return session, token, nil
+}
+
+// Rotate exchanges a refresh token for a new one in the same session. A
+// refresh token can only be used once, presenting it again means it was
+// stolen, so the whole session is revoked.
+func (m *SessionModel) Rotate(plaintext string, refreshTTL time.Duration) (*Session, *Token, error) {
+	query := `
+		SELECT sessions.id, sessions.user_id, sessions.created_at, sessions.revoked_at,
+			refresh_tokens.expiry, refresh_tokens.used_at
+		FROM refresh_tokens
+		INNER JOIN sessions ON sessions.id = refresh_tokens.session_id
+		WHERE refresh_tokens.hash = $1
+		FOR UPDATE`
+
+	useQuery := `
+		UPDATE refresh_tokens
+		SET used_at = NOW()
+		WHERE hash = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer tx.Rollback()
+
+	var (
+		session Session
+		expiry  time.Time
+		usedAt  sql.NullTime
+	)
+
+	hash := hashToken(plaintext)
+
+	err = tx.QueryRowContext(ctx, query, hash).Scan(
+		&session.ID,
+		&session.UserID,
+		&session.CreatedAt,
+		&session.RevokedAt,
+		&expiry,
+		&usedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrInvalidRefreshToken
+		default:
+			return nil, nil, err
+		}
+	}
+
+	if session.RevokedAt != nil || time.Now().After(expiry) {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	if usedAt.Valid {
+		err = revokeSession(ctx, tx, session.ID)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if err = tx.Commit(); err != nil {
+			return nil, nil, err
+		}
+
+		return nil, nil, ErrRefreshTokenReused
+	}
+
+	_, err = tx.ExecContext(ctx, useQuery, hash)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	token, err := insertRefreshToken(ctx, tx, session.ID, refreshTTL)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	return &session, token, nil
+}
+
+func revokeSession(ctx context.Context, tx *sql.Tx, sessionID int64) error {
+	query := `
+		UPDATE sessions
+		SET revoked_at = NOW()
+		WHERE id = $1 AND revoked_at IS NULL`
+
+	_, err := tx.ExecContext(ctx, query, sessionID)
+
+	return err
+}
+
+func (m *SessionModel) Revoke(sessionID int64) error {
+	query := `
+		UPDATE sessions
+		SET revoked_at = NOW()
+		WHERE id = $1 AND revoked_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, sessionID)
+
+	return err
+}
+
+// RevokeAllForUser signs the user out everywhere.
+func (m *SessionModel) RevokeAllForUser(userID int64) error {
+	query := `
+		UPDATE sessions
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+
+	return err
+}
+
+// IsActive reports whether the session exists, belongs to the user and has
+// not been revoked.
+func (m *SessionModel) IsActive(sessionID, userID int64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM sessions
+			WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+		)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var active bool
+
+	err := m.DB.QueryRowContext(ctx, query, sessionID, userID).Scan(&active)
+
+	if err != nil {
+		return false, err
+	}
+
+	return active, nil
+}
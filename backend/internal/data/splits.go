@@ -0,0 +1,155 @@
+package data
+
+import (
+	"errors"
+	"math/big"
+	"sort"
+)
+
+var (
+	ErrSplitMismatch = errors.New("shares do not add up to the expense amount")
+)
+
+const (
+	SplitEqual      = "equal"
+	SplitPercentage = "percentage"
+	SplitExact      = "exact"
+)
+
+// SplitEvenly divides total into n shares that differ by at most one minor
+// unit, the first shares take the remainder.
+func SplitEvenly(total Money, n int) []Money {
+	shares := make([]Money, n)
+
+	if n == 0 {
+		return shares
+	}
+
+	base := total.Amount / int64(n)
+	remainder := total.Amount % int64(n)
+
+	for i := range shares {
+		shares[i] = Money{Amount: base, Currency: total.Currency}
+
+		if int64(i) < remainder {
+			shares[i].Amount++
+		}
+	}
+
+	return shares
+}
+
+// SplitByBasisPoints divides total in proportion to bps, which must add up to
+// 10000. Minor units lost to rounding go to the shares that lost the most, so
+// the shares always add up to total.
+func SplitByBasisPoints(total Money, bps []int64) ([]Money, error) {
+	var sum int64
+
+	for _, b := range bps {
+		if b < 0 {
+			return nil, ErrSplitMismatch
+		}
+		sum += b
+	}
+
+	if sum != 10000 {
+		return nil, ErrSplitMismatch
+	}
+
+	shares := make([]Money, len(bps))
+	remainders := make([]int64, len(bps))
+
+	allocated := int64(0)
+
+	for i, b := range bps {
+		n := new(big.Int).Mul(big.NewInt(total.Amount), big.NewInt(b))
+		q, r := n.QuoRem(n, big.NewInt(10000), new(big.Int))
+
+		shares[i] = Money{Amount: q.Int64(), Currency: total.Currency}
+		remainders[i] = r.Int64()
+		allocated += shares[i].Amount
+	}
+
+	order := make([]int, len(bps))
+
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return remainders[order[i]] > remainders[order[j]]
+	})
+
+	for i := 0; allocated < total.Amount; i++ {
+		shares[order[i]].Amount++
+		allocated++
+	}
+
+	return shares, nil
+}
+
+// SettlementSuggestion is one transfer of a settle-up plan.
+type SettlementSuggestion struct {
+	FromUserID   int64  `json:"from_user_id"`
+	FromUsername string `json:"from_username"`
+	ToUserID     int64  `json:"to_user_id"`
+	ToUsername   string `json:"to_username"`
+	Amount       Money  `json:"amount"`
+}
+
+// PlanSettlements returns transfers that bring every balance to zero. The
+// largest debt is always paid to the largest credit, which takes at most one
+// transfer fewer than there are members with a balance.
+func PlanSettlements(balances []*MemberBalance) []*SettlementSuggestion {
+	var debtors, creditors []MemberBalance
+
+	for _, b := range balances {
+		switch {
+		case b.Balance.IsNegative():
+			debtors = append(debtors, MemberBalance{UserID: b.UserID, Username: b.Username, Balance: b.Balance.Neg()})
+		case b.Balance.IsPositive():
+			creditors = append(creditors, *b)
+		}
+	}
+
+	byAmount := func(s []MemberBalance) func(i, j int) bool {
+		return func(i, j int) bool {
+			if s[i].Balance.Amount != s[j].Balance.Amount {
+				return s[i].Balance.Amount > s[j].Balance.Amount
+			}
+			return s[i].UserID < s[j].UserID
+		}
+	}
+
+	sort.Slice(debtors, byAmount(debtors))
+	sort.Slice(creditors, byAmount(creditors))
+
+	plan := []*SettlementSuggestion{}
+
+	for d, c := 0, 0; d < len(debtors) && c < len(creditors); {
+		debtor, creditor := &debtors[d], &creditors[c]
+
+		amount := min(debtor.Balance.Amount, creditor.Balance.Amount)
+
+		plan = append(plan, &SettlementSuggestion{
+			FromUserID:   debtor.UserID,
+			FromUsername: debtor.Username,
+			ToUserID:     creditor.UserID,
+			ToUsername:   creditor.Username,
+			Amount:       Money{Amount: amount, Currency: debtor.Balance.Currency},
+		})
+
+		debtor.Balance.Amount -= amount
+		creditor.Balance.Amount -= amount
+
+		if debtor.Balance.IsZero() {
+			d++
+		}
+
+		if creditor.Balance.IsZero() {
+			c++
+		}
+	}
+
+	return plan
+}
@@ -0,0 +1,252 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ThrottlePolicy says how failed attempts against one key are slowed down.
+// The first FreeAttempts failures within Window cost nothing, each one after
+// that blocks the key for twice as long as the one before, starting at
+// BaseDelay and capped at MaxDelay, and MaxAttempts of them lock the key for
+// Lockout.
+type ThrottlePolicy struct {
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	MaxAttempts  int
+	Lockout      time.Duration
+	Window       time.Duration
+}
+
+// A username locks well before an IP does, one IP may be a whole office
+// behind NAT while credential stuffing spreads guesses over many usernames.
+var (
+	UsernameSignInPolicy = ThrottlePolicy{
+		FreeAttempts: 3,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+		MaxAttempts:  10,
+		Lockout:      15 * time.Minute,
+		Window:       time.Hour,
+	}
+	IPSignInPolicy = ThrottlePolicy{
+		FreeAttempts: 20,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+		MaxAttempts:  100,
+		Lockout:      time.Hour,
+		Window:       time.Hour,
+	}
+	// MFAPolicy slows down the two-factor codes a signed-in user sends, for a
+	// step-up or to turn two-factor off, where a stolen session would
+	// otherwise guess them without limit.
+	MFAPolicy = ThrottlePolicy{
+		FreeAttempts: 3,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+		MaxAttempts:  5,
+		Lockout:      30 * time.Minute,
+		Window:       time.Hour,
+	}
+)
+
+func UsernameThrottleKey(username string) string {
+	return "username:" + username
+}
+
+func IPThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+func MFAThrottleKey(userID int64) string {
+	return "mfa:" + strconv.FormatInt(userID, 10)
+}
+
+// ThrottledError is returned while a key is blocked. Locked tells a lockout
+// from a delay between attempts.
+type ThrottledError struct {
+	Key    string
+	Until  time.Time
+	Locked bool
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("%s is throttled until %s", e.Key, e.Until.Format(time.RFC3339))
+}
+
+type Throttle struct {
+	Key            string
+	FailedAttempts int
+	LastFailedAt   time.Time
+	BlockedUntil   *time.Time
+	Locked         bool
+}
+
+// fail counts a failed attempt at now and blocks t as p says.
+func (p ThrottlePolicy) fail(t *Throttle, now time.Time) {
+	if now.Sub(t.LastFailedAt) > p.Window {
+		t.FailedAttempts = 0
+	}
+
+	t.FailedAttempts++
+	t.LastFailedAt = now
+	t.BlockedUntil = nil
+	t.Locked = false
+
+	switch {
+	case t.FailedAttempts >= p.MaxAttempts:
+		until := now.Add(p.Lockout).Truncate(time.Second)
+
+		t.FailedAttempts = 0
+		t.BlockedUntil = &until
+		t.Locked = true
+	case t.FailedAttempts > p.FreeAttempts:
+		delay := p.BaseDelay
+
+		for i := p.FreeAttempts + 1; i < t.FailedAttempts && delay < p.MaxDelay; i++ {
+			delay *= 2
+		}
+
+		until := now.Add(min(delay, p.MaxDelay)).Truncate(time.Second)
+
+		t.BlockedUntil = &until
+	}
+}
+
+// blocked returns the ThrottledError of the first of throttles still blocked
+// at now, preferring a lockout, or nil.
+func blocked(throttles []*Throttle, now time.Time) error {
+	var err *ThrottledError
+
+	for _, t := range throttles {
+		if t.BlockedUntil == nil || !now.Before(*t.BlockedUntil) {
+			continue
+		}
+
+		if err == nil || (t.Locked && !err.Locked) || (t.Locked == err.Locked && t.BlockedUntil.After(err.Until)) {
+			err = &ThrottledError{Key: t.Key, Until: *t.BlockedUntil, Locked: t.Locked}
+		}
+	}
+
+	if err == nil {
+		return nil
+	}
+
+	return err
+}
+
+type ThrottleModel struct {
+	DB *sql.DB
+}
+
+// Check returns a ThrottledError if any of keys is blocked.
+func (m *ThrottleModel) Check(keys ...string) error {
+	query := `
+		SELECT key, failed_attempts, last_failed_at, blocked_until, locked
+		FROM sign_in_throttles
+		WHERE key = ANY($1) AND blocked_until > NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(keys))
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	throttles := []*Throttle{}
+
+	for rows.Next() {
+		var t Throttle
+
+		err := rows.Scan(&t.Key, &t.FailedAttempts, &t.LastFailedAt, &t.BlockedUntil, &t.Locked)
+
+		if err != nil {
+			return err
+		}
+
+		throttles = append(throttles, &t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	return blocked(throttles, time.Now())
+}
+
+// Fail counts a failed attempt against key.
+func (m *ThrottleModel) Fail(key string, p ThrottlePolicy) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO sign_in_throttles (key)
+		VALUES ($1)
+		ON CONFLICT (key) DO NOTHING`
+
+	_, err = tx.ExecContext(ctx, query, key)
+
+	if err != nil {
+		return err
+	}
+
+	t := Throttle{Key: key}
+
+	query = `
+		SELECT failed_attempts, last_failed_at
+		FROM sign_in_throttles
+		WHERE key = $1
+		FOR UPDATE`
+
+	err = tx.QueryRowContext(ctx, query, key).Scan(&t.FailedAttempts, &t.LastFailedAt)
+
+	if err != nil {
+		return err
+	}
+
+	p.fail(&t, time.Now())
+
+	query = `
+		UPDATE sign_in_throttles
+		SET failed_attempts = $1, last_failed_at = $2, blocked_until = $3, locked = $4
+		WHERE key = $5`
+
+	_, err = tx.ExecContext(ctx, query, t.FailedAttempts, t.LastFailedAt, t.BlockedUntil, t.Locked, key)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Reset forgets the failed attempts against key, lifting any lockout.
+func (m *ThrottleModel) Reset(key string) error {
+	query := `
+		DELETE FROM sign_in_throttles
+		WHERE key = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, key)
+
+	return err
+}
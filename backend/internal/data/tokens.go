@@ -0,0 +1,40 @@
+package data
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"time"
+)
+
+// Token is an opaque random secret handed to the client. Only its hash is
+// stored, so a leaked database does not leak usable tokens.
+type Token struct {
+	Plaintext string    `json:"token"`
+	Hash      []byte    `json:"-"`
+	Expiry    time.Time `json:"expiry"`
+}
+
+func generateToken(ttl time.Duration) (*Token, error) {
+	randomBytes := make([]byte, 32)
+
+	_, err := rand.Read(randomBytes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	token := &Token{
+		Plaintext: base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes),
+		Expiry:    time.Now().Add(ttl),
+	}
+
+	token.Hash = hashToken(token.Plaintext)
+
+	return token, nil
+}
+
+func hashToken(plaintext string) []byte {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
+}
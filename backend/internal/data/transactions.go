@@ -0,0 +1,166 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	TransactionStatusCompleted         = "completed"
+	TransactionStatusPartiallyRefunded = "partially_refunded"
+	TransactionStatusRefunded          = "refunded"
+)
+
+// Transaction is a single posting seen from the account it belongs to,
+// joined with the journal it was recorded in.
+type Transaction struct {
+	ID                   int64     `json:"id"`
+	Kind                 string    `json:"kind"`
+	Direction            string    `json:"direction"`
+	Amount               Money     `json:"amount"`
+	CounterpartyID       int64     `json:"counterparty_id,omitempty"`
+	CounterpartyUsername string    `json:"counterparty_username,omitempty"`
+	Status               string    `json:"status"`
+	RefundOf             *int64    `json:"refund_of,omitempty"`
+	Refunds              []int64   `json:"refunds,omitempty"`
+	RefundedAmount       *Money    `json:"refunded_amount,omitempty"`
+	CreatedAt            time.Time `json:"created_at"`
+	postingID            int64
+}
+
+func (m *LedgerModel) GetTransactions(userID int64, filters TransactionFilters) ([]*Transaction, CursorMetadata, error) {
+	// the counterparty is the opposite side of the journal, preferring a
+	// user over the external account. Refunds are linked both ways, with the
+	// refunded amount measured in this account's currency.
+	query := `
+		SELECT postings.id, journals.id, journals.kind, postings.amount, postings.currency, journals.created_at,
+			COALESCE(counterparty.user_id, 0), COALESCE(users.username, ''), journals.refund_of,
+			ARRAY(SELECT refunds.id FROM journals refunds WHERE refunds.refund_of = journals.id ORDER BY refunds.id),
+			(
+				SELECT COALESCE(ABS(SUM(refund_postings.amount)), 0)
+				FROM journals refunds
+				INNER JOIN postings refund_postings ON refund_postings.journal_id = refunds.id
+				WHERE refunds.refund_of = journals.id
+				AND refund_postings.user_id = postings.user_id
+				AND refund_postings.currency = postings.currency
+			)
+		FROM postings
+		INNER JOIN journals ON journals.id = postings.journal_id
+		LEFT JOIN LATERAL (
+			SELECT other.user_id
+			FROM postings other
+			WHERE other.journal_id = postings.journal_id
+			AND other.id <> postings.id
+			AND SIGN(other.amount) <> SIGN(postings.amount)
+			ORDER BY other.user_id IS NULL, other.id
+			LIMIT 1
+		) counterparty ON true
+		LEFT JOIN users ON users.id = counterparty.user_id
+		WHERE postings.user_id = $1
+		AND ($2::bigint = 0 OR postings.id < $2)
+		AND ($3::timestamptz IS NULL OR journals.created_at >= $3)
+		AND ($4::timestamptz IS NULL OR journals.created_at <= $4)
+		AND ($5 = '' OR ($5 = 'credit' AND postings.amount > 0) OR ($5 = 'debit' AND postings.amount < 0))
+		AND ($6 = '' OR postings.currency = $6)
+		AND ($7::bigint = 0 OR ABS(postings.amount) >= $7)
+		AND ($8::bigint = 0 OR ABS(postings.amount) <= $8)
+		ORDER BY postings.id DESC
+		LIMIT $9`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var from, to sql.NullTime
+
+	if filters.From != nil {
+		from = sql.NullTime{Time: *filters.From, Valid: true}
+	}
+
+	if filters.To != nil {
+		to = sql.NullTime{Time: *filters.To, Valid: true}
+	}
+
+	// fetch one extra row to find out whether there is a next page
+	args := []interface{}{
+		userID,
+		filters.Cursor,
+		from,
+		to,
+		filters.Direction,
+		filters.Currency,
+		filters.MinAmount.Amount,
+		filters.MaxAmount.Amount,
+		filters.PageSize + 1,
+	}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+
+	if err != nil {
+		return nil, CursorMetadata{}, err
+	}
+
+	defer rows.Close()
+
+	transactions := []*Transaction{}
+
+	for rows.Next() {
+		var (
+			t        Transaction
+			refunded int64
+		)
+
+		err = rows.Scan(
+			&t.postingID,
+			&t.ID,
+			&t.Kind,
+			&t.Amount.Amount,
+			&t.Amount.Currency,
+			&t.CreatedAt,
+			&t.CounterpartyID,
+			&t.CounterpartyUsername,
+			&t.RefundOf,
+			pq.Array(&t.Refunds),
+			&refunded,
+		)
+
+		if err != nil {
+			return nil, CursorMetadata{}, err
+		}
+
+		t.Direction = DirectionCredit
+
+		if t.Amount.IsNegative() {
+			t.Direction = DirectionDebit
+			t.Amount = t.Amount.Neg()
+		}
+
+		t.Status = TransactionStatusCompleted
+
+		if len(t.Refunds) > 0 {
+			t.RefundedAmount = &Money{Amount: refunded, Currency: t.Amount.Currency}
+			t.Status = TransactionStatusPartiallyRefunded
+
+			if refunded >= t.Amount.Amount {
+				t.Status = TransactionStatusRefunded
+			}
+		}
+
+		transactions = append(transactions, &t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, CursorMetadata{}, err
+	}
+
+	metadata := CursorMetadata{PageSize: filters.PageSize}
+
+	if len(transactions) > filters.PageSize {
+		transactions = transactions[:filters.PageSize]
+		metadata.NextCursor = EncodeCursor(transactions[len(transactions)-1].postingID)
+	}
+
+	return transactions, metadata, nil
+}
@@ -2,7 +2,9 @@ package data
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/base32"
 	"errors"
 	"fmt"
 	"time"
@@ -13,6 +15,8 @@ import (
 
 var (
 	ErrDuplicateUsername = errors.New("username already exists")
+	ErrDuplicateEmail    = errors.New("email already exists")
+	ErrDuplicatePhone    = errors.New("phone already exists")
 )
 
 type UserModel struct {
@@ -25,8 +29,70 @@ type User struct {
 	UserName  string    `json:"username"`
 	FirstName string    `json:"firstName"`
 	LastName  string    `json:"lastName"`
+	Email     string    `json:"-"`
+	Phone     string    `json:"-"`
 	Password  password  `json:"-"`
+	Role      string    `json:"-"`
 	Version   int       `json:"-"`
+
+	EmailVerifiedAt   *time.Time `json:"-"`
+	PhoneVerifiedAt   *time.Time `json:"-"`
+	VerificationLevel int        `json:"-"`
+}
+
+// Contact is what the user's own and staff views show of their email and
+// phone.
+type Contact struct {
+	Email             string `json:"email,omitempty"`
+	EmailVerified     bool   `json:"email_verified"`
+	Phone             string `json:"phone,omitempty"`
+	PhoneVerified     bool   `json:"phone_verified"`
+	VerificationLevel int    `json:"verification_level"`
+}
+
+func (u *User) Contact() Contact {
+	return Contact{
+		Email:             u.Email,
+		EmailVerified:     u.EmailVerifiedAt != nil,
+		Phone:             u.Phone,
+		PhoneVerified:     u.PhoneVerifiedAt != nil,
+		VerificationLevel: u.VerificationLevel,
+	}
+}
+
+// SetEmail changes the email, a new one has to be verified again.
+func (u *User) SetEmail(email string) {
+	if email == u.Email {
+		return
+	}
+
+	u.Email = email
+	u.EmailVerifiedAt = nil
+	u.dropContactVerification()
+}
+
+// SetPhone changes the phone, a new one has to be verified again.
+func (u *User) SetPhone(phone string) {
+	if phone == u.Phone {
+		return
+	}
+
+	u.Phone = phone
+	u.PhoneVerifiedAt = nil
+	u.dropContactVerification()
+}
+
+// dropContactVerification takes a user whose verified contact details are
+// all gone back to unverified, KYC does not depend on them and is kept.
+func (u *User) dropContactVerification() {
+	if u.VerificationLevel == VerificationContact && u.EmailVerifiedAt == nil && u.PhoneVerifiedAt == nil {
+		u.VerificationLevel = VerificationNone
+	}
+}
+
+// Permissions are the permissions the user's role grants.
+func (u *User) Permissions() Permissions {
+	return PermissionsForRole(u.Role)
 }
 
 type password struct {
@@ -47,6 +113,16 @@ func (p *password) Set(plainText string) error {
 	return nil
 }
 
+// noPasswordHash is compared against when there is no user to check a
+// password for, so that an unknown username takes as long as a wrong
+// password. It has the cost Set uses.
+var noPasswordHash = []byte("$2a$12$bthGJS84cEq.5D3op.1yxuTFMyx02JYwGDdgr92RCgXg6FCBVfvna")
+
+// MatchNoUser spends the time Match would for a user who does not exist.
+func MatchNoUser(plaintextPassword string) {
+	bcrypt.CompareHashAndPassword(noPasswordHash, []byte(plaintextPassword))
+}
+
 func (p *password) Match(plaintextPassword string) (bool, error) {
 	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintextPassword))
 
@@ -63,18 +139,57 @@ func (p *password) Match(plaintextPassword string) (bool, error) {
 }
 
 
+// GenerateTemporaryPassword returns a random password for a user whose
+// password staff reset, it is handed to the user to sign in once and change.
+func GenerateTemporaryPassword() (string, error) {
+	randomBytes := make([]byte, 15)
+
+	_, err := rand.Read(randomBytes)
+
+	if err != nil {
+		return "", err
+	}
+
+	return base32.StdEncoding.EncodeToString(randomBytes), nil
+}
+
 func ValidatePassword(v *validator.Validator, plainTextPassword string) {
 	v.ValidateEmpty(plainTextPassword, "password")
 	v.Check(len(plainTextPassword) <= 72, "password", "password cannot be greater than 72 bytes")
 }
 
+func ValidateEmail(v *validator.Validator, email string) {
+	v.ValidateEmpty(email, "email")
+	v.Check(len(email) <= 254, "email", "must not be more than 254 bytes long")
+	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
+}
+
+// ValidatePhone checks for a number in E.164 form, like +919876543210.
+func ValidatePhone(v *validator.Validator, phone string) {
+	v.ValidateEmpty(phone, "phone")
+	v.Check(validator.Matches(phone, validator.PhoneRX), "phone", "must be in international format like +919876543210")
+}
+
 func ValidateUser(v *validator.Validator, user *User) {
 	
 	v.ValidateEmpty(user.UserName, "username")
 	v.ValidateEmpty(user.FirstName, "firstname")
 	v.ValidateEmpty(user.LastName, "lastname")
 
-	ValidatePassword(v, *user.Password.plaintext)
+	// contact details are optional, without a verified one the user cannot
+	// send money to others
+	if user.Email != "" {
+		ValidateEmail(v, user.Email)
+	}
+
+	if user.Phone != "" {
+		ValidatePhone(v, user.Phone)
+	}
+
+	// a password is only validated when it is being set
+	if user.Password.plaintext != nil {
+		ValidatePassword(v, *user.Password.plaintext)
+	}
 
 	if user.Password.hash == nil {
 		panic("missing password hash for the user")
@@ -83,22 +198,26 @@ func ValidateUser(v *validator.Validator, user *User) {
 
 func (m *UserModel) Insert(user *User) error {
 	query := `
-		INSERT INTO users (username, firstname, lastname, password_hash)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, created_at, version`
+		INSERT INTO users (username, firstname, lastname, email, phone, password_hash)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6)
+		RETURNING id, created_at, role, version`
 
-	args := []interface{}{user.UserName, user.FirstName, user.LastName, user.Password.hash}
+	args := []interface{}{user.UserName, user.FirstName, user.LastName, user.Email, user.Phone, user.Password.hash}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Role, &user.Version)
 
 	if err != nil {
 		switch {
 		case err.Error() == "pq: duplicate key value violates unique constraint \"users_username_key\"":
 			return ErrDuplicateUsername
+		case err.Error() == "pq: duplicate key value violates unique constraint \"users_email_key\"":
+			return ErrDuplicateEmail
+		case err.Error() == "pq: duplicate key value violates unique constraint \"users_phone_key\"":
+			return ErrDuplicatePhone
 		default:
 			return err
 		}
@@ -109,7 +228,7 @@ func (m *UserModel) Insert(user *User) error {
 
 func (m *UserModel) GetByUsername(firstName string) (*User, error) {
 	query := `
-		SELECT id, created_at, username, firstname, lastname, password_hash, version
+		SELECT id, created_at, username, firstname, lastname, COALESCE(email, ''), COALESCE(phone, ''), email_verified_at, phone_verified_at, verification_level, password_hash, role, version
 		FROM users
 		WHERE username = $1`
 
@@ -124,7 +243,91 @@ func (m *UserModel) GetByUsername(firstName string) (*User, error) {
 		&user.UserName,
 		&user.FirstName,
 		&user.LastName,
+		&user.Email,
+		&user.Phone,
+		&user.EmailVerifiedAt,
+		&user.PhoneVerifiedAt,
+		&user.VerificationLevel,
+		&user.Password.hash,
+		&user.Role,
+		&user.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+func (m *UserModel) GetByID(id int64) (*User, error) {
+	query := `
+		SELECT id, created_at, username, firstname, lastname, COALESCE(email, ''), COALESCE(phone, ''), email_verified_at, phone_verified_at, verification_level, password_hash, role, version
+		FROM users
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var user User
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.UserName,
+		&user.FirstName,
+		&user.LastName,
+		&user.Email,
+		&user.Phone,
+		&user.EmailVerifiedAt,
+		&user.PhoneVerifiedAt,
+		&user.VerificationLevel,
 		&user.Password.hash,
+		&user.Role,
+		&user.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+func (m *UserModel) GetByEmail(email string) (*User, error) {
+	query := `
+		SELECT id, created_at, username, firstname, lastname, COALESCE(email, ''), COALESCE(phone, ''), email_verified_at, phone_verified_at, verification_level, password_hash, role, version
+		FROM users
+		WHERE email = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var user User
+
+	err := m.DB.QueryRowContext(ctx, query, email).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.UserName,
+		&user.FirstName,
+		&user.LastName,
+		&user.Email,
+		&user.Phone,
+		&user.EmailVerifiedAt,
+		&user.PhoneVerifiedAt,
+		&user.VerificationLevel,
+		&user.Password.hash,
+		&user.Role,
 		&user.Version,
 	)
 
@@ -142,7 +345,7 @@ func (m *UserModel) GetByUsername(firstName string) (*User, error) {
 
 func (m *UserModel) GetUsers(searchTerm string) ([]*User, error) {
 	query := `
-	SELECT id, created_at, username, firstname, lastname, password_hash, version
+	SELECT id, created_at, username, firstname, lastname, COALESCE(email, ''), COALESCE(phone, ''), email_verified_at, phone_verified_at, verification_level, password_hash, role, version
 	FROM users
 	WHERE username like $1`
 
@@ -169,7 +372,13 @@ func (m *UserModel) GetUsers(searchTerm string) ([]*User, error) {
 			&user.UserName,
 			&user.FirstName,
 			&user.LastName,
+			&user.Email,
+			&user.Phone,
+			&user.EmailVerifiedAt,
+			&user.PhoneVerifiedAt,
+			&user.VerificationLevel,
 			&user.Password.hash,
+			&user.Role,
 			&user.Version,
 		)
 
@@ -183,24 +392,37 @@ func (m *UserModel) GetUsers(searchTerm string) ([]*User, error) {
 	return users, nil
 }
 
+// UpdateUser saves the user if nobody changed it since it was read, failing
+// with ErrEditConflict otherwise, and moves user to the new version.
 func (m *UserModel) UpdateUser(user *User) error {
 	query := `
 	UPDATE users
-	SET username = $1, firstname = $2, lastname = $3, password_hash = $4, version = version + 1
-	WHERE id = $5 AND version = $6
+	SET username = $1, firstname = $2, lastname = $3, email = NULLIF($4, ''), phone = NULLIF($5, ''),
+		email_verified_at = $6, phone_verified_at = $7, verification_level = $8, password_hash = $9, version = version + 1,
+		password_changed_at = CASE WHEN password_hash = $9 THEN password_changed_at ELSE NOW() END
+	WHERE id = $10 AND version = $11
+	RETURNING version
 	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3 * time.Second)
 	defer cancel()
 
-	args := []interface{}{user.UserName, user.FirstName, user.LastName, user.Password.hash, user.ID, user.Version}
+	args := []interface{}{
+		user.UserName, user.FirstName, user.LastName, user.Email, user.Phone,
+		user.EmailVerifiedAt, user.PhoneVerifiedAt, user.VerificationLevel, user.Password.hash,
+		user.ID, user.Version,
+	}
 
-	_, err  := m.DB.ExecContext(ctx, query, args...)
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
 
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			return ErrRecordNotFound
+			return ErrEditConflict
+		case err.Error() == "pq: duplicate key value violates unique constraint \"users_email_key\"":
+			return ErrDuplicateEmail
+		case err.Error() == "pq: duplicate key value violates unique constraint \"users_phone_key\"":
+			return ErrDuplicatePhone
 		default:
 			return err
 		}
@@ -209,3 +431,33 @@ func (m *UserModel) UpdateUser(user *User) error {
 	return nil
 }
 
+// SetRole changes the user's role, it does not touch the version so that an
+// edit the user is making is not lost.
+func (m *UserModel) SetRole(id int64, role string) error {
+	query := `
+	UPDATE users
+	SET role = $1
+	WHERE id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3 * time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, role, id)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
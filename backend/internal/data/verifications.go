@@ -0,0 +1,221 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// Channels a contact detail is verified over.
+const (
+	ChannelEmail = "email"
+	ChannelPhone = "phone"
+)
+
+var (
+	ErrInvalidVerificationCode = errors.New("invalid or expired verification code")
+)
+
+// A code is good for verificationCodeTTL and verificationMaxAttempts
+// guesses, and a new one is sent at most every verificationResendInterval.
+const (
+	verificationCodeTTL        = 15 * time.Minute
+	verificationMaxAttempts    = 5
+	verificationResendInterval = time.Minute
+)
+
+type VerificationModel struct {
+	DB *sql.DB
+}
+
+// generateVerificationCode returns a six digit code, short enough to type
+// from a text message.
+func generateVerificationCode() (*Token, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+
+	if err != nil {
+		return nil, err
+	}
+
+	code := &Token{
+		Plaintext: fmt.Sprintf("%06d", n.Int64()),
+		Expiry:    time.Now().Add(verificationCodeTTL).Truncate(time.Second),
+	}
+
+	code.Hash = hashToken(code.Plaintext)
+
+	return code, nil
+}
+
+// contactColumn is the users column holding the channel's contact detail,
+// when it was verified is kept next to it in <column>_verified_at.
+func contactColumn(channel string) string {
+	if channel == ChannelPhone {
+		return "phone"
+	}
+
+	return "email"
+}
+
+// New issues a code to verify destination over channel, replacing the one
+// sent before. Asked again too soon it returns a ThrottledError.
+func (m *VerificationModel) New(userID int64, channel, destination string) (*Token, error) {
+	code, err := generateVerificationCode()
+
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	var sentAt time.Time
+
+	query := `
+		SELECT created_at
+		FROM verification_codes
+		WHERE user_id = $1 AND channel = $2 AND destination = $3
+		FOR UPDATE`
+
+	err = tx.QueryRowContext(ctx, query, userID, channel, destination).Scan(&sentAt)
+
+	switch {
+	case err == nil:
+		if until := sentAt.Add(verificationResendInterval); time.Now().Before(until) {
+			return nil, &ThrottledError{Key: "verification:" + channel, Until: until}
+		}
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+
+	query = `
+		INSERT INTO verification_codes (user_id, channel, destination, hash, expiry)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, channel) DO UPDATE
+		SET destination = EXCLUDED.destination, hash = EXCLUDED.hash, attempts = 0,
+			expiry = EXCLUDED.expiry, created_at = NOW()`
+
+	args := []interface{}{userID, channel, destination, code.Hash, code.Expiry}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return code, nil
+}
+
+// Confirm checks code and marks destination verified, raising the user to
+// VerificationContact. A code stops working after verificationMaxAttempts
+// wrong guesses or once the user's contact detail changes.
+func (m *VerificationModel) Confirm(userID int64, channel, destination, code string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	var (
+		hash     []byte
+		attempts int
+		expiry   time.Time
+	)
+
+	query := `
+		SELECT hash, attempts, expiry
+		FROM verification_codes
+		WHERE user_id = $1 AND channel = $2 AND destination = $3
+		FOR UPDATE`
+
+	err = tx.QueryRowContext(ctx, query, userID, channel, destination).Scan(&hash, &attempts, &expiry)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrInvalidVerificationCode
+		default:
+			return err
+		}
+	}
+
+	if attempts >= verificationMaxAttempts || time.Now().After(expiry) {
+		return ErrInvalidVerificationCode
+	}
+
+	if subtle.ConstantTimeCompare(hash, hashToken(code)) != 1 {
+		query = `
+			UPDATE verification_codes
+			SET attempts = attempts + 1
+			WHERE user_id = $1 AND channel = $2`
+
+		_, err = tx.ExecContext(ctx, query, userID, channel)
+
+		if err != nil {
+			return err
+		}
+
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+
+		return ErrInvalidVerificationCode
+	}
+
+	query = `
+		DELETE FROM verification_codes
+		WHERE user_id = $1 AND channel = $2`
+
+	_, err = tx.ExecContext(ctx, query, userID, channel)
+
+	if err != nil {
+		return err
+	}
+
+	// the version changes so that an edit made from before the verification
+	// cannot undo it
+	column := contactColumn(channel)
+
+	query = fmt.Sprintf(`
+		UPDATE users
+		SET %[1]s_verified_at = NOW(), verification_level = GREATEST(verification_level, $1), version = version + 1
+		WHERE id = $2 AND %[1]s = $3`, column)
+
+	result, err := tx.ExecContext(ctx, query, VerificationContact, userID, destination)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrInvalidVerificationCode
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,584 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/AdityaVarmaUddaraju/paytm/internal/validator"
+	"github.com/AdityaVarmaUddaraju/paytm/internal/webhook"
+	"github.com/lib/pq"
+)
+
+// Events sent to webhook endpoints.
+const (
+	WebhookTransferCompleted = "transfer.completed"
+	WebhookTopUpCompleted    = "top_up.completed"
+	WebhookRefundCompleted   = "refund.completed"
+	WebhookOrderPaid         = "order.paid"
+)
+
+var WebhookEventTypes = []string{WebhookTransferCompleted, WebhookTopUpCompleted, WebhookRefundCompleted, WebhookOrderPaid}
+
+// journalEvents is the event each user in a journal of a kind is sent,
+// opening journals are not announced.
+var journalEvents = map[string]string{
+	JournalKindTopUp:      WebhookTopUpCompleted,
+	JournalKindTransfer:   WebhookTransferCompleted,
+	JournalKindCapture:    WebhookTransferCompleted,
+	JournalKindSettlement: WebhookTransferCompleted,
+	JournalKindOrder:      WebhookTransferCompleted,
+	JournalKindClosure:    WebhookTransferCompleted,
+	JournalKindRefund:     WebhookRefundCompleted,
+}
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryDead      = "dead"
+)
+
+// WebhookMaxAttempts is how many times a delivery is tried before it is dead
+// lettered, the delay between attempts doubles from webhookFirstRetry up to
+// webhookMaxRetry.
+const (
+	WebhookMaxAttempts = 10
+	webhookFirstRetry  = 30 * time.Second
+	webhookMaxRetry    = 6 * time.Hour
+)
+
+type WebhookModel struct {
+	DB *sql.DB
+}
+
+// WebhookEndpoint receives the events of its user. One registered for a
+// merchant only receives the events about that merchant's orders.
+type WebhookEndpoint struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	MerchantID *int64     `json:"merchant_id,omitempty"`
+	URL        string     `json:"url"`
+	Secret     string     `json:"-"`
+	EventTypes []string   `json:"event_types"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// WebhookDelivery is one event on its way to one endpoint. URL, Secret and
+// Body are only filled in for deliveries claimed by the dispatcher.
+type WebhookDelivery struct {
+	ID             int64      `json:"id"`
+	EventID        int64      `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	EndpointID     int64      `json:"endpoint_id"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	LastStatusCode *int       `json:"last_status_code,omitempty"`
+	LastError      *string    `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	URL            string     `json:"-"`
+	Secret         string     `json:"-"`
+	Body           []byte     `json:"-"`
+}
+
+// WebhookEvent is the JSON body POSTed to endpoints.
+type WebhookEvent struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// TransactionEvent is the data of the events sent about a journal, Amount is
+// the user's side of it, negative when money left their account.
+type TransactionEvent struct {
+	TransactionID  int64     `json:"transaction_id"`
+	Kind           string    `json:"kind"`
+	Amount         Money     `json:"amount"`
+	CounterpartyID *int64    `json:"counterparty_id,omitempty"`
+	RefundOf       *int64    `json:"refund_of,omitempty"`
+	Reference      *string   `json:"reference,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func ValidateWebhookEndpoint(v *validator.Validator, endpoint *WebhookEndpoint) {
+	u, err := url.Parse(endpoint.URL)
+
+	v.Check(err == nil && u.Scheme == "https" && u.Hostname() != "", "url", "must be an absolute https URL")
+
+	// a name is checked again when it is resolved for each delivery
+	if err == nil {
+		host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+
+		addr, err := netip.ParseAddr(host)
+
+		v.Check(host != "localhost" && !strings.HasSuffix(host, ".localhost"), "url", "must not point at this server")
+		v.Check(err != nil || webhook.PublicAddr(addr), "url", "must not point at a private or reserved address")
+	}
+	v.Check(len(endpoint.URL) <= 2048, "url", "must not be more than 2048 bytes long")
+
+	for _, eventType := range endpoint.EventTypes {
+		v.Check(validator.PermittedValue(eventType, WebhookEventTypes...), "event_types", "must only contain known event types")
+	}
+}
+
+// webhookRetryDelay is how long to wait before the next attempt after
+// attempts failed ones.
+func webhookRetryDelay(attempts int) time.Duration {
+	delay := webhookFirstRetry
+
+	for i := 1; i < attempts && delay < webhookMaxRetry; i++ {
+		delay *= 2
+	}
+
+	return min(delay, webhookMaxRetry)
+}
+
+// insertWebhookEvent adds an event to the outbox as part of tx, so it is only
+// sent when whatever it announces is committed.
+func insertWebhookEvent(ctx context.Context, tx *sql.Tx, userID int64, merchantID *int64, eventType string, data interface{}) error {
+	query := `
+		INSERT INTO webhook_events (user_id, merchant_id, type, payload)
+		VALUES ($1, $2, $3, $4)`
+
+	payload, err := json.Marshal(data)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, query, userID, merchantID, eventType, payload)
+
+	return err
+}
+
+// insertJournalEvents tells every user in the journal about it.
+func insertJournalEvents(ctx context.Context, tx *sql.Tx, journal *Journal) error {
+	eventType, ok := journalEvents[journal.Kind]
+
+	if !ok {
+		return nil
+	}
+
+	for _, p := range journal.Postings {
+		if p.UserID == ExternalAccount {
+			continue
+		}
+
+		event := TransactionEvent{
+			TransactionID: journal.ID,
+			Kind:          journal.Kind,
+			Amount:        p.Amount,
+			RefundOf:      journal.RefundOf,
+			Reference:     journal.Reference,
+			CreatedAt:     journal.CreatedAt,
+		}
+
+		for _, other := range journal.Postings {
+			if other.UserID != ExternalAccount && other.UserID != p.UserID {
+				event.CounterpartyID = &other.UserID
+				break
+			}
+		}
+
+		err := insertWebhookEvent(ctx, tx, p.UserID, nil, eventType, event)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+const webhookEndpointColumns = `id, user_id, merchant_id, url, secret, event_types, disabled_at, created_at`
+
+func scanWebhookEndpoint(row rowScanner) (*WebhookEndpoint, error) {
+	var endpoint WebhookEndpoint
+
+	err := row.Scan(
+		&endpoint.ID,
+		&endpoint.UserID,
+		&endpoint.MerchantID,
+		&endpoint.URL,
+		&endpoint.Secret,
+		pq.Array(&endpoint.EventTypes),
+		&endpoint.DisabledAt,
+		&endpoint.CreatedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &endpoint, nil
+}
+
+// InsertEndpoint registers the endpoint with a new signing secret.
+func (m *WebhookModel) InsertEndpoint(endpoint *WebhookEndpoint) error {
+	query := `
+		INSERT INTO webhook_endpoints (user_id, merchant_id, url, secret, event_types)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	token, err := generateToken(0)
+
+	if err != nil {
+		return err
+	}
+
+	endpoint.Secret = "whsec_" + token.Plaintext
+
+	if endpoint.EventTypes == nil {
+		endpoint.EventTypes = []string{}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{endpoint.UserID, endpoint.MerchantID, endpoint.URL, endpoint.Secret, pq.Array(endpoint.EventTypes)}
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&endpoint.ID, &endpoint.CreatedAt)
+}
+
+func (m *WebhookModel) GetEndpoint(id int64) (*WebhookEndpoint, error) {
+	query := `
+		SELECT ` + webhookEndpointColumns + `
+		FROM webhook_endpoints
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return scanWebhookEndpoint(m.DB.QueryRowContext(ctx, query, id))
+}
+
+// GetEndpointsForUser lists the user's endpoints that are not disabled.
+func (m *WebhookModel) GetEndpointsForUser(userID int64) ([]*WebhookEndpoint, error) {
+	query := `
+		SELECT ` + webhookEndpointColumns + `
+		FROM webhook_endpoints
+		WHERE user_id = $1 AND disabled_at IS NULL
+		ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	endpoints := []*WebhookEndpoint{}
+
+	for rows.Next() {
+		endpoint, err := scanWebhookEndpoint(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		endpoints = append(endpoints, endpoint)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return endpoints, nil
+}
+
+// DisableEndpoint stops deliveries to the endpoint, including those still
+// being retried. Its delivery history is kept.
+func (m *WebhookModel) DisableEndpoint(id int64) error {
+	query := `
+		UPDATE webhook_endpoints
+		SET disabled_at = NOW()
+		WHERE id = $1 AND disabled_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+const webhookDeliveryColumns = `
+	webhook_deliveries.id, event_id, webhook_events.type, endpoint_id, status, attempts,
+	next_attempt_at, last_status_code, last_error, delivered_at, webhook_deliveries.created_at,
+	updated_at`
+
+func scanWebhookDelivery(row rowScanner, extra ...interface{}) (*WebhookDelivery, error) {
+	var d WebhookDelivery
+
+	dest := []interface{}{
+		&d.ID,
+		&d.EventID,
+		&d.EventType,
+		&d.EndpointID,
+		&d.Status,
+		&d.Attempts,
+		&d.NextAttemptAt,
+		&d.LastStatusCode,
+		&d.LastError,
+		&d.DeliveredAt,
+		&d.CreatedAt,
+		&d.UpdatedAt,
+	}
+
+	err := row.Scan(append(dest, extra...)...)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &d, nil
+}
+
+// GetDeliveries lists the most recent deliveries to the endpoint, optionally
+// only those with status.
+func (m *WebhookModel) GetDeliveries(endpointID int64, status string) ([]*WebhookDelivery, error) {
+	query := `
+		SELECT ` + webhookDeliveryColumns + `
+		FROM webhook_deliveries
+		INNER JOIN webhook_events ON webhook_events.id = webhook_deliveries.event_id
+		WHERE endpoint_id = $1
+		AND (status = $2 OR $2 = '')
+		ORDER BY webhook_deliveries.id DESC
+		LIMIT 100`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, endpointID, status)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// Replay queues a delivery of the endpoint to be sent again straight away
+// with a fresh set of attempts, whatever its status.
+func (m *WebhookModel) Replay(endpointID, deliveryID int64) (*WebhookDelivery, error) {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = 'pending', attempts = 0, next_attempt_at = NOW(), lease_expires_at = NULL, updated_at = NOW()
+		FROM webhook_events
+		WHERE webhook_events.id = webhook_deliveries.event_id
+		AND webhook_deliveries.id = $1 AND endpoint_id = $2
+		RETURNING ` + webhookDeliveryColumns
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return scanWebhookDelivery(m.DB.QueryRowContext(ctx, query, deliveryID, endpointID))
+}
+
+// FanOut turns up to limit outbox events into a delivery for every active
+// endpoint that subscribed to them, returning how many events were handled.
+func (m *WebhookModel) FanOut(limit int) (int64, error) {
+	query := `
+		WITH events AS (
+			UPDATE webhook_events
+			SET fanned_out = true
+			WHERE id IN (
+				SELECT id
+				FROM webhook_events
+				WHERE NOT fanned_out
+				ORDER BY id
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, user_id, merchant_id, type
+		), deliveries AS (
+			INSERT INTO webhook_deliveries (event_id, endpoint_id)
+			SELECT events.id, webhook_endpoints.id
+			FROM events
+			INNER JOIN webhook_endpoints ON webhook_endpoints.user_id = events.user_id
+			WHERE webhook_endpoints.disabled_at IS NULL
+			AND (webhook_endpoints.merchant_id IS NULL OR webhook_endpoints.merchant_id = events.merchant_id)
+			AND (cardinality(webhook_endpoints.event_types) = 0 OR events.type = ANY(webhook_endpoints.event_types))
+			ON CONFLICT (event_id, endpoint_id) DO NOTHING
+		)
+		SELECT COUNT(*) FROM events`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var count int64
+
+	err := m.DB.QueryRowContext(ctx, query, limit).Scan(&count)
+
+	return count, err
+}
+
+// ClaimDue leases up to limit deliveries that are due to the caller, along
+// with what is needed to send them. A delivery whose lease lapses before its
+// attempt is recorded is claimed again.
+func (m *WebhookModel) ClaimDue(limit int, lease time.Duration) ([]*WebhookDelivery, error) {
+	query := `
+		WITH claimed AS (
+			UPDATE webhook_deliveries
+			SET lease_expires_at = NOW() + make_interval(secs => $2)
+			WHERE id IN (
+				SELECT webhook_deliveries.id
+				FROM webhook_deliveries
+				INNER JOIN webhook_endpoints ON webhook_endpoints.id = webhook_deliveries.endpoint_id
+				WHERE status = 'pending' AND next_attempt_at <= NOW()
+				AND (lease_expires_at IS NULL OR lease_expires_at < NOW())
+				AND webhook_endpoints.disabled_at IS NULL
+				ORDER BY next_attempt_at
+				LIMIT $1
+				FOR UPDATE OF webhook_deliveries SKIP LOCKED
+			)
+			RETURNING *
+		)
+		SELECT ` + webhookDeliveryColumns + `,
+			webhook_endpoints.url, webhook_endpoints.secret, webhook_events.payload, webhook_events.created_at
+		FROM claimed webhook_deliveries
+		INNER JOIN webhook_events ON webhook_events.id = webhook_deliveries.event_id
+		INNER JOIN webhook_endpoints ON webhook_endpoints.id = webhook_deliveries.endpoint_id
+		ORDER BY webhook_deliveries.next_attempt_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, limit, lease.Seconds())
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var due []*WebhookDelivery
+
+	for rows.Next() {
+		var endpointURL, secret string
+		var payload json.RawMessage
+		var eventCreatedAt time.Time
+
+		d, err := scanWebhookDelivery(rows, &endpointURL, &secret, &payload, &eventCreatedAt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		d.URL = endpointURL
+		d.Secret = secret
+
+		d.Body, err = json.Marshal(WebhookEvent{ID: d.EventID, Type: d.EventType, CreatedAt: eventCreatedAt, Data: payload})
+
+		if err != nil {
+			return nil, err
+		}
+
+		due = append(due, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return due, nil
+}
+
+// RecordAttempt records the outcome of sending a claimed delivery and
+// releases the lease. A failed delivery is retried with a growing delay until
+// it has been tried WebhookMaxAttempts times, then it is dead lettered.
+func (m *WebhookModel) RecordAttempt(d *WebhookDelivery, statusCode int, sendErr error) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = attempts + 1, next_attempt_at = $2, last_status_code = $3,
+			last_error = $4, delivered_at = $5, lease_expires_at = NULL, updated_at = NOW()
+		WHERE id = $6`
+
+	d.Attempts++
+	d.LastStatusCode = nil
+	d.LastError = nil
+
+	if statusCode != 0 {
+		d.LastStatusCode = &statusCode
+	}
+
+	switch {
+	case sendErr == nil:
+		now := time.Now()
+		d.Status = WebhookDeliveryDelivered
+		d.DeliveredAt = &now
+	case d.Attempts >= WebhookMaxAttempts:
+		message := sendErr.Error()
+		d.Status = WebhookDeliveryDead
+		d.LastError = &message
+	default:
+		message := sendErr.Error()
+		d.Status = WebhookDeliveryPending
+		d.LastError = &message
+		d.NextAttemptAt = time.Now().Add(webhookRetryDelay(d.Attempts))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{d.Status, d.NextAttemptAt, d.LastStatusCode, d.LastError, d.DeliveredAt, d.ID}
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+
+	return err
+}
@@ -0,0 +1,99 @@
+package fx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+)
+
+var (
+	ErrRateNotFound = errors.New("exchange rate not available")
+	ErrInvalidRate  = errors.New("invalid exchange rate")
+)
+
+// Rate is the number of units of To one unit of From buys, in major units.
+type Rate struct {
+	From  string
+	To    string
+	Value *big.Rat
+}
+
+// RateProvider supplies exchange rates used to convert transfers between
+// wallets of different currencies.
+type RateProvider interface {
+	Rate(ctx context.Context, from, to string) (Rate, error)
+}
+
+// StaticProvider serves a fixed table of rates. Inverse pairs are derived
+// when only one direction is configured.
+type StaticProvider struct {
+	rates map[string]*big.Rat
+}
+
+// NewStaticProvider builds a provider from pairs such as "USD/INR" mapped to
+// decimal strings such as "83.25".
+func NewStaticProvider(rates map[string]string) (*StaticProvider, error) {
+	p := &StaticProvider{rates: make(map[string]*big.Rat)}
+
+	for pair, value := range rates {
+		from, to, ok := strings.Cut(pair, "/")
+
+		if !ok || len(from) != 3 || len(to) != 3 {
+			return nil, fmt.Errorf("invalid currency pair %q", pair)
+		}
+
+		rate, ok := new(big.Rat).SetString(value)
+
+		if !ok || rate.Sign() <= 0 {
+			return nil, fmt.Errorf("%w for %s: %q", ErrInvalidRate, pair, value)
+		}
+
+		p.rates[pairKey(from, to)] = rate
+	}
+
+	return p, nil
+}
+
+// LoadFile reads a JSON object of currency pairs to rates, for example
+// {"USD/INR": "83.25", "AED/INR": "22.66"}.
+func LoadFile(path string) (*StaticProvider, error) {
+	b, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var rates map[string]string
+
+	err = json.Unmarshal(b, &rates)
+
+	if err != nil {
+		return nil, fmt.Errorf("reading rates file %s: %w", path, err)
+	}
+
+	return NewStaticProvider(rates)
+}
+
+func (p *StaticProvider) Rate(ctx context.Context, from, to string) (Rate, error) {
+	if from == to {
+		return Rate{From: from, To: to, Value: big.NewRat(1, 1)}, nil
+	}
+
+	if rate, ok := p.rates[pairKey(from, to)]; ok {
+		return Rate{From: from, To: to, Value: new(big.Rat).Set(rate)}, nil
+	}
+
+	if rate, ok := p.rates[pairKey(to, from)]; ok {
+		return Rate{From: from, To: to, Value: new(big.Rat).Inv(rate)}, nil
+	}
+
+	return Rate{}, ErrRateNotFound
+}
+
+func pairKey(from, to string) string {
+	return from + "/" + to
+}
@@ -0,0 +1,246 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"embed"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+// Mailer sends the email in templateFile, rendered with data, to recipient.
+// A template defines a "subject" and a "plainBody".
+type Mailer interface {
+	Send(recipient, templateFile string, data any) error
+}
+
+// Message is a rendered email.
+type Message struct {
+	From      string
+	To        string
+	Subject   string
+	PlainBody string
+	Date      time.Time
+}
+
+func render(sender, recipient, templateFile string, data any) (*Message, error) {
+	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	subject := new(bytes.Buffer)
+
+	err = tmpl.ExecuteTemplate(subject, "subject", data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	plainBody := new(bytes.Buffer)
+
+	err = tmpl.ExecuteTemplate(plainBody, "plainBody", data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &Message{
+		From:      sender,
+		To:        recipient,
+		Subject:   strings.TrimSpace(subject.String()),
+		PlainBody: plainBody.String(),
+		Date:      time.Now(),
+	}
+
+	return msg, nil
+}
+
+// bytes formats msg as an RFC 5322 message.
+func (msg *Message) bytes() []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "From: %s\r\n", msg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", msg.Date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.PlainBody, "\n", "\r\n"))
+
+	return b.Bytes()
+}
+
+// SMTP sends through an SMTP server, upgrading to TLS when the server offers
+// it and authenticating when a username is set. A failed send is retried
+// twice.
+type SMTP struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Sender   string
+	Timeout  time.Duration
+}
+
+func (m *SMTP) Send(recipient, templateFile string, data any) error {
+	msg, err := render(m.Sender, recipient, templateFile, data)
+
+	if err != nil {
+		return err
+	}
+
+	for i := 1; i <= 3; i++ {
+		err = m.send(msg)
+
+		if err == nil {
+			return nil
+		}
+
+		if i < 3 {
+			time.Sleep(500 * time.Millisecond)
+		}
+	}
+
+	return err
+}
+
+func (m *SMTP) send(msg *Message) error {
+	from, err := mail.ParseAddress(msg.From)
+
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+
+	conn, err := net.DialTimeout("tcp", addr, m.Timeout)
+
+	if err != nil {
+		return err
+	}
+
+	conn.SetDeadline(time.Now().Add(m.Timeout))
+
+	c, err := smtp.NewClient(conn, m.Host)
+
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		err = c.StartTLS(&tls.Config{ServerName: m.Host})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.Username != "" {
+		err = c.Auth(smtp.PlainAuth("", m.Username, m.Password, m.Host))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = c.Mail(from.Address); err != nil {
+		return err
+	}
+
+	if err = c.Rcpt(msg.To); err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+
+	if err != nil {
+		return err
+	}
+
+	if _, err = w.Write(msg.bytes()); err != nil {
+		return err
+	}
+
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// File writes each email to Dir instead of sending it, for development.
+type File struct {
+	Dir    string
+	Sender string
+}
+
+func (m *File) Send(recipient, templateFile string, data any) error {
+	msg, err := render(m.Sender, recipient, templateFile, data)
+
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(m.Dir, 0o700)
+
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", msg.Date.UnixNano(), strings.TrimSuffix(templateFile, filepath.Ext(templateFile)))
+
+	return os.WriteFile(filepath.Join(m.Dir, name), msg.bytes(), 0o600)
+}
+
+// Memory keeps the emails it is asked to send, for tests.
+type Memory struct {
+	Sender string
+
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (m *Memory) Send(recipient, templateFile string, data any) error {
+	msg, err := render(m.Sender, recipient, templateFile, data)
+
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, *msg)
+
+	return nil
+}
+
+// Messages returns the emails sent so far.
+func (m *Memory) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	messages := make([]Message, len(m.messages))
+	copy(messages, m.messages)
+
+	return messages
+}
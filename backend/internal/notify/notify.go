@@ -0,0 +1,44 @@
+package notify
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Event tells a user that something happened to them, such as a payment
+// request they received being cancelled.
+type Event struct {
+	Type      string      `json:"type"`
+	UserID    int64       `json:"user_id"`
+	Data      interface{} `json:"data"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// Notifier delivers events. Notify must not block the request that caused
+// the event, implementations that do slow work do it in the background.
+type Notifier interface {
+	Notify(event Event)
+}
+
+// New returns an event of type for the user, created now.
+func New(eventType string, userID int64, data interface{}) Event {
+	return Event{Type: eventType, UserID: userID, Data: data, CreatedAt: time.Now()}
+}
+
+// Logger writes events to a log, it is the default notifier.
+type Logger struct {
+	Logger *slog.Logger
+}
+
+func (l Logger) Notify(event Event) {
+	l.Logger.Info("notification", "type", event.Type, "user_id", event.UserID)
+}
+
+// Multi sends every event to each of its notifiers.
+type Multi []Notifier
+
+func (m Multi) Notify(event Event) {
+	for _, n := range m {
+		n.Notify(event)
+	}
+}
@@ -0,0 +1,54 @@
+package sms
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// Sender delivers a text message to a phone number in E.164 form.
+type Sender interface {
+	Send(to, body string) error
+}
+
+// Log writes messages to a log instead of sending them, for development
+// until an SMS gateway is configured.
+type Log struct {
+	Logger *slog.Logger
+}
+
+func (l Log) Send(to, body string) error {
+	l.Logger.Info("sms", "to", to, "body", body)
+	return nil
+}
+
+// Message is a text message a Memory sender was asked to send.
+type Message struct {
+	To   string
+	Body string
+}
+
+// Memory keeps the messages it is asked to send, for tests.
+type Memory struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (m *Memory) Send(to, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, Message{To: to, Body: body})
+
+	return nil
+}
+
+// Messages returns the messages sent so far.
+func (m *Memory) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	messages := make([]Message, len(m.messages))
+	copy(messages, m.messages)
+
+	return messages
+}
@@ -0,0 +1,257 @@
+package tokens
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrUnknownKey     = errors.New("unknown signing key")
+	ErrNoSigningKey   = errors.New("no signing key configured")
+	ErrUnsupportedKey = errors.New("unsupported key type")
+)
+
+// LegacyKeyID is assumed for tokens without a kid header, which were signed
+// before keys had ids.
+const LegacyKeyID = "default"
+
+// Key is one entry in a Keyring. Verify-only keys have no signing key.
+type Key struct {
+	ID         string
+	Method     jwt.SigningMethod
+	signingKey interface{}
+	verifyKey  interface{}
+}
+
+func (k *Key) CanSign() bool {
+	return k.signingKey != nil
+}
+
+// Keyring holds every key tokens may be verified with and the one new tokens
+// are signed with. Rotating means adding the new key, making it the signing
+// key and removing the old one once its tokens have expired.
+type Keyring struct {
+	mu         sync.RWMutex
+	keys       map[string]*Key
+	signingKID string
+}
+
+func NewKeyring() *Keyring {
+	return &Keyring{keys: make(map[string]*Key)}
+}
+
+// AddHMAC adds an HS256 shared secret.
+func (k *Keyring) AddHMAC(kid string, secret []byte) error {
+	if len(secret) == 0 {
+		return fmt.Errorf("key %q: secret must not be empty", kid)
+	}
+
+	return k.add(&Key{ID: kid, Method: jwt.SigningMethodHS256, signingKey: secret, verifyKey: secret})
+}
+
+// AddPEM adds an RSA (RS256) or Ed25519 (EdDSA) key. A private key can sign
+// and verify, a public key can only verify.
+func (k *Keyring) AddPEM(kid string, pemBytes []byte) error {
+	if rsaKey, err := jwt.ParseRSAPrivateKeyFromPEM(pemBytes); err == nil {
+		return k.add(&Key{ID: kid, Method: jwt.SigningMethodRS256, signingKey: rsaKey, verifyKey: &rsaKey.PublicKey})
+	}
+
+	if edKey, err := jwt.ParseEdPrivateKeyFromPEM(pemBytes); err == nil {
+		signer, ok := edKey.(crypto.Signer)
+
+		if !ok {
+			return fmt.Errorf("key %q: %w", kid, ErrUnsupportedKey)
+		}
+
+		return k.add(&Key{ID: kid, Method: jwt.SigningMethodEdDSA, signingKey: edKey, verifyKey: signer.Public()})
+	}
+
+	if rsaKey, err := jwt.ParseRSAPublicKeyFromPEM(pemBytes); err == nil {
+		return k.add(&Key{ID: kid, Method: jwt.SigningMethodRS256, verifyKey: rsaKey})
+	}
+
+	if edKey, err := jwt.ParseEdPublicKeyFromPEM(pemBytes); err == nil {
+		return k.add(&Key{ID: kid, Method: jwt.SigningMethodEdDSA, verifyKey: edKey})
+	}
+
+	return fmt.Errorf("key %q: %w", kid, ErrUnsupportedKey)
+}
+
+func (k *Keyring) LoadPEMFile(kid, path string) error {
+	b, err := os.ReadFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	return k.AddPEM(kid, b)
+}
+
+func (k *Keyring) add(key *Key) error {
+	if key.ID == "" {
+		return errors.New("key id must not be empty")
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, exists := k.keys[key.ID]; exists {
+		return fmt.Errorf("key %q is already in the keyring", key.ID)
+	}
+
+	k.keys[key.ID] = key
+
+	return nil
+}
+
+// Remove drops a key, tokens signed with it no longer verify.
+func (k *Keyring) Remove(kid string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	delete(k.keys, kid)
+
+	if k.signingKID == kid {
+		k.signingKID = ""
+	}
+}
+
+// SetSigningKey selects the key new tokens are signed with.
+func (k *Keyring) SetSigningKey(kid string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	key, ok := k.keys[kid]
+
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+
+	if !key.CanSign() {
+		return fmt.Errorf("key %q is verify-only and cannot sign", kid)
+	}
+
+	k.signingKID = kid
+
+	return nil
+}
+
+// Sign signs claims with the current signing key and sets the kid header.
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	k.mu.RLock()
+	key, ok := k.keys[k.signingKID]
+	k.mu.RUnlock()
+
+	if !ok {
+		return "", ErrNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.signingKey)
+}
+
+// Parse verifies tokenString with the key named by its kid header. The
+// algorithm must match the one the key was registered for, so a token cannot
+// pick a weaker algorithm or use a public key as an HMAC secret.
+func (k *Keyring) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+
+		if kid == "" {
+			kid = LegacyKeyID
+		}
+
+		k.mu.RLock()
+		key, ok := k.keys[kid]
+		k.mu.RUnlock()
+
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+		}
+
+		if t.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %q for key %q", t.Method.Alg(), kid)
+		}
+
+		return key.verifyKey, nil
+	}, jwt.WithValidMethods(k.algorithms()))
+}
+
+func (k *Keyring) algorithms() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var algs []string
+
+	for _, key := range k.keys {
+		if alg := key.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+
+	return algs
+}
+
+// JWK is the public half of an asymmetric key in RFC 7517 form.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// JWKS returns the public keys of the keyring. Shared HMAC secrets are never
+// published, services verifying those tokens must be given the secret.
+func (k *Keyring) JWKS() []JWK {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	jwks := []JWK{}
+
+	for _, key := range k.keys {
+		switch pub := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwks = append(jwks, JWK{
+				KeyType:   "RSA",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: key.Method.Alg(),
+				N:         base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks = append(jwks, JWK{
+				KeyType:   "OKP",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: key.Method.Alg(),
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+
+	sort.Slice(jwks, func(i, j int) bool {
+		return jwks[i].KeyID < jwks[j].KeyID
+	})
+
+	return jwks
+}
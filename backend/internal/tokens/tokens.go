@@ -2,6 +2,7 @@ package tokens
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -11,16 +12,29 @@ var (
 	ErrInvalidJWTToken = errors.New("invalid JWT token")
 )
 
-func CreateToken(secretKey, username string) (string, error) {
-	token := jwt.NewWithClaims(
-		jwt.SigningMethodHS256,
-		jwt.MapClaims{
-			"username": username,
-			"exp": time.Now().Add(time.Hour * 24).Unix(),
-		},
-	)
+// ScopeMFAPending marks a token that only proves the password was right. It
+// is exchanged for a session once the second factor is verified and is never
+// accepted as an access token.
+const ScopeMFAPending = "mfa_pending"
+
+// Claims identify the user and the session an access token was issued for.
+// Access tokens have no scope.
+type Claims struct {
+	Username  string `json:"username"`
+	SessionID int64  `json:"sid,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	jwt.RegisteredClaims
+}
 
-	tokenString, err := token.SignedString([]byte(secretKey))
+func CreateToken(keyring *Keyring, username string, sessionID int64, ttl time.Duration) (string, error) {
+	tokenString, err := keyring.Sign(Claims{
+		Username:  username,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+		},
+	})
 	if err != nil {
 		return "", err
 	}
@@ -28,31 +42,62 @@ func CreateToken(secretKey, username string) (string, error) {
 	return tokenString, nil
 }
 
-func parseToken(tokenString string, secretKey []byte) (*jwt.Token, error) {
-	return jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-		return secretKey, nil
+// CreateMFAToken issues the token a user whose password was right signs in
+// with once they also give their second factor.
+func CreateMFAToken(keyring *Keyring, username string, ttl time.Duration) (string, error) {
+	return keyring.Sign(Claims{
+		Username: username,
+		Scope:    ScopeMFAPending,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+		},
 	})
 }
 
-func VerifyToken(tokenString, secretKey string) (string, error) {
-	
-	token, err := parseToken(tokenString, []byte(secretKey))
+func VerifyToken(tokenString string, keyring *Keyring) (*Claims, error) {
+	claims, err := parseClaims(tokenString, keyring)
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	if !token.Valid {
-		return "", ErrInvalidJWTToken
+	if claims.SessionID == 0 || claims.Scope != "" {
+		return nil, ErrInvalidJWTToken
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return "", ErrInvalidJWTToken
+	return claims, nil
+}
+
+func VerifyMFAToken(tokenString string, keyring *Keyring) (*Claims, error) {
+	claims, err := parseClaims(tokenString, keyring)
+
+	if err != nil {
+		return nil, err
 	}
 
-	username := claims["username"].(string)
-	return username, nil
+	if claims.Scope != ScopeMFAPending {
+		return nil, ErrInvalidJWTToken
+	}
+
+	return claims, nil
 }
 
+func parseClaims(tokenString string, keyring *Keyring) (*Claims, error) {
+	token, err := keyring.Parse(tokenString, &Claims{})
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidJWTToken, err)
+	}
 
+	if !token.Valid {
+		return nil, ErrInvalidJWTToken
+	}
+
+	claims, ok := token.Claims.(*Claims)
+	if !ok || claims.Username == "" {
+		return nil, ErrInvalidJWTToken
+	}
+
+	return claims, nil
+}
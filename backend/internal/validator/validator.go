@@ -1,5 +1,10 @@
 package validator
 
+import (
+	"regexp"
+	"slices"
+)
+
 type Validator struct {
 	Errors map[string]string
 }
@@ -29,3 +34,17 @@ func (v *Validator) Check(ok bool, key, message string) {
 func (v *Validator) ValidateEmpty(field, key string) {
 	v.Check(field != "", key, "cannot be empty")
 }
+
+// PermittedValue reports whether value is one of permittedValues.
+func PermittedValue[T comparable](value T, permittedValues ...T) bool {
+	return slices.Contains(permittedValues, value)
+}
+
+var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
+
+var PhoneRX = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+
+// Matches reports whether value matches rx.
+func Matches(value string, rx *regexp.Regexp) bool {
+	return rx.MatchString(value)
+}
@@ -0,0 +1,182 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrInsecureURL      = errors.New("webhook URL must use https")
+	ErrForbiddenAddress = errors.New("webhook endpoint resolves to a forbidden address")
+)
+
+// Headers sent with every delivery.
+const (
+	SignatureHeader = "Paytm-Signature"
+	EventIDHeader   = "Paytm-Event-Id"
+	EventTypeHeader = "Paytm-Event-Type"
+)
+
+// Sign returns the signature header value for body sent at timestamp. The
+// HMAC-SHA256 covers the timestamp too, so a captured delivery cannot be
+// replayed later with a fresh timestamp.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	return fmt.Sprintf("t=%d,v1=%s", timestamp.Unix(), computeMAC(secret, timestamp.Unix(), body))
+}
+
+func computeMAC(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature header as a receiver would, rejecting it when it
+// is older than tolerance.
+func Verify(secret, header string, body []byte, tolerance time.Duration) error {
+	var timestamp int64
+	var signatures []string
+
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(part, "=")
+
+		if !ok {
+			return ErrInvalidSignature
+		}
+
+		switch key {
+		case "t":
+			t, err := strconv.ParseInt(value, 10, 64)
+
+			if err != nil {
+				return ErrInvalidSignature
+			}
+
+			timestamp = t
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	if timestamp == 0 || time.Since(time.Unix(timestamp, 0)) > tolerance {
+		return ErrInvalidSignature
+	}
+
+	expected := computeMAC(secret, timestamp, body)
+
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
+
+// PublicAddr tells whether addr may receive webhooks. Loopback, private,
+// link-local, unspecified and other non-global addresses would let endpoints
+// reach the network the server runs in.
+func PublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	return addr.IsValid() && addr.IsGlobalUnicast() && !addr.IsPrivate() &&
+		!cgnat.Contains(addr) && !addr.IsLoopback() && !addr.IsLinkLocalUnicast()
+}
+
+// cgnat is the shared address space of carrier-grade NAT, which is not
+// reachable from the internet either.
+var cgnat = netip.MustParsePrefix("100.64.0.0/10")
+
+// NewClient returns a client for a Sender that only connects to public
+// addresses. The address is checked as the connection is made, after the
+// host is resolved, so that a name cannot resolve to a public address when
+// validated and a private one when delivered to. Redirects are reported as
+// failed deliveries and no proxy is used.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+
+			if err != nil || !PublicAddr(addrPort.Addr()) {
+				return ErrForbiddenAddress
+			}
+
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			ForceAttemptHTTP2:   true,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Sender POSTs signed events to endpoints. Its client should come from
+// NewClient.
+type Sender struct {
+	Client *http.Client
+}
+
+// Send delivers body to endpoint and returns the status code of the response. Any
+// status outside 2xx is returned as an error together with the code.
+func (s *Sender) Send(ctx context.Context, endpoint, secret string, eventID int64, eventType string, body []byte) (int, error) {
+	// endpoints registered before https was required are not delivered to
+	if u, err := url.Parse(endpoint); err != nil || u.Scheme != "https" {
+		return 0, ErrInsecureURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "paytm-webhooks/1.0")
+	req.Header.Set(SignatureHeader, Sign(secret, time.Now(), body))
+	req.Header.Set(EventIDHeader, strconv.FormatInt(eventID, 10))
+	req.Header.Set(EventTypeHeader, eventType)
+
+	res, err := s.Client.Do(req)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer res.Body.Close()
+
+	// drain a little of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(res.Body, 4096))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("endpoint responded with %d", res.StatusCode)
+	}
+
+	return res.StatusCode, nil
+}
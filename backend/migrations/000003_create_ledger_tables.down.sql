@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS postings;
+DROP TABLE IF EXISTS journals;
+DROP FUNCTION IF EXISTS ledger_check_balanced();
+DROP FUNCTION IF EXISTS ledger_append_only();
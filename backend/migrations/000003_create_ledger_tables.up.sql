@@ -0,0 +1,63 @@
+CREATE TABLE IF NOT EXISTS journals (
+    id bigserial PRIMARY KEY,
+    kind text NOT NULL,
+    created_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW()
+);
+
+-- a posting with a NULL user_id belongs to the external account, which is
+-- the counterpart for money entering or leaving the platform
+CREATE TABLE IF NOT EXISTS postings (
+    id bigserial PRIMARY KEY,
+    journal_id bigint NOT NULL REFERENCES journals ON DELETE RESTRICT,
+    user_id bigint REFERENCES accounts ON DELETE RESTRICT,
+    amount bigint NOT NULL CHECK (amount <> 0),
+    created_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS postings_journal_id_idx ON postings (journal_id);
+CREATE INDEX IF NOT EXISTS postings_user_id_idx ON postings (user_id, id);
+
+CREATE OR REPLACE FUNCTION ledger_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION '% is append-only', TG_TABLE_NAME;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER journals_append_only
+    BEFORE UPDATE OR DELETE ON journals
+    FOR EACH ROW EXECUTE FUNCTION ledger_append_only();
+
+CREATE TRIGGER postings_append_only
+    BEFORE UPDATE OR DELETE ON postings
+    FOR EACH ROW EXECUTE FUNCTION ledger_append_only();
+
+CREATE OR REPLACE FUNCTION ledger_check_balanced() RETURNS trigger AS $$
+BEGIN
+    IF (SELECT SUM(amount) FROM postings WHERE journal_id = NEW.journal_id) <> 0 THEN
+        RAISE EXCEPTION 'journal % is not balanced', NEW.journal_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER postings_balanced
+    AFTER INSERT ON postings
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION ledger_check_balanced();
+
+-- open the ledger with the balances accounts already hold
+WITH opening AS (
+    INSERT INTO journals (kind)
+    SELECT 'opening'
+    WHERE EXISTS (SELECT 1 FROM accounts WHERE balance <> 0)
+    RETURNING id
+)
+INSERT INTO postings (journal_id, user_id, amount)
+SELECT opening.id, accounts.user_id, accounts.balance
+FROM opening, accounts
+WHERE accounts.balance <> 0
+UNION ALL
+SELECT opening.id, NULL, -SUM(accounts.balance)
+FROM opening, accounts
+WHERE accounts.balance <> 0
+GROUP BY opening.id;
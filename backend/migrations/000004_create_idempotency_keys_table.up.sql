@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    key text NOT NULL,
+    request_hash bytea NOT NULL,
+    status_code integer,
+    response_body bytea,
+    created_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, key)
+);
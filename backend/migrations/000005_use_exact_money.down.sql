@@ -0,0 +1,13 @@
+CREATE OR REPLACE FUNCTION ledger_check_balanced() RETURNS trigger AS $$
+BEGIN
+    IF (SELECT SUM(amount) FROM postings WHERE journal_id = NEW.journal_id) <> 0 THEN
+        RAISE EXCEPTION 'journal % is not balanced', NEW.journal_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE postings DROP COLUMN IF EXISTS currency;
+
+ALTER TABLE accounts DROP COLUMN IF EXISTS currency;
+ALTER TABLE accounts ALTER COLUMN balance TYPE integer;
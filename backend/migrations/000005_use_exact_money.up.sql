@@ -0,0 +1,20 @@
+ALTER TABLE accounts ALTER COLUMN balance TYPE bigint;
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS currency text NOT NULL DEFAULT 'INR';
+
+ALTER TABLE postings ADD COLUMN IF NOT EXISTS currency text NOT NULL DEFAULT 'INR';
+
+-- a journal must balance in every currency it touches
+CREATE OR REPLACE FUNCTION ledger_check_balanced() RETURNS trigger AS $$
+BEGIN
+    IF EXISTS (
+        SELECT 1
+        FROM postings
+        WHERE journal_id = NEW.journal_id
+        GROUP BY currency
+        HAVING SUM(amount) <> 0
+    ) THEN
+        RAISE EXCEPTION 'journal % is not balanced', NEW.journal_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
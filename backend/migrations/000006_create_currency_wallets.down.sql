@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS fx_conversions;
+
+ALTER TABLE postings DROP CONSTRAINT IF EXISTS postings_account_fkey;
+
+ALTER TABLE accounts DROP CONSTRAINT IF EXISTS accounts_pkey;
+ALTER TABLE accounts ADD CONSTRAINT accounts_pkey PRIMARY KEY (user_id);
+
+ALTER TABLE postings ADD CONSTRAINT postings_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES accounts (user_id) ON DELETE RESTRICT;
@@ -0,0 +1,20 @@
+-- a user holds one wallet per currency
+ALTER TABLE postings DROP CONSTRAINT IF EXISTS postings_user_id_fkey;
+
+ALTER TABLE accounts DROP CONSTRAINT IF EXISTS accounts_pkey;
+ALTER TABLE accounts ALTER COLUMN user_id DROP DEFAULT;
+ALTER TABLE accounts ADD CONSTRAINT accounts_pkey PRIMARY KEY (user_id, currency);
+
+ALTER TABLE postings ADD CONSTRAINT postings_account_fkey
+    FOREIGN KEY (user_id, currency) REFERENCES accounts (user_id, currency) ON DELETE RESTRICT;
+
+CREATE TABLE IF NOT EXISTS fx_conversions (
+    journal_id bigint PRIMARY KEY REFERENCES journals ON DELETE RESTRICT,
+    source_amount bigint NOT NULL,
+    source_currency text NOT NULL,
+    target_amount bigint NOT NULL,
+    target_currency text NOT NULL,
+    rate numeric NOT NULL,
+    spread_bps integer NOT NULL,
+    created_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW()
+);
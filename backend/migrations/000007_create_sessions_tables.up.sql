@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS sessions (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW(),
+    revoked_at timestamp(0) WITH time zone
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    hash bytea PRIMARY KEY,
+    session_id bigint NOT NULL REFERENCES sessions ON DELETE CASCADE,
+    expiry timestamp(0) WITH time zone NOT NULL,
+    used_at timestamp(0) WITH time zone
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_session_id_idx ON refresh_tokens (session_id);
@@ -0,0 +1,21 @@
+-- held is the part of balance reserved by active holds
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS held bigint NOT NULL DEFAULT 0 CHECK (held >= 0);
+
+CREATE TABLE IF NOT EXISTS holds (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    currency text NOT NULL,
+    payee_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    amount bigint NOT NULL CHECK (amount > 0),
+    captured_amount bigint NOT NULL DEFAULT 0 CHECK (captured_amount >= 0 AND captured_amount <= amount),
+    status text NOT NULL DEFAULT 'active',
+    journal_id bigint REFERENCES journals ON DELETE RESTRICT,
+    expires_at timestamp(0) WITH time zone NOT NULL,
+    created_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id, currency) REFERENCES accounts (user_id, currency) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS holds_user_id_idx ON holds (user_id, currency);
+CREATE INDEX IF NOT EXISTS holds_payee_id_idx ON holds (payee_id);
+CREATE INDEX IF NOT EXISTS holds_active_expires_at_idx ON holds (expires_at) WHERE status = 'active';
@@ -0,0 +1 @@
+ALTER TABLE journals DROP COLUMN IF EXISTS refund_of;
@@ -0,0 +1,3 @@
+ALTER TABLE journals ADD COLUMN IF NOT EXISTS refund_of bigint REFERENCES journals ON DELETE RESTRICT;
+
+CREATE INDEX IF NOT EXISTS journals_refund_of_idx ON journals (refund_of) WHERE refund_of IS NOT NULL;
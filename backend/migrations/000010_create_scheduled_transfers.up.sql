@@ -0,0 +1,38 @@
+-- reference makes a transfer idempotent, a second journal with the same
+-- reference is rejected
+ALTER TABLE journals ADD COLUMN IF NOT EXISTS reference text UNIQUE;
+
+CREATE TABLE IF NOT EXISTS scheduled_transfers (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    to_user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    amount bigint NOT NULL CHECK (amount > 0),
+    currency text NOT NULL,
+    frequency text NOT NULL CHECK (frequency IN ('once', 'daily', 'weekly', 'monthly')),
+    start_at timestamp(0) WITH time zone NOT NULL,
+    end_at timestamp(0) WITH time zone,
+    max_runs integer CHECK (max_runs > 0),
+    occurrence integer NOT NULL DEFAULT 0,
+    attempts integer NOT NULL DEFAULT 0,
+    next_run_at timestamp(0) WITH time zone,
+    status text NOT NULL DEFAULT 'active',
+    lease_expires_at timestamp(0) WITH time zone,
+    created_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS scheduled_transfers_user_id_idx ON scheduled_transfers (user_id);
+CREATE INDEX IF NOT EXISTS scheduled_transfers_due_idx ON scheduled_transfers (next_run_at) WHERE status = 'active';
+
+CREATE TABLE IF NOT EXISTS scheduled_transfer_runs (
+    id bigserial PRIMARY KEY,
+    scheduled_transfer_id bigint NOT NULL REFERENCES scheduled_transfers ON DELETE CASCADE,
+    occurrence integer NOT NULL,
+    attempt integer NOT NULL,
+    status text NOT NULL,
+    journal_id bigint REFERENCES journals ON DELETE RESTRICT,
+    error text,
+    created_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS scheduled_transfer_runs_scheduled_transfer_id_idx ON scheduled_transfer_runs (scheduled_transfer_id);
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS payment_requests (
+    id bigserial PRIMARY KEY,
+    requester_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    payer_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    amount bigint NOT NULL CHECK (amount > 0),
+    currency text NOT NULL,
+    note text NOT NULL DEFAULT '',
+    status text NOT NULL DEFAULT 'pending',
+    journal_id bigint REFERENCES journals ON DELETE RESTRICT,
+    expires_at timestamp(0) WITH time zone NOT NULL,
+    responded_at timestamp(0) WITH time zone,
+    created_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW(),
+    CHECK (requester_id <> payer_id)
+);
+
+CREATE INDEX IF NOT EXISTS payment_requests_requester_id_idx ON payment_requests (requester_id);
+CREATE INDEX IF NOT EXISTS payment_requests_payer_id_idx ON payment_requests (payer_id);
+CREATE INDEX IF NOT EXISTS payment_requests_pending_expires_at_idx ON payment_requests (expires_at) WHERE status = 'pending';
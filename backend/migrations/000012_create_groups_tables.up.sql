@@ -0,0 +1,49 @@
+CREATE TABLE IF NOT EXISTS groups (
+    id bigserial PRIMARY KEY,
+    name text NOT NULL,
+    currency text NOT NULL,
+    created_by bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS group_members (
+    group_id bigint NOT NULL REFERENCES groups ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    joined_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (group_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS group_members_user_id_idx ON group_members (user_id);
+
+CREATE TABLE IF NOT EXISTS group_expenses (
+    id bigserial PRIMARY KEY,
+    group_id bigint NOT NULL REFERENCES groups ON DELETE CASCADE,
+    paid_by bigint NOT NULL,
+    amount bigint NOT NULL CHECK (amount > 0),
+    description text NOT NULL DEFAULT '',
+    split text NOT NULL CHECK (split IN ('equal', 'percentage', 'exact')),
+    created_by bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (group_id, paid_by) REFERENCES group_members (group_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS group_expenses_group_id_idx ON group_expenses (group_id);
+
+CREATE TABLE IF NOT EXISTS group_expense_shares (
+    expense_id bigint NOT NULL REFERENCES group_expenses ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    amount bigint NOT NULL CHECK (amount >= 0),
+    PRIMARY KEY (expense_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS group_settlements (
+    id bigserial PRIMARY KEY,
+    group_id bigint NOT NULL REFERENCES groups ON DELETE CASCADE,
+    from_user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    to_user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    amount bigint NOT NULL CHECK (amount > 0),
+    journal_id bigint NOT NULL REFERENCES journals ON DELETE RESTRICT,
+    created_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS group_settlements_group_id_idx ON group_settlements (group_id);
@@ -0,0 +1,41 @@
+CREATE TABLE IF NOT EXISTS merchants (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    name text NOT NULL,
+    created_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS merchants_user_id_idx ON merchants (user_id);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id bigserial PRIMARY KEY,
+    merchant_id bigint NOT NULL REFERENCES merchants ON DELETE CASCADE,
+    name text NOT NULL DEFAULT '',
+    prefix text NOT NULL,
+    hash bytea NOT NULL UNIQUE,
+    scopes text[] NOT NULL,
+    last_used_at timestamp(0) WITH time zone,
+    revoked_at timestamp(0) WITH time zone,
+    created_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_merchant_id_idx ON api_keys (merchant_id);
+
+CREATE TABLE IF NOT EXISTS orders (
+    id bigserial PRIMARY KEY,
+    merchant_id bigint NOT NULL REFERENCES merchants ON DELETE CASCADE,
+    amount bigint NOT NULL CHECK (amount > 0),
+    currency text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    merchant_reference text,
+    status text NOT NULL DEFAULT 'pending',
+    customer_id bigint REFERENCES users ON DELETE SET NULL,
+    journal_id bigint REFERENCES journals ON DELETE RESTRICT,
+    expires_at timestamp(0) WITH time zone NOT NULL,
+    paid_at timestamp(0) WITH time zone,
+    created_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (merchant_id, merchant_reference)
+);
+
+CREATE INDEX IF NOT EXISTS orders_pending_expires_at_idx ON orders (expires_at) WHERE status = 'pending';
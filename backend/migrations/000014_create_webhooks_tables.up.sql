@@ -0,0 +1,45 @@
+CREATE TABLE IF NOT EXISTS webhook_endpoints (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    merchant_id bigint REFERENCES merchants ON DELETE CASCADE,
+    url text NOT NULL,
+    secret text NOT NULL,
+    event_types text[] NOT NULL DEFAULT '{}',
+    disabled_at timestamp(0) WITH time zone,
+    created_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_endpoints_user_id_idx ON webhook_endpoints (user_id);
+
+-- the outbox, events are written in the transaction that caused them and fanned
+-- out to deliveries by the dispatcher
+CREATE TABLE IF NOT EXISTS webhook_events (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    merchant_id bigint REFERENCES merchants ON DELETE CASCADE,
+    type text NOT NULL,
+    payload jsonb NOT NULL,
+    fanned_out boolean NOT NULL DEFAULT false,
+    created_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_events_pending_idx ON webhook_events (id) WHERE NOT fanned_out;
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id bigserial PRIMARY KEY,
+    event_id bigint NOT NULL REFERENCES webhook_events ON DELETE CASCADE,
+    endpoint_id bigint NOT NULL REFERENCES webhook_endpoints ON DELETE CASCADE,
+    status text NOT NULL DEFAULT 'pending',
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW(),
+    lease_expires_at timestamp(0) WITH time zone,
+    last_status_code integer,
+    last_error text,
+    delivered_at timestamp(0) WITH time zone,
+    created_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (event_id, endpoint_id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_endpoint_id_idx ON webhook_deliveries (endpoint_id);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS postings_user_id_created_at_idx;
+DROP TABLE IF EXISTS limit_tiers;
+ALTER TABLE users DROP COLUMN IF EXISTS verification_level;
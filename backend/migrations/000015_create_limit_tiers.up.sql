@@ -0,0 +1,24 @@
+-- 0 is unverified, 1 has a verified email or phone and 2 has completed KYC
+ALTER TABLE users ADD COLUMN IF NOT EXISTS verification_level smallint NOT NULL DEFAULT 0;
+
+-- limits per verification level and currency in minor units, NULL means no
+-- limit and a currency without a row is not limited at that level
+CREATE TABLE IF NOT EXISTS limit_tiers (
+    verification_level smallint NOT NULL,
+    currency text NOT NULL,
+    max_transaction bigint,
+    daily_outgoing bigint,
+    monthly_outgoing bigint,
+    transfers_per_hour integer,
+    max_balance bigint,
+    PRIMARY KEY (verification_level, currency)
+);
+
+INSERT INTO limit_tiers (verification_level, currency, max_transaction, daily_outgoing, monthly_outgoing, transfers_per_hour, max_balance)
+VALUES
+    (0, 'INR', 1000000, 2000000, 5000000, 10, 1000000),
+    (1, 'INR', 10000000, 10000000, 20000000, 20, 20000000),
+    (2, 'INR', 20000000, 50000000, 100000000, 50, 20000000)
+ON CONFLICT DO NOTHING;
+
+CREATE INDEX IF NOT EXISTS postings_user_id_created_at_idx ON postings (user_id, created_at) WHERE amount < 0;
@@ -0,0 +1,29 @@
+-- set whenever the password changes, the first transfer after a change is a
+-- risk signal
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_changed_at timestamp(0) WITH time zone;
+
+-- transfers that risk screening held for review or blocked, the amount of a
+-- pending review is reserved in the sender's held balance
+CREATE TABLE IF NOT EXISTS risk_reviews (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    to_user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    amount bigint NOT NULL CHECK (amount > 0),
+    currency text NOT NULL,
+    conversion jsonb,
+    reference text,
+    score integer NOT NULL,
+    decision text NOT NULL,
+    signals jsonb NOT NULL DEFAULT '[]',
+    status text NOT NULL,
+    journal_id bigint REFERENCES journals ON DELETE RESTRICT,
+    reviewed_by bigint REFERENCES users ON DELETE SET NULL,
+    reviewed_at timestamp(0) WITH time zone,
+    note text NOT NULL DEFAULT '',
+    created_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id, currency) REFERENCES accounts (user_id, currency) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS risk_reviews_user_id_idx ON risk_reviews (user_id);
+CREATE INDEX IF NOT EXISTS risk_reviews_status_idx ON risk_reviews (status, created_at);
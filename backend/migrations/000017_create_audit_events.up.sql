@@ -0,0 +1,48 @@
+-- audit_events is append-only. Events are inserted without a hash and the
+-- audit worker chains them in seq order, each hash covering the event and the
+-- hash before it, so that changing or removing an event breaks the chain.
+CREATE TABLE IF NOT EXISTS audit_events (
+    id bigserial PRIMARY KEY,
+    occurred_at timestamp WITH time zone NOT NULL DEFAULT NOW(),
+    actor_id bigint,
+    action text NOT NULL,
+    target_type text NOT NULL DEFAULT '',
+    target_id text NOT NULL DEFAULT '',
+    ip text NOT NULL DEFAULT '',
+    user_agent text NOT NULL DEFAULT '',
+    request_id text NOT NULL DEFAULT '',
+    before jsonb,
+    after jsonb,
+    seq bigint UNIQUE,
+    prev_hash text,
+    hash text
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_actor_id_idx ON audit_events (actor_id, id);
+CREATE INDEX IF NOT EXISTS audit_events_action_idx ON audit_events (action, id);
+CREATE INDEX IF NOT EXISTS audit_events_target_idx ON audit_events (target_type, target_id, id);
+CREATE INDEX IF NOT EXISTS audit_events_unchained_idx ON audit_events (id) WHERE seq IS NULL;
+
+-- the only update allowed is chaining an event once, nothing is ever deleted
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND OLD.seq IS NULL AND NEW.seq IS NOT NULL AND NEW.hash IS NOT NULL
+        AND (NEW.id, NEW.occurred_at, NEW.actor_id, NEW.action, NEW.target_type, NEW.target_id,
+            NEW.ip, NEW.user_agent, NEW.request_id, NEW.before, NEW.after)
+        IS NOT DISTINCT FROM (OLD.id, OLD.occurred_at, OLD.actor_id, OLD.action, OLD.target_type, OLD.target_id,
+            OLD.ip, OLD.user_agent, OLD.request_id, OLD.before, OLD.after)
+    THEN
+        RETURN NEW;
+    END IF;
+
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+CREATE TRIGGER audit_events_append_only BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+DROP TRIGGER IF EXISTS audit_events_no_truncate ON audit_events;
+CREATE TRIGGER audit_events_no_truncate BEFORE TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS balance_adjustments;
+ALTER TABLE accounts DROP COLUMN IF EXISTS status;
+ALTER TABLE users DROP COLUMN IF EXISTS role;
@@ -0,0 +1,20 @@
+-- the permissions of each role are defined in the application
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role text NOT NULL DEFAULT 'user';
+
+-- a frozen wallet can neither send nor receive money
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'active';
+
+-- manual corrections of a balance made by staff, each backed by a journal
+CREATE TABLE IF NOT EXISTS balance_adjustments (
+    id bigserial PRIMARY KEY,
+    journal_id bigint NOT NULL UNIQUE REFERENCES journals ON DELETE RESTRICT,
+    user_id bigint NOT NULL,
+    amount bigint NOT NULL CHECK (amount <> 0),
+    currency text NOT NULL,
+    reason text NOT NULL CHECK (reason <> ''),
+    created_by bigint REFERENCES users ON DELETE SET NULL,
+    created_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id, currency) REFERENCES accounts (user_id, currency) ON DELETE RESTRICT
+);
+
+CREATE INDEX IF NOT EXISTS balance_adjustments_user_id_idx ON balance_adjustments (user_id);
@@ -0,0 +1,4 @@
+ALTER TABLE accounts DROP CONSTRAINT IF EXISTS accounts_closed_check;
+ALTER TABLE accounts DROP CONSTRAINT IF EXISTS accounts_status_check;
+ALTER TABLE accounts DROP COLUMN IF EXISTS closed_at;
+UPDATE accounts SET status = 'frozen' WHERE status <> 'active';
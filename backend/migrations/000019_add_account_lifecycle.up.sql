@@ -0,0 +1,11 @@
+-- a wallet frozen for debits still receives money, one frozen for all does not
+UPDATE accounts SET status = 'frozen_all' WHERE status = 'frozen';
+
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS closed_at timestamp(0) WITH time zone;
+
+ALTER TABLE accounts ADD CONSTRAINT accounts_status_check
+    CHECK (status IN ('active', 'frozen_debit', 'frozen_all', 'closed'));
+
+-- a closed wallet holds no money and no longer moves any
+ALTER TABLE accounts ADD CONSTRAINT accounts_closed_check
+    CHECK (status <> 'closed' OR (balance = 0 AND held = 0 AND closed_at IS NOT NULL));
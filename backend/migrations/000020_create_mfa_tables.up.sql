@@ -0,0 +1,20 @@
+-- a user's TOTP secret, two-factor authentication is on once it is confirmed
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id bigint PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+    secret text NOT NULL,
+    confirmed_at timestamp(0) WITH time zone,
+    -- the step of the last accepted code, a code is only accepted once
+    last_counter bigint NOT NULL DEFAULT 0,
+    created_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW()
+);
+
+-- single use codes for signing in without the authenticator, only their
+-- sha256 hashes are stored
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    hash bytea NOT NULL,
+    used_at timestamp(0) WITH time zone,
+    created_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, hash)
+);
@@ -0,0 +1,9 @@
+-- the PIN that authorizes moving money, kept apart from the login password
+CREATE TABLE IF NOT EXISTS transaction_pins (
+    user_id bigint PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+    hash bytea NOT NULL,
+    failed_attempts integer NOT NULL DEFAULT 0,
+    locked_until timestamp(0) WITH time zone,
+    created_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,9 @@
+-- failed sign-ins counted per username and per client IP, keyed like
+-- "username:alice" or "ip:203.0.113.7"
+CREATE TABLE IF NOT EXISTS sign_in_throttles (
+    key text PRIMARY KEY,
+    failed_attempts integer NOT NULL DEFAULT 0,
+    last_failed_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW(),
+    blocked_until timestamp(0) WITH time zone,
+    locked boolean NOT NULL DEFAULT false
+);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS verification_codes;
+
+ALTER TABLE users DROP COLUMN IF EXISTS phone_verified_at;
+ALTER TABLE users DROP COLUMN IF EXISTS email_verified_at;
+ALTER TABLE users DROP COLUMN IF EXISTS phone;
@@ -0,0 +1,16 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone text UNIQUE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at timestamp(0) WITH time zone;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone_verified_at timestamp(0) WITH time zone;
+
+-- the one-time code last sent to verify the user's email or phone, only its
+-- sha256 is kept and it is only good for the destination it was sent to
+CREATE TABLE IF NOT EXISTS verification_codes (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    channel text NOT NULL CHECK (channel IN ('email', 'phone')),
+    destination text NOT NULL,
+    hash bytea NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    expiry timestamp(0) WITH time zone NOT NULL,
+    created_at timestamp(0) WITH time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, channel)
+);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS risk_reviews_origin_idx;
+
+ALTER TABLE risk_reviews DROP COLUMN IF EXISTS origin_id;
+ALTER TABLE risk_reviews DROP COLUMN IF EXISTS origin_type;
@@ -0,0 +1,6 @@
+-- the payment request, order, hold or group a held transfer was made for,
+-- releasing the review completes it
+ALTER TABLE risk_reviews ADD COLUMN IF NOT EXISTS origin_type text;
+ALTER TABLE risk_reviews ADD COLUMN IF NOT EXISTS origin_id bigint;
+
+CREATE INDEX IF NOT EXISTS risk_reviews_origin_idx ON risk_reviews (origin_type, origin_id) WHERE status = 'pending';
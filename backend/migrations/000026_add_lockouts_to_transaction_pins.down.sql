@@ -0,0 +1 @@
+ALTER TABLE transaction_pins DROP COLUMN IF EXISTS lockouts;
@@ -0,0 +1,3 @@
+-- how many times the PIN was locked since it was last set, each lockout is
+-- longer and past a few the PIN has to be reset
+ALTER TABLE transaction_pins ADD COLUMN IF NOT EXISTS lockouts integer NOT NULL DEFAULT 0;
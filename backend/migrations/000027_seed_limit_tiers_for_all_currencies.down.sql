@@ -0,0 +1 @@
+DELETE FROM limit_tiers WHERE currency IN ('AED', 'BHD', 'EUR', 'GBP', 'JPY', 'USD');
@@ -0,0 +1,23 @@
+-- every supported currency gets tiers close to the INR ones, a currency
+-- without a row would not be limited at all
+INSERT INTO limit_tiers (verification_level, currency, max_transaction, daily_outgoing, monthly_outgoing, transfers_per_hour, max_balance)
+VALUES
+    (0, 'AED', 44000, 88000, 220000, 10, 44000),
+    (1, 'AED', 440000, 440000, 880000, 20, 880000),
+    (2, 'AED', 880000, 2200000, 4400000, 50, 880000),
+    (0, 'BHD', 45000, 90000, 225000, 10, 45000),
+    (1, 'BHD', 450000, 450000, 900000, 20, 900000),
+    (2, 'BHD', 900000, 2250000, 4500000, 50, 900000),
+    (0, 'EUR', 11000, 22000, 55000, 10, 11000),
+    (1, 'EUR', 110000, 110000, 220000, 20, 220000),
+    (2, 'EUR', 220000, 550000, 1100000, 50, 220000),
+    (0, 'GBP', 9500, 19000, 47500, 10, 9500),
+    (1, 'GBP', 95000, 95000, 190000, 20, 190000),
+    (2, 'GBP', 190000, 475000, 950000, 50, 190000),
+    (0, 'JPY', 18000, 36000, 90000, 10, 18000),
+    (1, 'JPY', 180000, 180000, 360000, 20, 360000),
+    (2, 'JPY', 360000, 900000, 1800000, 50, 360000),
+    (0, 'USD', 12000, 24000, 60000, 10, 12000),
+    (1, 'USD', 120000, 120000, 240000, 20, 240000),
+    (2, 'USD', 240000, 600000, 1200000, 50, 240000)
+ON CONFLICT DO NOTHING;